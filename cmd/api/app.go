@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"flashsale/internal/abuse"
+	"flashsale/internal/auth"
+	"flashsale/internal/cache"
+	"flashsale/internal/handler"
+	"flashsale/internal/middleware"
+	queue "flashsale/internal/mq"
+	"flashsale/internal/ratelimit"
+	"flashsale/internal/repository"
+	"flashsale/internal/repository/redis"
+	"flashsale/internal/router"
+	"flashsale/internal/service"
+	"flashsale/internal/service/serviceiface"
+	"flashsale/internal/waitingroom"
+	"flashsale/pkg/config"
+	"flashsale/pkg/db"
+	"flashsale/pkg/mq"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+const queueName = "flashsale_order_queue"
+
+// app holds every dependency of the API server, built once by newApp and passed down by constructors
+type app struct {
+	cfg  *config.Config
+	pool *pgxpool.Pool
+	rdb  goredis.UniversalClient
+	mq   *mq.RabbitMQClient
+
+	// background loops, started by run
+	soldOut  *service.SoldOutCache
+	audit    *service.AdminAuditService
+	room     *waitingroom.Service
+	policies *ratelimit.Registry
+	local    *ratelimit.LocalLimiter
+
+	router *gin.Engine
+}
+
+func newApp(ctx context.Context, cfg *config.Config) (a *app, err error) {
+	a = &app{cfg: cfg}
+	defer func() {
+		if err != nil {
+			a.close()
+		}
+	}()
+
+	// ------ init Postgres ------
+	a.pool, err = db.NewPostgresPool(
+		cfg.PostgresHost,
+		cfg.PostgresPort,
+		cfg.PostgresUser,
+		cfg.PostgresPassword,
+		cfg.PostgresDBName,
+		cfg.PostgresSSLMode,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("postgres init failed: %w", err)
+	}
+
+	// ------ init Redis ------
+	a.rdb, err = cache.ConnectRedis(ctx, cache.RedisConfig{
+		Mode:       cfg.RedisMode,
+		Addrs:      cfg.RedisAddrs,
+		MasterName: cfg.RedisMasterName,
+		Password:   cfg.RedisPassword,
+		PoolSize:   cfg.RedisPoolSize,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("redis init failed: %w", err)
+	}
+
+	// ------ init RabbitMQ ------
+	a.mq, err = mq.NewRabbitMQClient(cfg.MQUrl, queueName)
+	if err != nil {
+		return nil, fmt.Errorf("rabbitmq init failed: %w", err)
+	}
+
+	if err := a.build(ctx, queue.NewRabbitMQOrderPublisher(a.mq)); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// build wires repositories, services & router on the opened clients
+// the order publisher is passed in, tests build the app without RabbitMQ
+func (a *app) build(ctx context.Context, orderPublisher serviceiface.OrderPublisher) error {
+	cfg := a.cfg
+	scriptDir := cfg.ScriptDir
+
+	// load precheck lua scripts
+	scripts, err := cache.LoadLuaScripts(a.rdb, scriptDir)
+	if err != nil {
+		return err
+	}
+
+	warmupDBRepo := repository.NewWarmUpRepository(a.pool, "postgres")
+	warmupRedisRepo := redis.NewFlashSaleRedisRepo(a.rdb)
+	orderRepo := repository.NewOrderRepository(a.pool, "postgres")
+	stockRepo := repository.NewStockRepository(a.pool, "postgres")
+	orderStatusCache := redis.NewOrderStatusRedisRepo(a.rdb)
+	auditRepo := repository.NewAuditLogRepository(a.pool, "postgres")
+	userQuotaRepo, err := redis.NewUserQuotaRedisRepo(a.rdb, scriptDir)
+	if err != nil {
+		return err
+	}
+	purchaseClaimRepo, err := redis.NewPurchaseClaimRedisRepo(a.rdb, scriptDir)
+	if err != nil {
+		return err
+	}
+	redisStockRepo, err := redis.NewRedisStockRepo(a.rdb, scriptDir)
+	if err != nil {
+		return err
+	}
+
+	// init Service
+	warmupService := service.NewFlashSaleWarmUpService(warmupDBRepo, warmupRedisRepo, cfg.StockBuckets, cfg.CatalogCacheTTL)
+	saleCatalog := service.NewSaleCatalog(warmupDBRepo, warmupRedisRepo, cfg.SaleCacheTTL)
+	createMode := service.OrderCreateMode(cfg.OrderCreateMode)
+	if !createMode.Valid() {
+		return fmt.Errorf("invalid ORDER_CREATE_MODE %q", cfg.OrderCreateMode)
+	}
+	// sold out fast path, kept in sync by pub/sub
+	a.soldOut = service.NewSoldOutCache(redis.NewSoldOutRedisRepo(a.rdb))
+	orderService := service.NewOrderService(orderPublisher, scripts, orderRepo, saleCatalog, orderStatusCache, userQuotaRepo, purchaseClaimRepo, createMode, a.soldOut)
+	stockService := service.NewStockService(stockRepo, redisStockRepo, warmupRedisRepo)
+	catalogService := service.NewCatalogService(warmupDBRepo, warmupRedisRepo, redisStockRepo, cfg.CatalogCacheTTL)
+	resultService := service.NewOrderResultService(orderRepo, orderStatusCache)
+	orderListService := service.NewOrderListService(orderRepo)
+	a.audit = service.NewAdminAuditService(auditRepo)
+	idempotencyService := service.NewIdempotencyService(redis.NewIdempotencyRedisRepo(a.rdb), cfg.IdempotencyTTL)
+
+	// abuse detection, blocklist & signals in Redis
+	abuseCfg := abuse.DefaultConfig()
+	abuseCfg.Mode = abuse.Mode(cfg.AbuseMode)
+	abuseCfg.BlockTTL = cfg.AbuseBlockTTL
+	if !abuseCfg.Mode.Valid() {
+		return fmt.Errorf("invalid ABUSE_MODE %q", cfg.AbuseMode)
+	}
+	abuseService := abuse.NewService(abuseCfg, redis.NewBlocklistRedisRepo(a.rdb), redis.NewAbuseSignalRedisRepo(a.rdb))
+
+	// waiting room, admitter runs on every instance, admission state is in Redis
+	if cfg.WaitingRoomEnabled {
+		roomRepo, err := redis.NewWaitingRoomRedisRepo(a.rdb, scriptDir)
+		if err != nil {
+			return fmt.Errorf("waiting room init failed: %w", err)
+		}
+		a.room = waitingroom.NewService(waitingroom.Config{
+			AdmitRate:     cfg.WaitingRoomAdmitRate,
+			AdmitInterval: 100 * time.Millisecond,
+			TicketTTL:     cfg.WaitingRoomTicketTTL,
+		}, roomRepo)
+	}
+
+	// init auth, local HMAC key from config
+	if cfg.AuthHMACSecret == "" {
+		return fmt.Errorf("AUTH_HMAC_SECRET is required")
+	}
+	authenticator := auth.NewAuthenticator(auth.NewStaticKeySource(cfg.AuthKeyID, cfg.AuthHMACSecret), nil)
+
+	// init rate limit policies, hot reload from Redis override or file
+	a.policies, err = ratelimit.NewRegistry(ctx,
+		ratelimit.RedisSource{Rdb: a.rdb, Key: cfg.RateLimitRedisKey},
+		ratelimit.FileSource{Path: cfg.RateLimitConfigPath},
+	)
+	if err != nil {
+		return fmt.Errorf("rate limit policies load failed: %w", err)
+	}
+
+	// load hybrid lua
+	hybrid, err := cache.LoadHybridLimiter(a.rdb, scriptDir+"/rate_limit_hybrid.lua")
+	if err != nil {
+		return err
+	}
+	hybrid.SplitSlots = cfg.RedisMode == "cluster"
+	// local limiter: fallback of on_error "local" routes, optionally a tier in front of Redis
+	a.local = ratelimit.NewLocalLimiter(cfg.APIInstances, cfg.RateLimitLocalBorderline)
+	limiter := middleware.NewRateLimiter(
+		a.policies,
+		a.rdb,
+		hybrid,
+		ratelimit.NewBreaker("redis_limiter", cfg.RateLimitBreakerThreshold, cfg.RateLimitBreakerCooldown),
+		a.local,
+	)
+	if cfg.RateLimitLocalTier {
+		limiter.WithLocalTier(a.local)
+		log.Printf("local rate limit tier on, instances=%d borderline=%.2f", cfg.APIInstances, cfg.RateLimitLocalBorderline)
+	}
+
+	// init Router/Gin http server
+	var waitingRoomHandler *handler.WaitingRoomHandler
+	if a.room != nil {
+		waitingRoomHandler = handler.NewWaitingRoomHandler(a.room)
+	}
+	a.router = router.SetupRouter(
+		handler.NewWarmUpHandler(warmupService),
+		handler.NewOrderHandler(orderService, a.room, idempotencyService),
+		handler.NewStockHandler(stockService),
+		handler.NewOrderResultHandler(resultService),
+		handler.NewOrderListHandler(orderListService),
+		handler.NewAdminAuditHandler(a.audit),
+		authenticator,
+		a.audit,
+		limiter,
+		handler.NewAbuseHandler(abuseService),
+		abuseService,
+		waitingRoomHandler,
+		handler.NewCatalogHandler(catalogService),
+		handler.NewSoldOutEventsHandler(a.soldOut, cfg.SSEMaxConns),
+	)
+	return nil
+}
+
+// run starts the background loops and serves HTTP until the server fails or ctx is done
+func (a *app) run(ctx context.Context) error {
+	// the audit writer stops after the server, so in-flight admin requests still get their row
+	auditCtx, stopAudit := context.WithCancel(context.WithoutCancel(ctx))
+	defer stopAudit()
+	auditDone := make(chan struct{})
+	go func() {
+		a.audit.Run(auditCtx)
+		close(auditDone)
+	}()
+
+	go a.soldOut.Run(ctx, 5*time.Second)
+	go a.policies.Watch(ctx, a.cfg.RateLimitReloadInterval)
+	go a.local.Janitor(ctx, time.Minute)
+	if a.room != nil {
+		go a.room.RunAdmitter(ctx)
+		log.Printf("waiting room on, admit rate=%.1f/s", a.cfg.WaitingRoomAdmitRate)
+	}
+
+	srv := &http.Server{Addr: ":8080", Handler: a.router}
+	errc := make(chan error, 1)
+	go func() { errc <- srv.ListenAndServe() }()
+	log.Println("Flash Sale API Server running on : 8080")
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := srv.Shutdown(shutdownCtx)
+	stopAudit()
+	<-auditDone
+	return err
+}
+
+// close releases the clients that were opened, safe on a partly built app
+func (a *app) close() {
+	if a.mq != nil {
+		a.mq.Close()
+	}
+	if a.rdb != nil {
+		a.rdb.Close()
+	}
+	if a.pool != nil {
+		a.pool.Close()
+	}
+}
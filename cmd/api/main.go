@@ -1,90 +1,36 @@
 package main
 
 import (
-	"flashsale/internal/cache"
-	"flashsale/internal/handler"
-	queue "flashsale/internal/mq"
-	"flashsale/internal/repository"
-	"flashsale/internal/repository/redis"
-	"flashsale/internal/router"
-	"flashsale/internal/service"
+	"context"
 	"flashsale/pkg/config"
-	"flashsale/pkg/db"
-	"flashsale/pkg/mq"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
 
 	cfg := config.LoadConfig()
 
-	queueName := "flashsale_order_queue"
-	// ttlSeconds := 60
-
-	// ------ init Postgres ------
-	if err := db.InitPostgresDB(
-		cfg.PostgresHost,
-		cfg.PostgresPort,
-		cfg.PostgresUser,
-		cfg.PostgresPassword,
-		cfg.PostgresDBName,
-		cfg.PostgresSSLMode,
-	); err != nil {
-		log.Fatalf("Postgres init failed: %v", err)
-	}
-
-	// ------ init Redis ------
-	err := cache.InitRedis(cfg.RedisHost, cfg.RedisPort, cfg.RedisPassword, 0)
-	if err != nil {
-		log.Fatalf("Redis init failed: %v", err)
-	}
-
-	// load precheck lua scripts
-	scripts, err := cache.LoadLuaScripts(cache.Rdb, "./scripts")
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	cache.SetLuaScripts(scripts)
-
-	// ------ init RabbitMQ ------
-	mqClient, err := mq.NewRabbitMQClient(
-		cfg.MQUrl,
-		queueName,
-	)
+	// graceful shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigc
+		log.Println("shutdown signal received")
+		cancel()
+	}()
+
+	a, err := newApp(ctx, cfg)
 	if err != nil {
-		log.Fatalf("RabbitMQ init failed: %v", err)
+		log.Fatalf("API init failed: %v", err)
 	}
-	defer mqClient.Close()
-	warmupDBRepo := repository.NewWarmUpRepository(db.Pool, "postgres")
-	warmupRedisRepo := redis.NewFlashSaleRedisRepo(cache.Rdb)
-	orderRepo := repository.NewOrderRepository(db.Pool, "postgres")
-	stockRepo := repository.NewStockRepository(db.Pool, "postgres")
-
-	// init OrderService + publisher
-	orderPublisher := queue.NewRabbitMQOrderPublisher(mqClient)
-
-	// init Service
-	warmupService := service.NewFlashSaleWarmUpService(warmupDBRepo, warmupRedisRepo)
-	orderService := service.NewOrderService(orderPublisher, scripts, orderRepo, warmupDBRepo)
-	stockService := service.NewStockService(cache.Rdb, stockRepo)
-	resultService := service.NewOrderResultService(orderRepo)
-
-	// init Router/Gin http server
-	warmupHandler := handler.NewWarmUpHandler(warmupService)
-	orderHandler := handler.NewOrderHandler(orderService)
-	stockHandler := handler.NewStockHandler(stockService)
-	resultHandler := handler.NewOrderResultHandler(resultService)
-	r := router.SetupRouter(
-		warmupHandler,
-		orderHandler,
-		stockHandler,
-		resultHandler,
-	)
-
-	log.Println("Flash Sale API Server running on : 8080")
+	defer a.close()
 
-	if err := r.Run(":8080"); err != nil {
+	if err := a.run(ctx); err != nil {
 		log.Fatalf("API server failed: %v", err)
 	}
 }
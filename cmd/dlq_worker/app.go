@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"flashsale/internal/cache"
+	"flashsale/internal/repository"
+	"flashsale/internal/repository/redis"
+	"flashsale/internal/service"
+	"flashsale/internal/worker"
+	"flashsale/pkg/config"
+	"flashsale/pkg/db"
+	"flashsale/pkg/mq"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+const dlqQueue = "flashsale_order_dlq"
+
+// app holds every dependency of the DLQ worker, built once by newApp and passed down by constructors
+type app struct {
+	pool *pgxpool.Pool
+	rdb  goredis.UniversalClient
+	mq   *mq.RabbitMQClient
+
+	dlqWorker *worker.DLQWorker
+}
+
+func newApp(ctx context.Context, cfg *config.Config) (a *app, err error) {
+	a = &app{}
+	defer func() {
+		if err != nil {
+			a.close()
+		}
+	}()
+
+	// infra
+	a.pool, err = db.NewPostgresPool(
+		cfg.PostgresHost,
+		cfg.PostgresPort,
+		cfg.PostgresUser,
+		cfg.PostgresPassword,
+		cfg.PostgresDBName,
+		cfg.PostgresSSLMode,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("postgres init failed after retry: %w", err)
+	}
+	a.rdb, err = cache.ConnectRedis(ctx, cache.RedisConfig{
+		Mode:       cfg.RedisMode,
+		Addrs:      cfg.RedisAddrs,
+		MasterName: cfg.RedisMasterName,
+		Password:   cfg.RedisPassword,
+		PoolSize:   cfg.RedisPoolSize,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("redis init failed: %w", err)
+	}
+	a.mq, err = mq.NewRabbitMQClient(cfg.MQUrl, dlqQueue)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.build(cfg); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// build wires the compensator on the opened Postgres & Redis clients
+func (a *app) build(cfg *config.Config) error {
+	scriptDir := cfg.ScriptDir
+	repo := repository.NewOrderRepository(a.pool, "postgres")
+	orderStatusCache := redis.NewOrderStatusRedisRepo(a.rdb)
+	userQuotaRepo, err := redis.NewUserQuotaRedisRepo(a.rdb, scriptDir)
+	if err != nil {
+		return err
+	}
+	purchaseClaimRepo, err := redis.NewPurchaseClaimRedisRepo(a.rdb, scriptDir)
+	if err != nil {
+		return err
+	}
+	compensator := service.NewOrderCompensator(repo, orderStatusCache, userQuotaRepo, purchaseClaimRepo)
+	a.dlqWorker = worker.NewDLQWorker(compensator)
+	return nil
+}
+
+// close releases the clients that were opened, safe on a partly built app
+func (a *app) close() {
+	if a.mq != nil {
+		a.mq.Close()
+	}
+	if a.rdb != nil {
+		a.rdb.Close()
+	}
+	if a.pool != nil {
+		a.pool.Close()
+	}
+}
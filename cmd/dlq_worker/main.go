@@ -3,53 +3,25 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"flashsale/internal/cache"
 	"flashsale/internal/dto"
-	"flashsale/internal/repository"
-	"flashsale/internal/repository/redis"
-	"flashsale/internal/service"
-	"flashsale/internal/worker"
 	"flashsale/pkg/config"
-	"flashsale/pkg/db"
-	"flashsale/pkg/mq"
 	"log"
 )
 
 func main() {
 	cfg := config.LoadConfig()
-	dlqQueue := "flashsale_order_dlq"
+	ctx := context.Background()
 
-	// infra
-	if err := db.InitPostgresDB(
-		cfg.PostgresHost,
-		cfg.PostgresPort,
-		cfg.PostgresUser,
-		cfg.PostgresPassword,
-		cfg.PostgresDBName,
-		cfg.PostgresSSLMode,
-	); err != nil {
-		log.Fatalf("Postgres init failed after retry: %v", err)
-	}
-	if err := cache.InitRedis(cfg.RedisHost, cfg.RedisPort, "", 0); err != nil {
-		log.Fatalf("Redis init failed: %v", err)
-	}
-
-	mqClient, err := mq.NewRabbitMQClient(cfg.MQUrl, dlqQueue)
+	a, err := newApp(ctx, cfg)
 	if err != nil {
-		log.Fatal(err)
+		log.Fatalf("DLQ worker init failed: %v", err)
 	}
-	defer mqClient.Close()
+	defer a.close()
 
-	consumer, err := mqClient.Consume(context.Background(), "dlq-worker", false)
+	consumer, err := a.mq.Consume(ctx, "dlq-worker", false)
 	if err != nil {
 		log.Fatal(err)
 	}
-
-	// dependencies
-	repo := repository.NewOrderRepository(db.Pool, "postgres")
-	redisStockRepo := redis.NewRedisStockRepo(cache.Rdb)
-	compensator := service.NewOrderCompensator(repo, redisStockRepo)
-	dlqWorker := worker.NewDLQWorker(compensator)
 	log.Println("DLQ worker started")
 
 	for d := range consumer {
@@ -61,7 +33,7 @@ func main() {
 			continue
 		}
 
-		err := dlqWorker.Handle(context.Background(), msg)
+		err := a.dlqWorker.Handle(ctx, msg)
 		if err != nil {
 			log.Printf("[DLQ] compensation failed: %v", err)
 			d.Ack(false)
@@ -0,0 +1,37 @@
+package main
+
+// tokengen mints bearer tokens with the local HMAC key, for curl / k6 testing
+// usage: go run ./cmd/tokengen -user U1 [-role admin] [-tier vip] [-ttl 1h]
+
+import (
+	"flag"
+	"flashsale/internal/auth"
+	"flashsale/pkg/config"
+	"fmt"
+	"log"
+	"time"
+)
+
+func main() {
+	userID := flag.String("user", "", "user id (token subject)")
+	role := flag.String("role", "", "optional role")
+	tier := flag.String("tier", "", "optional rate limit tier")
+	ttl := flag.Duration("ttl", time.Hour, "token lifetime")
+	flag.Parse()
+
+	if *userID == "" {
+		log.Fatal("-user is required")
+	}
+
+	cfg := config.LoadConfig()
+	if cfg.AuthHMACSecret == "" {
+		log.Fatal("AUTH_HMAC_SECRET is required")
+	}
+
+	a := auth.NewAuthenticator(auth.NewStaticKeySource(cfg.AuthKeyID, cfg.AuthHMACSecret), nil)
+	token, err := a.Issue(*userID, *role, *tier, *ttl)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(token)
+}
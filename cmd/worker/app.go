@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"flashsale/internal/cache"
+	queue "flashsale/internal/mq"
+	"flashsale/internal/repository"
+	"flashsale/internal/repository/redis"
+	"flashsale/internal/worker"
+	"flashsale/pkg/config"
+	"flashsale/pkg/db"
+	"flashsale/pkg/mq"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+const (
+	queueName    = "flashsale_order_queue"
+	dlqQueueName = "flashsale_order_dlq"
+)
+
+// app holds every dependency of the order worker, built once by newApp and passed down by constructors
+type app struct {
+	pool *pgxpool.Pool
+	rdb  goredis.UniversalClient
+	mq   *mq.RabbitMQClient
+	dlq  *mq.RabbitMQClient
+
+	processor    *worker.OrderProcessor
+	dlqPublisher *queue.RabbitMQDLQPublisher
+}
+
+func newApp(ctx context.Context, cfg *config.Config) (a *app, err error) {
+	a = &app{}
+	defer func() {
+		if err != nil {
+			a.close()
+		}
+	}()
+
+	// init Postgres
+	a.pool, err = db.NewPostgresPool(cfg.PostgresHost, cfg.PostgresPort, cfg.PostgresUser, cfg.PostgresPassword, cfg.PostgresDBName, cfg.PostgresSSLMode)
+	if err != nil {
+		return nil, fmt.Errorf("postgres init failed: %w", err)
+	}
+	// init redis
+	a.rdb, err = cache.ConnectRedis(ctx, cache.RedisConfig{
+		Mode:       cfg.RedisMode,
+		Addrs:      cfg.RedisAddrs,
+		MasterName: cfg.RedisMasterName,
+		Password:   cfg.RedisPassword,
+		PoolSize:   cfg.RedisPoolSize,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("redis init failed: %w", err)
+	}
+	// Init RabbitMQ
+	a.mq, err = mq.NewRabbitMQClient(cfg.MQUrl, queueName)
+	if err != nil {
+		return nil, fmt.Errorf("rabbitmq init failed: %w", err)
+	}
+	// Init DLQ RabbitMQ
+	a.dlq, err = mq.NewRabbitMQClient(cfg.MQUrl, dlqQueueName)
+	if err != nil {
+		return nil, fmt.Errorf("DLQ rabbitmq init failed: %w", err)
+	}
+	a.dlqPublisher = queue.NewRabbitMQDLQPublisher(a.dlq)
+
+	if err := a.build(cfg); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// build wires the order processor on the opened Postgres & Redis clients
+func (a *app) build(cfg *config.Config) error {
+	scriptDir := cfg.ScriptDir
+	// load lua scripts
+	scripts, err := cache.LoadLuaScripts(a.rdb, scriptDir)
+	if err != nil {
+		return err
+	}
+
+	repo := repository.NewOrderRepository(a.pool, "postgres")
+	orderStatusCache := redis.NewOrderStatusRedisRepo(a.rdb)
+	flashSaleRepo := repository.NewWarmUpRepository(a.pool, "postgres")
+	userQuotaRepo, err := redis.NewUserQuotaRedisRepo(a.rdb, scriptDir)
+	if err != nil {
+		return err
+	}
+	purchaseClaimRepo, err := redis.NewPurchaseClaimRedisRepo(a.rdb, scriptDir)
+	if err != nil {
+		return err
+	}
+	redisStockRepo, err := redis.NewRedisStockRepo(a.rdb, scriptDir)
+	if err != nil {
+		return err
+	}
+	a.processor = worker.NewOrderProcessor(repo, scripts, orderStatusCache, flashSaleRepo, userQuotaRepo, purchaseClaimRepo, redis.NewSoldOutRedisRepo(a.rdb), redisStockRepo, redis.NewStockLockRedisRepo(a.rdb))
+	return nil
+}
+
+// close releases the clients that were opened, safe on a partly built app
+func (a *app) close() {
+	if a.dlq != nil {
+		a.dlq.Close()
+	}
+	if a.mq != nil {
+		a.mq.Close()
+	}
+	if a.rdb != nil {
+		a.rdb.Close()
+	}
+	if a.pool != nil {
+		a.pool.Close()
+	}
+}
@@ -3,15 +3,10 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"flashsale/internal/cache"
 	"flashsale/internal/dto"
-	queue "flashsale/internal/mq"
-	"flashsale/internal/repository"
 	"flashsale/internal/service"
 	"flashsale/internal/worker"
 	"flashsale/pkg/config"
-	"flashsale/pkg/db"
-	"flashsale/pkg/mq"
 	"log"
 	"os"
 	"os/signal"
@@ -22,8 +17,6 @@ import (
 
 func main() {
 	cfg := config.LoadConfig()
-	queueName := "flashsale_order_queue"
-	dlqQueueName := "flashsale_order_dlq"
 
 	// graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
@@ -36,51 +29,16 @@ func main() {
 		cancel()
 	}()
 
-	// init Postgres
-	if err := db.InitPostgresDB(cfg.PostgresHost, cfg.PostgresPort, cfg.PostgresUser, cfg.PostgresPassword, cfg.PostgresDBName, cfg.PostgresSSLMode); err != nil {
-		log.Fatalf("Postgres init failed: %v", err)
-	}
-	// init redis
-	if err := cache.InitRedis(cfg.RedisHost, cfg.RedisPort, "", 0); err != nil {
-		log.Fatalf("redis init failed: %v", err)
-	}
-	// load lua scripts
-	scripts, err := cache.LoadLuaScripts(cache.Rdb, "./scripts")
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	cache.SetLuaScripts(scripts)
-
-	// Init RabbitMQ
-	mqClient, err := mq.NewRabbitMQClient(
-		cfg.MQUrl,
-		queueName,
-	)
+	a, err := newApp(ctx, cfg)
 	if err != nil {
-		log.Fatalf("RabbitMQ init failed: %v", err)
+		log.Fatalf("worker init failed: %v", err)
 	}
-	defer mqClient.Close()
-	log.Println("Worker Started. Waiting for messages...")
+	defer a.close()
 
-	consumer, err := mqClient.Consume(ctx, "worker-1", false) // false, manual ack
+	consumer, err := a.mq.Consume(ctx, "worker-1", false) // false, manual ack
 	if err != nil {
 		log.Fatalf("consume failed: %v", err)
 	}
-	// Init DLQ RabbitMQ
-	dlqClient, err := mq.NewRabbitMQClient(
-		cfg.MQUrl,
-		dlqQueueName,
-	)
-	if err != nil {
-		log.Fatalf("DLQ RabbitMQ init failed: %v", err)
-	}
-	defer dlqClient.Close()
-
-	dlqPublisher := queue.NewRabbitMQDLQPublisher(dlqClient)
-
-	repo := repository.NewOrderRepository(db.Pool, "postgres")
-	orderProcessor := worker.NewOrderProcessor(repo, scripts)
 	log.Println("worker started, awaiting messages...")
 
 	for {
@@ -100,7 +58,7 @@ func main() {
 				// create a fresh timeout per attempt
 				jobCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 				defer cancel()
-				return orderProcessor.ProcessOrder(jobCtx, d.Body)
+				return a.processor.ProcessOrder(jobCtx, d.Body)
 			})
 
 			if processErr != nil {
@@ -112,7 +70,7 @@ func main() {
 				}
 
 				switch processErr {
-				case worker.ErrOutOfStock, worker.ErrLuaReject:
+				case worker.ErrOutOfStock, worker.ErrLuaReject, worker.ErrUserLimitExceeded:
 					// business logic failure -> order already marked FAILED inside processor
 					// should have done in orderProcessor, no compensation needed so Ack directly
 					log.Printf("[Worker] Business logic rejected: %v", processErr)
@@ -129,9 +87,15 @@ func main() {
 							OrderNo:   orderMsg.OrderID,
 							UserID:    orderMsg.UserID,
 							ProductID: mustParseProductID(orderMsg.ProductID),
+
+							CreateOrder: orderMsg.CreateOrder,
+							FlashSaleID: orderMsg.FlashSaleID,
+							Price:       orderMsg.Price,
+
+							StockBuckets: orderMsg.StockBuckets,
 						},
 					}
-					if err := dlqPublisher.Publish(ctx, dlqMsg); err != nil {
+					if err := a.dlqPublisher.Publish(ctx, dlqMsg); err != nil {
 						log.Printf("[DLQ Critical] Failed to publish to DLQ: %v", err)
 						// if DLQ failed as well, No Ack, let  message retry in queue (Unacked)
 						_ = d.Nack(false, true)
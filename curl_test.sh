@@ -6,10 +6,12 @@
 #     -d '{"product":"1001"}' | jq .
 #   echo
 # done
+# token signed with local AUTH_HMAC_SECRET
+TOKEN=$(go run ./cmd/tokengen -user user_testu1)
 for i in {1..40}; do
   curl -s -X POST http://localhost:8080/flashsale/precheck \
     -H "Content-Type: application/json" \
-    -H "X-User-ID: user_testu1" \
-    -d '{"user_id": "user_testu1", "product_id": "1001"}'
+    -H "Authorization: Bearer $TOKEN" \
+    -d '{"product_id": "1001"}'
   echo
 done
@@ -0,0 +1,102 @@
+package abuse
+
+import (
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Signals collected for one request
+type Signals struct {
+	IPUsers      int64       // distinct users from the IP within the window
+	RequestTimes []time.Time // latest requests of the user, newest first
+	Header       http.Header
+}
+
+// Score is the abuse score of a request and why
+type Score struct {
+	Total   int
+	Reasons []string
+	// many accounts behind one IP, the IP itself should be blocked
+	SharedIP bool
+}
+
+func (s *Score) add(points int, reason string) {
+	s.Total += points
+	s.Reasons = append(s.Reasons, reason)
+}
+
+// clients that never show up in a real browser
+// no okhttp: it is the HTTP stack of most Android apps, whole CGNAT ranges would score as bots
+var automationAgents = []string{
+	"curl/", "wget/", "python-requests", "python-urllib", "aiohttp", "go-http-client",
+	"java/", "scrapy", "headlesschrome", "phantomjs", "node-fetch", "axios/",
+}
+
+// Evaluate scores signals, higher is more bot-like
+func Evaluate(cfg Config, sig Signals) Score {
+	var s Score
+
+	// 1. many user ids from one IP
+	switch {
+	case sig.IPUsers >= cfg.IPUsersThreshold:
+		s.add(50, "many users from ip")
+		s.SharedIP = true
+	case sig.IPUsers >= cfg.IPUsersThreshold/2:
+		s.add(20, "several users from ip")
+	}
+
+	// 2. machine-like request timing: intervals almost identical
+	if cv, ok := intervalVariation(sig.RequestTimes, cfg.MinTimingSamples); ok && cv < cfg.RegularityCV {
+		s.add(40, "regular request timing")
+	}
+
+	// 3. header fingerprint
+	ua := strings.ToLower(sig.Header.Get("User-Agent"))
+	if ua == "" {
+		s.add(30, "no user agent")
+	} else {
+		for _, a := range automationAgents {
+			if strings.Contains(ua, a) {
+				s.add(30, "automation user agent")
+				break
+			}
+		}
+	}
+	if sig.Header.Get("Accept-Language") == "" {
+		s.add(10, "no accept-language")
+	}
+	if sig.Header.Get("Accept") == "" {
+		s.add(10, "no accept")
+	}
+	return s
+}
+
+// intervalVariation: coefficient of variation of the gaps between requests
+func intervalVariation(times []time.Time, minSamples int) (float64, bool) {
+	if len(times) < minSamples || len(times) < 3 {
+		return 0, false
+	}
+	gaps := make([]float64, 0, len(times)-1)
+	for i := 1; i < len(times); i++ {
+		gaps = append(gaps, times[i-1].Sub(times[i]).Seconds())
+	}
+
+	var mean float64
+	for _, g := range gaps {
+		mean += g
+	}
+	mean /= float64(len(gaps))
+	if mean <= 0 {
+		// burst in the same millisecond, the rate limiter handles that
+		return 0, false
+	}
+
+	var variance float64
+	for _, g := range gaps {
+		variance += (g - mean) * (g - mean)
+	}
+	variance /= float64(len(gaps))
+	return math.Sqrt(variance) / mean, true
+}
@@ -0,0 +1,99 @@
+package abuse
+
+import (
+	"math"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// browserHeader looks like a real browser, scores 0 on headers
+func browserHeader() http.Header {
+	h := http.Header{}
+	h.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/120.0 Safari/537.36")
+	h.Set("Accept", "application/json")
+	h.Set("Accept-Language", "en-US")
+	return h
+}
+
+// requestTimes: newest first, gaps in ms
+func requestTimes(gapsMs ...int) []time.Time {
+	t := time.Unix(1_700_000_000, 0)
+	times := []time.Time{t}
+	for _, g := range gapsMs {
+		t = t.Add(-time.Duration(g) * time.Millisecond)
+		times = append(times, t)
+	}
+	return times
+}
+
+func TestIntervalVariation(t *testing.T) {
+	tests := []struct {
+		name   string
+		times  []time.Time
+		min    int
+		wantOK bool
+		wantCV float64
+	}{
+		{"too few samples", requestTimes(1000, 1000), 8, false, 0},
+		{"below 3 requests", requestTimes(1000), 0, false, 0},
+		{"same instant", requestTimes(0, 0, 0), 3, false, 0},
+		{"identical gaps", requestTimes(500, 500, 500, 500), 5, true, 0},
+		// gaps 1s & 3s: mean 2, stddev 1
+		{"alternating gaps", requestTimes(1000, 3000, 1000, 3000), 5, true, 0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cv, ok := intervalVariation(tt.times, tt.min)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && math.Abs(cv-tt.wantCV) > 1e-9 {
+				t.Fatalf("cv = %v, want %v", cv, tt.wantCV)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	cfg := DefaultConfig()
+
+	header := func(mod func(h http.Header)) http.Header {
+		h := browserHeader()
+		mod(h)
+		return h
+	}
+
+	tests := []struct {
+		name       string
+		sig        Signals
+		wantTotal  int
+		wantShared bool
+	}{
+		{"browser", Signals{IPUsers: 1, Header: browserHeader()}, 0, false},
+		{"several users from ip", Signals{IPUsers: cfg.IPUsersThreshold / 2, Header: browserHeader()}, 20, false},
+		{"many users from ip", Signals{IPUsers: cfg.IPUsersThreshold, Header: browserHeader()}, 50, true},
+		{"regular timing", Signals{IPUsers: 1, Header: browserHeader(), RequestTimes: requestTimes(200, 200, 200, 200, 200, 200, 200)}, 40, false},
+		{"irregular timing", Signals{IPUsers: 1, Header: browserHeader(), RequestTimes: requestTimes(200, 900, 300, 1500, 250, 700, 400)}, 0, false},
+		{"curl", Signals{IPUsers: 1, Header: header(func(h http.Header) { h.Set("User-Agent", "curl/8.4.0") })}, 30, false},
+		{"android app", Signals{IPUsers: 1, Header: header(func(h http.Header) { h.Set("User-Agent", "okhttp/4.12.0") })}, 0, false},
+		{"no user agent", Signals{IPUsers: 1, Header: header(func(h http.Header) { h.Del("User-Agent") })}, 30, false},
+		{"bare client", Signals{IPUsers: 1, Header: http.Header{}}, 50, false},
+		{"bot farm", Signals{
+			IPUsers:      cfg.IPUsersThreshold,
+			Header:       header(func(h http.Header) { h.Set("User-Agent", "python-requests/2.31") }),
+			RequestTimes: requestTimes(100, 100, 100, 100, 100, 100, 100),
+		}, 120, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := Evaluate(cfg, tt.sig)
+			if s.Total != tt.wantTotal || s.SharedIP != tt.wantShared {
+				t.Fatalf("Evaluate() = %+v, want total %d shared %v", s, tt.wantTotal, tt.wantShared)
+			}
+			if s.Total > 0 && len(s.Reasons) == 0 {
+				t.Fatal("score without reasons")
+			}
+		})
+	}
+}
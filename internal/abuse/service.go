@@ -0,0 +1,161 @@
+package abuse
+
+import (
+	"context"
+	"errors"
+	"flashsale/internal/domain"
+	"flashsale/internal/repository/repositoryiface"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Mode of the detector
+type Mode string
+
+const (
+	ModeEnforce Mode = "enforce" // score, auto block & reject blocked callers
+	ModeMonitor Mode = "monitor" // score & log only, blocklist still applies
+	ModeOff     Mode = "off"     // no scoring, no blocklist
+)
+
+func (m Mode) Valid() bool {
+	return m == ModeEnforce || m == ModeMonitor || m == ModeOff
+}
+
+type Config struct {
+	Mode             Mode
+	BlockScore       int           // score that triggers an automatic block
+	BlockTTL         time.Duration // automatic block duration
+	IPUsersThreshold int64         // distinct users per IP within SignalWindow
+	RegularityCV     float64       // interval variation below this looks scripted
+	MinTimingSamples int           // requests needed before timing is judged
+	SignalWindow     time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Mode:             ModeMonitor,
+		BlockScore:       80,
+		BlockTTL:         15 * time.Minute,
+		IPUsersThreshold: 20,
+		RegularityCV:     0.1,
+		MinTimingSamples: 8,
+		SignalWindow:     10 * time.Minute,
+	}
+}
+
+var ErrInvalidBlock = errors.New("invalid block request")
+
+// Request is what the detector sees of an incoming request
+type Request struct {
+	IP     string
+	UserID string
+	Header http.Header
+	At     time.Time
+}
+
+// Verdict: Blocked callers must be rejected, Entry says why
+type Verdict struct {
+	Blocked bool
+	Entry   *domain.BlockEntry
+	Score   Score
+}
+
+type Service struct {
+	cfg     Config
+	blocks  repositoryiface.BlocklistRepository
+	signals repositoryiface.AbuseSignalRepository
+}
+
+func NewService(cfg Config, blocks repositoryiface.BlocklistRepository, signals repositoryiface.AbuseSignalRepository) *Service {
+	return &Service{cfg: cfg, blocks: blocks, signals: signals}
+}
+
+// Check: 1. blocklist 2. record signals & score 3. auto block when score is high enough
+func (s *Service) Check(ctx context.Context, req Request) (Verdict, error) {
+	if s.cfg.Mode == ModeOff {
+		return Verdict{}, nil
+	}
+
+	// 1. already blocked
+	entry, err := s.blocks.Find(ctx, req.IP, req.UserID)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("blocklist lookup: %w", err)
+	}
+	if entry != nil {
+		return Verdict{Blocked: true, Entry: entry}, nil
+	}
+
+	// 2. signals
+	sig := Signals{Header: req.Header}
+	if req.UserID != "" {
+		if sig.IPUsers, err = s.signals.TrackIPUser(ctx, req.IP, req.UserID, s.cfg.SignalWindow); err != nil {
+			return Verdict{}, fmt.Errorf("track ip users: %w", err)
+		}
+		if sig.RequestTimes, err = s.signals.TrackUserRequest(ctx, req.UserID, req.At, s.cfg.MinTimingSamples, s.cfg.SignalWindow); err != nil {
+			return Verdict{}, fmt.Errorf("track user requests: %w", err)
+		}
+	}
+	score := Evaluate(s.cfg, sig)
+	if score.Total < s.cfg.BlockScore {
+		return Verdict{Score: score}, nil
+	}
+
+	log.Printf("[abuse] ip=%s user=%s score=%d reasons=%v mode=%s", req.IP, req.UserID, score.Total, score.Reasons, s.cfg.Mode)
+	if s.cfg.Mode != ModeEnforce {
+		return Verdict{Score: score}, nil
+	}
+
+	// 3. auto block: the IP when it carries many accounts, otherwise the user
+	kind, value := domain.BlockUser, req.UserID
+	if score.SharedIP || req.UserID == "" {
+		kind, value = domain.BlockIP, req.IP
+	}
+	entry = &domain.BlockEntry{
+		Kind:      kind,
+		Value:     value,
+		Reason:    strings.Join(score.Reasons, ", "),
+		Score:     score.Total,
+		Source:    "auto",
+		CreatedAt: req.At,
+		ExpiresAt: req.At.Add(s.cfg.BlockTTL),
+	}
+	if err := s.blocks.Block(ctx, *entry); err != nil {
+		return Verdict{}, fmt.Errorf("auto block: %w", err)
+	}
+	return Verdict{Blocked: true, Entry: entry, Score: score}, nil
+}
+
+// Block adds a manual entry, actor is the admin token subject
+func (s *Service) Block(ctx context.Context, kind domain.BlockKind, value, reason, actor string, ttl time.Duration) (*domain.BlockEntry, error) {
+	if !kind.Valid() || value == "" || ttl <= 0 {
+		return nil, ErrInvalidBlock
+	}
+	now := time.Now()
+	entry := &domain.BlockEntry{
+		Kind:      kind,
+		Value:     value,
+		Reason:    reason,
+		Source:    actor,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	if err := s.blocks.Block(ctx, *entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (s *Service) Unblock(ctx context.Context, kind domain.BlockKind, value string) error {
+	if !kind.Valid() || value == "" {
+		return ErrInvalidBlock
+	}
+	return s.blocks.Unblock(ctx, kind, value)
+}
+
+func (s *Service) List(ctx context.Context) ([]domain.BlockEntry, error) {
+	return s.blocks.List(ctx)
+}
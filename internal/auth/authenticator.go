@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"fmt"
+	"time"
+
+	"flashsale/internal/domain/user"
+)
+
+// Authenticator verifies bearer tokens & optionally checks the user still exists
+type Authenticator struct {
+	keys  KeySource
+	users user.UserInterface // nil: trust the signed subject
+	now   func() time.Time
+}
+
+func NewAuthenticator(keys KeySource, users user.UserInterface) *Authenticator {
+	return &Authenticator{keys: keys, users: users, now: time.Now}
+}
+
+func (a *Authenticator) Authenticate(token string) (*Claims, error) {
+	claims, err := Verify(a.keys, token, a.now())
+	if err != nil {
+		return nil, err
+	}
+	if a.users != nil {
+		if _, err := a.users.GetUserByID(claims.Subject); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+		}
+	}
+	return claims, nil
+}
+
+// Issue signs a token for userID valid for ttl
+func (a *Authenticator) Issue(userID, role, tier string, ttl time.Duration) (string, error) {
+	now := a.now()
+	return Sign(a.keys, Claims{
+		Subject:   userID,
+		Role:      role,
+		Tier:      tier,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	})
+}
@@ -0,0 +1,23 @@
+package auth
+
+// Roles ordered by privilege: admin > operator > viewer
+const (
+	RoleAdmin    = "admin"    // everything, incl. reading any user's order
+	RoleOperator = "operator" // run sale operations, e.g. warm-up
+	RoleViewer   = "viewer"   // read-only admin endpoints
+)
+
+var roleRank = map[string]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+// HasRole reports whether role grants at least the privileges of required
+func HasRole(role, required string) bool {
+	have, ok := roleRank[role]
+	if !ok {
+		return false
+	}
+	return have >= roleRank[required]
+}
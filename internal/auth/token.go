@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Minimal HS256 JWT: header.payload.signature, base64url without padding
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrTokenExpired = errors.New("token expired")
+)
+
+const algHS256 = "HS256"
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// Claims carried by the token, Subject is the verified user ID
+type Claims struct {
+	Subject   string `json:"sub"`
+	Role      string `json:"role,omitempty"`
+	Tier      string `json:"tier,omitempty"` // rate limit tier, eg. "vip"
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+func (c *Claims) IsAdmin() bool {
+	return c.Role == RoleAdmin
+}
+
+// Sign issues a token for claims with the current signing key of keys
+func Sign(keys KeySource, claims Claims) (string, error) {
+	kid, key := keys.SigningKey()
+	if len(key) == 0 {
+		return "", errors.New("no signing key")
+	}
+
+	h, err := json.Marshal(header{Alg: algHS256, Typ: "JWT", Kid: kid})
+	if err != nil {
+		return "", err
+	}
+	p, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := b64(h) + "." + b64(p)
+	return unsigned + "." + b64(sign(key, unsigned)), nil
+}
+
+// Verify checks signature & expiry and returns the claims, tokens without exp are rejected
+func Verify(keys KeySource, token string, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, ErrInvalidToken
+	}
+	// only accept the algorithm we sign with, never "none"
+	if h.Alg != algHS256 {
+		return nil, ErrInvalidToken
+	}
+
+	key, err := keys.VerificationKey(h.Kid)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if !hmac.Equal(sig, sign(key, parts[0]+"."+parts[1])) {
+		return nil, ErrInvalidToken
+	}
+
+	var c Claims
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if c.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+	// no exp would never expire
+	if c.ExpiresAt == 0 {
+		return nil, ErrInvalidToken
+	}
+	if now.Unix() >= c.ExpiresAt {
+		return nil, ErrTokenExpired
+	}
+	return &c, nil
+}
+
+func sign(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func validClaims(now time.Time) Claims {
+	return Claims{
+		Subject:   "U1",
+		Role:      RoleViewer,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(time.Hour).Unix(),
+	}
+}
+
+// signWithHeader signs claims under a custom header, eg. another alg
+func signWithHeader(t *testing.T, key []byte, h header, c Claims) string {
+	t.Helper()
+	hb, err := json.Marshal(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pb, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsigned := b64(hb) + "." + b64(pb)
+	return unsigned + "." + b64(sign(key, unsigned))
+}
+
+func TestSignVerify(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	keys := NewStaticKeySource("k1", "secret")
+
+	token, err := Sign(keys, validClaims(now))
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	c, err := Verify(keys, token, now)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if c.Subject != "U1" || c.Role != RoleViewer {
+		t.Fatalf("claims = %+v", c)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	keys := NewStaticKeySource("k1", "secret")
+
+	signed := func(c Claims) string {
+		token, err := Sign(keys, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	valid := signed(validClaims(now))
+
+	expired := validClaims(now)
+	expired.ExpiresAt = now.Unix()
+	noExp := validClaims(now)
+	noExp.ExpiresAt = 0
+
+	// flip the last signature char, still valid base64url
+	tampered := valid[:len(valid)-1] + "A"
+	if tampered == valid {
+		tampered = valid[:len(valid)-1] + "B"
+	}
+	// payload swapped for another user, signature of the original
+	parts := strings.Split(valid, ".")
+	other := validClaims(now)
+	other.Subject = "U2"
+	otherPayload, _ := json.Marshal(other)
+	swapped := parts[0] + "." + b64(otherPayload) + "." + parts[2]
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"alg none", signWithHeader(t, []byte("secret"), header{Alg: "none", Typ: "JWT", Kid: "k1"}, validClaims(now)), ErrInvalidToken},
+		{"alg mismatch", signWithHeader(t, []byte("secret"), header{Alg: "HS512", Typ: "JWT", Kid: "k1"}, validClaims(now)), ErrInvalidToken},
+		{"unknown kid", signWithHeader(t, []byte("secret"), header{Alg: algHS256, Typ: "JWT", Kid: "k2"}, validClaims(now)), ErrInvalidToken},
+		{"other key", signWithHeader(t, []byte("wrong"), header{Alg: algHS256, Typ: "JWT", Kid: "k1"}, validClaims(now)), ErrInvalidToken},
+		{"tampered signature", tampered, ErrInvalidToken},
+		{"tampered payload", swapped, ErrInvalidToken},
+		{"expired", signed(expired), ErrTokenExpired},
+		{"missing exp", signed(noExp), ErrInvalidToken},
+		{"malformed", "a.b", ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := Verify(keys, tt.token, now)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Verify() = %+v, %v, want %v", c, err, tt.want)
+			}
+		})
+	}
+}
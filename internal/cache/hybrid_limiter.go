@@ -5,20 +5,78 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 )
 
 // 1. load SHA of lua script
-// 2. feature: Allow
+// 2. feature: Allow (single key) / AllowLayers (several budgets, one round-trip, one per slot in cluster mode)
+
+// WindowAlgorithm selects how the window limit of a layer is counted
+type WindowAlgorithm string
+
+const (
+	// WindowFixed: INCR+EXPIRE counter, allows up to 2x limit across a window edge
+	WindowFixed WindowAlgorithm = "fixed"
+	// WindowSlidingCounter: previous window weighted by overlap + current window, O(1) memory
+	WindowSlidingCounter WindowAlgorithm = "sliding_counter"
+	// WindowSlidingLog: sorted set of request times, exact, O(limit) memory per key
+	WindowSlidingLog WindowAlgorithm = "sliding_log"
+)
+
+// window keys differ per algorithm, Redis types differ (string/hash/zset)
+var windowKeyPrefix = map[WindowAlgorithm]string{
+	WindowFixed:          "sw:",
+	WindowSlidingCounter: "swc:",
+	WindowSlidingLog:     "swl:",
+}
+
+func (a WindowAlgorithm) Valid() bool {
+	_, ok := windowKeyPrefix[a]
+	return ok
+}
 
 type HybridLimiter struct {
-	Rdb *redis.Client
+	Rdb redis.UniversalClient
 	SHA string
+	// Algorithm is used for layers without own WindowAlgorithm
+	Algorithm WindowAlgorithm
+	// Now is the script's clock, nil: time.Now
+	Now func() time.Time
+	// SplitSlots: Redis Cluster, layers of different hash tags can't share a script call
+	SplitSlots bool
+}
+
+// LimitLayer is one budget checked by the hybrid script
+type LimitLayer struct {
+	Name             string // "global" / "ip" / "user", reported back on reject
+	Key              string // key prefix with hash tag, eg. {route:user:U1}, {route:ip:1.2.3.4}, {route:global}
+	MaxTokens        float64
+	RefillRate       float64
+	SlidingLimit     int64 // 0 disables window check
+	SlidingWindowSec int64
+	WindowAlgorithm  WindowAlgorithm // empty: HybridLimiter.Algorithm
+}
+
+// LimitResult of the rejecting layer, or of the tightest layer when allowed
+type LimitResult struct {
+	Allowed      bool
+	Reason       string // "token" / "sliding"
+	Layer        string
+	TokensLeft   float64
+	SlidingCount int64
+
+	// quota of the reported layer, for RateLimit-* headers
+	Limit      int64
+	Remaining  int64
+	Reset      time.Duration // until window is empty / bucket is full
+	RetryAfter time.Duration // until the rejected request would pass, 0 if allowed
 }
 
-func LoadHybridLimiter(rdb *redis.Client, path string) (*HybridLimiter, error) {
+func LoadHybridLimiter(rdb redis.UniversalClient, path string) (*HybridLimiter, error) {
 	b, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("read lua: %w", err)
@@ -32,8 +90,9 @@ func LoadHybridLimiter(rdb *redis.Client, path string) (*HybridLimiter, error) {
 
 	if err == nil && len(exists) > 0 && exists[0] {
 		return &HybridLimiter{
-			Rdb: rdb,
-			SHA: sha,
+			Rdb:       rdb,
+			SHA:       sha,
+			Algorithm: WindowSlidingCounter,
 		}, nil
 	}
 	newSha, err := rdb.ScriptLoad(context.Background(), string(b)).Result() // use complete script content
@@ -42,8 +101,9 @@ func LoadHybridLimiter(rdb *redis.Client, path string) (*HybridLimiter, error) {
 	}
 
 	return &HybridLimiter{
-		Rdb: rdb,
-		SHA: newSha,
+		Rdb:       rdb,
+		SHA:       newSha,
+		Algorithm: WindowSlidingCounter,
 	}, nil
 }
 
@@ -51,26 +111,104 @@ func LoadHybridLimiter(rdb *redis.Client, path string) (*HybridLimiter, error) {
 // keyPrefix is like user format => user:U1, ip format => ip:1.2.3.4
 // slidingLimit==0 to disable sliding window check
 func (h *HybridLimiter) Allow(ctx context.Context, keyPrefix string, maxTokens float64, refillRate float64, slidingLimit int64, slidingWindowSec int64) (allowed bool, reason string, tokensLeft float64, swCount int64, err error) {
-	now := time.Now().UnixNano() / 1e9
-	res, err := h.Rdb.EvalSha(ctx, h.SHA,
-		[]string{
-			"tb:" + keyPrefix,
-			"sw:" + keyPrefix,
-		},
-		strconv.FormatFloat(maxTokens, 'f', -1, 64),
-		strconv.FormatFloat(refillRate, 'f', -1, 64),
-		fmt.Sprintf("%.6f", now),
-		"1", // cost
-		strconv.FormatInt(slidingLimit, 10),
-		strconv.FormatInt(slidingWindowSec, 10),
-	).Result()
+	res, err := h.AllowLayers(ctx, []LimitLayer{{
+		Name:             keyPrefix,
+		Key:              "{" + keyPrefix + "}", // bucket & window key in one cluster slot
+		MaxTokens:        maxTokens,
+		RefillRate:       refillRate,
+		SlidingLimit:     slidingLimit,
+		SlidingWindowSec: slidingWindowSec,
+	}})
 	if err != nil {
 		return false, "", 0, 0, err
 	}
+	return res.Allowed, res.Reason, res.TokensLeft, res.SlidingCount, nil
+}
+
+// AllowLayers checks all layers in one EVALSHA, all-or-nothing
+// with SplitSlots it's one call per hash tag of LimitLayer.Key (cluster slot), stopping at the first reject;
+// the calls before it stay charged, so order layers from the widest (global) to the narrowest (user)
+func (h *HybridLimiter) AllowLayers(ctx context.Context, layers []LimitLayer) (*LimitResult, error) {
+	if len(layers) == 0 {
+		return &LimitResult{Allowed: true}, nil
+	}
+	if !h.SplitSlots {
+		return h.allowSlot(ctx, layers)
+	}
+
+	var tightest *LimitResult
+	for start := 0; start < len(layers); {
+		end := start + 1
+		for end < len(layers) && hashTag(layers[end].Key) == hashTag(layers[start].Key) {
+			end++
+		}
+		res, err := h.allowSlot(ctx, layers[start:end])
+		if err != nil {
+			return nil, err
+		}
+		if !res.Allowed {
+			return res, nil
+		}
+		if tightest == nil || res.Remaining < tightest.Remaining {
+			tightest = res
+		}
+		start = end
+	}
+	return tightest, nil
+}
+
+// hashTag: the {...} part Redis Cluster hashes, the whole key without one
+func hashTag(key string) string {
+	if i := strings.IndexByte(key, '{'); i >= 0 {
+		if j := strings.IndexByte(key[i+1:], '}'); j > 0 {
+			return key[i+1 : i+1+j]
+		}
+	}
+	return key
+}
+
+// allowSlot runs the script once for layers, in cluster mode they share a hash tag
+func (h *HybridLimiter) allowSlot(ctx context.Context, layers []LimitLayer) (*LimitResult, error) {
+	clock := time.Now
+	if h.Now != nil {
+		clock = h.Now
+	}
+	now := float64(clock().UnixNano()) / 1e9
+	keys := make([]string, 0, len(layers)*2)
+	args := make([]any, 0, 4+len(layers)*6)
+	args = append(args,
+		fmt.Sprintf("%.6f", now),
+		"1",                 // cost
+		uuid.New().String(), // sliding log member
+		strconv.Itoa(len(layers)),
+	)
+	for _, l := range layers {
+		algo := l.WindowAlgorithm
+		if !algo.Valid() {
+			algo = h.Algorithm
+		}
+		if !algo.Valid() {
+			algo = WindowFixed
+		}
+		keys = append(keys, "tb:"+l.Key, windowKeyPrefix[algo]+l.Key)
+		args = append(args,
+			l.Name,
+			strconv.FormatFloat(l.MaxTokens, 'f', -1, 64),
+			strconv.FormatFloat(l.RefillRate, 'f', -1, 64),
+			strconv.FormatInt(l.SlidingLimit, 10),
+			strconv.FormatInt(l.SlidingWindowSec, 10),
+			string(algo),
+		)
+	}
+
+	res, err := h.Rdb.EvalSha(ctx, h.SHA, keys, args...).Result()
+	if err != nil {
+		return nil, err
+	}
 
 	arr, ok := res.([]interface{})
-	if !ok || len(arr) < 4 {
-		return false, "", 0, 0, fmt.Errorf("unexpected lua result: %v", res)
+	if !ok || len(arr) < 9 {
+		return nil, fmt.Errorf("unexpected lua result: %v", res)
 	}
 
 	allowedInt := int64(0)
@@ -80,9 +218,18 @@ func (h *HybridLimiter) Allow(ctx context.Context, keyPrefix string, maxTokens f
 	case string:
 		allowedInt, _ = strconv.ParseInt(v, 10, 64)
 	}
-	reason = fmt.Sprint(arr[1])
-	tokensLeft, _ = strconv.ParseFloat(fmt.Sprint(arr[2]), 64)
-	swCount, _ = strconv.ParseInt(fmt.Sprint(arr[3]), 10, 64)
-	return allowedInt == 1, reason, tokensLeft, swCount, nil
-
+	out := &LimitResult{
+		Allowed: allowedInt == 1,
+		Reason:  fmt.Sprint(arr[1]),
+		Layer:   fmt.Sprint(arr[4]),
+	}
+	out.TokensLeft, _ = strconv.ParseFloat(fmt.Sprint(arr[2]), 64)
+	out.SlidingCount, _ = strconv.ParseInt(fmt.Sprint(arr[3]), 10, 64)
+	out.Limit, _ = strconv.ParseInt(fmt.Sprint(arr[5]), 10, 64)
+	out.Remaining, _ = strconv.ParseInt(fmt.Sprint(arr[6]), 10, 64)
+	resetMs, _ := strconv.ParseInt(fmt.Sprint(arr[7]), 10, 64)
+	retryMs, _ := strconv.ParseInt(fmt.Sprint(arr[8]), 10, 64)
+	out.Reset = time.Duration(resetMs) * time.Millisecond
+	out.RetryAfter = time.Duration(retryMs) * time.Millisecond
+	return out, nil
 }
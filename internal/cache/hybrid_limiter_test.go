@@ -0,0 +1,228 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestHybridLimiter(t *testing.T) (*miniredis.Miniredis, *HybridLimiter) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	h, err := LoadHybridLimiter(rdb, "../../scripts/rate_limit_hybrid.lua")
+	if err != nil {
+		t.Fatalf("load hybrid limiter: %v", err)
+	}
+	return mr, h
+}
+
+func TestHashTag(t *testing.T) {
+	tests := map[string]string{
+		"tb:{order:user:U1}": "order:user:U1",
+		"{a}:b":              "a",
+		"no-tag":             "no-tag",
+		"empty:{}":           "empty:{}",
+		"open:{x":            "open:{x",
+	}
+	for key, want := range tests {
+		if got := hashTag(key); got != want {
+			t.Errorf("hashTag(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+// callCounter counts commands sent by the client, commands run inside scripts aren't seen
+type callCounter struct{ n int }
+
+func (c *callCounter) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (c *callCounter) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		c.n++
+		return next(ctx, cmd)
+	}
+}
+
+func (c *callCounter) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		c.n++
+		return next(ctx, cmds)
+	}
+}
+
+func countCalls(h *HybridLimiter) *callCounter {
+	c := &callCounter{}
+	h.Rdb.AddHook(c)
+	return c
+}
+
+// precheck layers: the global budget has room for one request
+func precheckLayers() []LimitLayer {
+	return []LimitLayer{
+		{Name: "global", Key: "{r:global}", MaxTokens: 1, RefillRate: 0.001},
+		{Name: "ip", Key: "{r:ip:1.2.3.4}", MaxTokens: 10, RefillRate: 0.001},
+		{Name: "user", Key: "{r:user:U1}", MaxTokens: 10, RefillRate: 0.001},
+	}
+}
+
+func TestAllowLayersGlobalRejectChargesNothing(t *testing.T) {
+	for _, split := range []bool{false, true} {
+		mr, h := newTestHybridLimiter(t)
+		h.SplitSlots = split
+		ctx := context.Background()
+
+		res, err := h.AllowLayers(ctx, precheckLayers())
+		if err != nil || !res.Allowed {
+			t.Fatalf("split=%v first = %+v, %v", split, res, err)
+		}
+
+		calls := countCalls(h)
+		res, err = h.AllowLayers(ctx, precheckLayers())
+		if err != nil || res.Allowed || res.Layer != "global" {
+			t.Fatalf("split=%v second = %+v, %v", split, res, err)
+		}
+		if calls.n != 1 {
+			t.Fatalf("split=%v global reject took %d calls, want 1", split, calls.n)
+		}
+		// user & IP were charged by the first request only
+		for _, key := range []string{"tb:{r:ip:1.2.3.4}", "tb:{r:user:U1}"} {
+			if tokens := mr.HGet(key, "tokens"); tokens != "9" {
+				t.Fatalf("split=%v %s tokens = %s, want 9", split, key, tokens)
+			}
+		}
+	}
+}
+
+func TestAllowLayersOneCall(t *testing.T) {
+	mr, h := newTestHybridLimiter(t)
+	ctx := context.Background()
+	layers := precheckLayers()
+	layers[0].MaxTokens = 10
+	layers[2].MaxTokens = 1
+
+	calls := countCalls(h)
+	if res, err := h.AllowLayers(ctx, layers); err != nil || !res.Allowed {
+		t.Fatalf("first = %+v, %v", res, err)
+	}
+	if calls.n != 1 {
+		t.Fatalf("3 layers took %d calls, want 1", calls.n)
+	}
+
+	// all-or-nothing: the user reject doesn't charge global & IP
+	res, err := h.AllowLayers(ctx, layers)
+	if err != nil || res.Allowed || res.Layer != "user" {
+		t.Fatalf("second = %+v, %v", res, err)
+	}
+	for _, key := range []string{"tb:{r:global}", "tb:{r:ip:1.2.3.4}"} {
+		if tokens := mr.HGet(key, "tokens"); tokens != "9" {
+			t.Fatalf("%s tokens = %s, want 9", key, tokens)
+		}
+	}
+}
+
+func TestAllowLayersSplitSlots(t *testing.T) {
+	_, h := newTestHybridLimiter(t)
+	h.SplitSlots = true
+	ctx := context.Background()
+
+	calls := countCalls(h)
+	if res, err := h.AllowLayers(ctx, precheckLayers()); err != nil || !res.Allowed {
+		t.Fatalf("allow = %+v, %v", res, err)
+	}
+	if calls.n != 3 {
+		t.Fatalf("3 slots took %d calls, want 3", calls.n)
+	}
+}
+
+func TestAllowLayersReportsTightest(t *testing.T) {
+	_, h := newTestHybridLimiter(t)
+	ctx := context.Background()
+
+	layers := []LimitLayer{
+		{Name: "user", Key: "{r:user:U1}", MaxTokens: 10, RefillRate: 0.001},
+		{Name: "ip", Key: "{r:ip:1.2.3.4}", MaxTokens: 3, RefillRate: 0.001},
+		{Name: "global", Key: "{r:global}", MaxTokens: 100, RefillRate: 0.001},
+	}
+	res, err := h.AllowLayers(ctx, layers)
+	if err != nil || !res.Allowed {
+		t.Fatalf("allow = %+v, %v", res, err)
+	}
+	if res.Layer != "ip" || res.Remaining != 2 {
+		t.Fatalf("tightest = %s remaining %d, want ip remaining 2", res.Layer, res.Remaining)
+	}
+}
+
+// window edge: limit 5 per 10s, 1 request at 0s & 4 at 9.5s, then a burst right after the edge at 10s
+// fixed resets with the counter's TTL, the sliding ones still see the requests of the last 10s
+func TestWindowEdge(t *testing.T) {
+	tests := []struct {
+		algo      WindowAlgorithm
+		wantBurst int // allowed of 10 requests at 10s
+	}{
+		// counter expires 10s after the first request: 9 requests pass within 0.5s
+		{WindowFixed, 5},
+		// previous window counts fully at the start of the new one: 5 * 1.0
+		{WindowSlidingCounter, 0},
+		// the 0s request left the window, the four at 9.5s are still in it
+		{WindowSlidingLog, 1},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.algo), func(t *testing.T) {
+			mr, h := newTestHybridLimiter(t)
+			ctx := context.Background()
+
+			// aligned to the 10s windows of sliding_counter
+			now := time.Unix(1_700_000_000, 0)
+			h.Now = func() time.Time { return now }
+			advance := func(d time.Duration) {
+				now = now.Add(d)
+				mr.FastForward(d)
+			}
+
+			// token bucket out of the way, only the window limits
+			layer := LimitLayer{
+				Name:             "user",
+				Key:              "{r:user:U1}",
+				MaxTokens:        1000,
+				RefillRate:       1000,
+				SlidingLimit:     5,
+				SlidingWindowSec: 10,
+				WindowAlgorithm:  tt.algo,
+			}
+			allowed := func(n int) int {
+				ok := 0
+				for i := 0; i < n; i++ {
+					res, err := h.AllowLayers(ctx, []LimitLayer{layer})
+					if err != nil {
+						t.Fatalf("allow: %v", err)
+					}
+					if res.Allowed {
+						ok++
+					}
+				}
+				return ok
+			}
+
+			if got := allowed(1); got != 1 {
+				t.Fatalf("at 0s allowed %d of 1", got)
+			}
+			advance(9500 * time.Millisecond)
+			if got := allowed(4); got != 4 {
+				t.Fatalf("at 9.5s allowed %d of 4", got)
+			}
+			if got := allowed(1); got != 0 {
+				t.Fatal("at 9.5s the 6th request passed")
+			}
+
+			advance(500 * time.Millisecond)
+			if got := allowed(10); got != tt.wantBurst {
+				t.Fatalf("at 10s allowed %d of 10, want %d", got, tt.wantBurst)
+			}
+		})
+	}
+}
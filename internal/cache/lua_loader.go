@@ -11,12 +11,15 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
+// LuaScripts: precheck & finalize scripts, loaded into & run on rdb
 type LuaScripts struct {
 	PrecheckSHA *LuaScript
 	FinalizeSHA *LuaScript
+
+	rdb redis.UniversalClient
 }
 
-func LoadLuaScripts(rdb *redis.Client, scriptDir string) (*LuaScripts, error) {
+func LoadLuaScripts(rdb redis.UniversalClient, scriptDir string) (*LuaScripts, error) {
 	ctx := context.Background()
 
 	precheckPath := filepath.Join(scriptDir, "redis_precheck.lua")
@@ -24,12 +27,12 @@ func LoadLuaScripts(rdb *redis.Client, scriptDir string) (*LuaScripts, error) {
 
 	precheck, err := loadAndRegister(ctx, rdb, precheckPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load precheck lua: %w", &err)
+		return nil, fmt.Errorf("failed to load precheck lua: %w", err)
 	}
 
 	finalize, err := loadAndRegister(ctx, rdb, finalizePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load finalize lua: %w", &err)
+		return nil, fmt.Errorf("failed to load finalize lua: %w", err)
 	}
 
 	precheckScript := NewLuaScript(precheck)
@@ -38,11 +41,12 @@ func LoadLuaScripts(rdb *redis.Client, scriptDir string) (*LuaScripts, error) {
 	return &LuaScripts{
 		PrecheckSHA: precheckScript,
 		FinalizeSHA: finalizeScript,
+		rdb:         rdb,
 	}, nil
 
 }
 
-func loadAndRegister(ctx context.Context, rdb *redis.Client, path string) (string, error) {
+func loadAndRegister(ctx context.Context, rdb redis.UniversalClient, path string) (string, error) {
 
 	// 1. read file
 	code, err := os.ReadFile(path)
@@ -15,7 +15,7 @@ func NewLuaScript(script string) *LuaScript {
 	return &LuaScript{Script: script, SHA: script}
 }
 
-func (l *LuaScript) Run(ctx context.Context, rdb *redis.Client, keys []string, args ...any) *redis.Cmd {
+func (l *LuaScript) Run(ctx context.Context, rdb redis.UniversalClient, keys []string, args ...any) *redis.Cmd {
 
 	cmd := rdb.EvalSha(ctx, l.SHA, keys, args...)
 	if err := cmd.Err(); err != nil && err.Error() == "NOSCRIPT No matching script. Please use EVAL." {
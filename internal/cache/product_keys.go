@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+)
+
+// keys of a product with a single stock counter are hash tagged {product_id}, one Redis Cluster slot,
+// so the precheck script checks stock & claims the user's slot in one call
+// bucketed products spread over N slots: bucket i is tagged {product_id:i}, and the claim / purchased
+// keys are split by user into the same N tags, every script call touches a single slot
+
+// StockBucketsKey: hash product_id -> bucket count, written by warm-up for bucketed products
+const StockBucketsKey = "flashsale:stock:buckets"
+
+// StockKey is the single stock counter of a product
+func StockKey(productID string) string {
+	return fmt.Sprintf("flashsale:stock:{%s}", productID)
+}
+
+// PurchasedKey: set of users who bought the product, the user's partition when bucketed
+func PurchasedKey(productID, userID string, buckets int) string {
+	return "flashsale:purchased:" + userTag(productID, userID, buckets)
+}
+
+// ClaimKey: order_id owning the user's slot of the product, one key per user so each claim expires on its own
+// tagged like the user's purchased set
+func ClaimKey(productID, userID string, buckets int) string {
+	return "flashsale:claim:" + userTag(productID, userID, buckets) + ":" + userID
+}
+
+// userTag is {product_id}, or {product_id:n} with n picked by user_id when bucketed
+func userTag(productID, userID string, buckets int) string {
+	if buckets <= 1 {
+		return "{" + productID + "}"
+	}
+	h := fnv.New32a()
+	h.Write([]byte(userID))
+	return fmt.Sprintf("{%s:%d}", productID, h.Sum32()%uint32(buckets))
+}
+
+// StockKeys returns the counters of a product: the single key, or one key per bucket
+func StockKeys(productID string, buckets int) []string {
+	if buckets <= 1 {
+		return []string{StockKey(productID)}
+	}
+	keys := make([]string, buckets)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("flashsale:stock:{%s:%d}", productID, i)
+	}
+	return keys
+}
+
+// PickStockKeys starts at a random bucket, the others follow as fallbacks
+func PickStockKeys(productID string, buckets int) []string {
+	keys := StockKeys(productID, buckets)
+	start := rand.IntN(len(keys))
+	return append(keys[start:], keys[:start]...)
+}
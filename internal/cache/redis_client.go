@@ -7,23 +7,51 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
-var Rdb *redis.Client
-var Ctx = context.Background()
+// RedisConfig: Mode is standalone, sentinel or cluster
+type RedisConfig struct {
+	Mode       string
+	Addrs      []string // sentinel: sentinel addrs, cluster: seed nodes
+	MasterName string   // sentinel only
+	Password   string
+	DB         int // not in cluster mode
+	PoolSize   int // per node
+}
 
-func InitRedis(host, port, password string, db int) error {
-	addr := fmt.Sprintf("%s:%s", host, port)
+func NewRedisClient(cfg RedisConfig) (redis.UniversalClient, error) {
+	opts := &redis.UniversalOptions{
+		Addrs:      cfg.Addrs,
+		MasterName: cfg.MasterName,
+		Password:   cfg.Password,
+		DB:         cfg.DB,
+		PoolSize:   cfg.PoolSize,
+	}
+	switch cfg.Mode {
+	case "", "standalone":
+		return redis.NewClient(opts.Simple()), nil
+	case "sentinel":
+		if cfg.MasterName == "" {
+			return nil, fmt.Errorf("redis sentinel mode needs a master name")
+		}
+		return redis.NewFailoverClient(opts.Failover()), nil
+	case "cluster":
+		return redis.NewClusterClient(opts.Cluster()), nil
+	default:
+		return nil, fmt.Errorf("unknown redis mode %q", cfg.Mode)
+	}
+}
 
-	Rdb = redis.NewClient(&redis.Options{
-		Addr:     addr,
-		Password: password,
-		DB:       db,
-		PoolSize: 20,
-	})
+// ConnectRedis builds the client & pings it
+func ConnectRedis(ctx context.Context, cfg RedisConfig) (redis.UniversalClient, error) {
+	rdb, err := NewRedisClient(cfg)
+	if err != nil {
+		return nil, err
+	}
 
-	_, err := Rdb.Ping(Ctx).Result()
+	_, err = rdb.Ping(ctx).Result()
 	if err != nil {
-		return fmt.Errorf("redis ping failed: %w", err)
+		rdb.Close()
+		return nil, fmt.Errorf("redis ping failed: %w", err)
 	}
 
-	return nil
+	return rdb, nil
 }
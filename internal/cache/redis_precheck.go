@@ -4,39 +4,47 @@ import (
 	"context"
 	"errors"
 	"fmt"
-)
+	"time"
 
-var LuaSHAScripts *LuaScripts // store loaded script SHA globally
+	"github.com/redis/go-redis/v9"
+)
 
 type PreCheckResult struct {
 	Success bool
 	Reason  string
 }
 
-// Called by main.go after loading scripts
-func SetLuaScripts(s *LuaScripts) {
-	LuaSHAScripts = s
-}
-
-func FlashSalePreCheck(productID, userID string) (*PreCheckResult, error) {
-	if Rdb == nil {
-		return nil, errors.New("redis not init")
-	}
-	if LuaSHAScripts == nil || LuaSHAScripts.PrecheckSHA.SHA == "" {
+// FlashSalePreCheck claims the user's slot of productID for orderID on success
+// buckets > 1: stock is split in sub-counters in their own slots, one random bucket is read
+// & the next ones only while empty, then the script claims in the user's partition
+// claimTTL bounds the claim, per user sale limits are reserved separately (UserQuotaRepository.Reserve)
+func (s *LuaScripts) FlashSalePreCheck(ctx context.Context, productID, userID, orderID string, claimTTL time.Duration, buckets int) (*PreCheckResult, error) {
+	if s == nil || s.PrecheckSHA.SHA == "" {
 		return nil, errors.New("lua scripts not loaded")
 	}
 
-	stockKey := fmt.Sprintf("flashsale:stock:%s", productID)
 	// store purchasers set per product
-	userSetKey := fmt.Sprintf("flashsale:purchased:%s", productID)
+	userSetKey := PurchasedKey(productID, userID, buckets)
+	// order owning the user's slot of the product, per user key
+	claimKey := ClaimKey(productID, userID, buckets)
+
+	keys := []string{userSetKey, claimKey}
+	if buckets <= 1 {
+		// same slot, the script checks the stock itself
+		keys = append(keys, StockKey(productID))
+	} else if reason, err := s.checkBuckets(ctx, productID, buckets); err != nil || reason != "" {
+		if err != nil {
+			return nil, err
+		}
+		return &PreCheckResult{Reason: reason}, nil
+	}
 
 	// Use SHA instead of raw Lua file
-	// EvalSha : KEYS=[stockKey, userSetKey], ARGV=[userID(,ttlSeconds)]
-	ctx := context.Background()
-	res, err := Rdb.EvalSha(ctx,
-		LuaSHAScripts.PrecheckSHA.SHA,
-		[]string{stockKey, userSetKey},
-		userID,
+	// EvalSha : KEYS=[userSetKey, claimKey, stockKey?], ARGV=[userID, orderID, ttl]
+	res, err := s.rdb.EvalSha(ctx,
+		s.PrecheckSHA.SHA,
+		keys,
+		userID, orderID, int64(claimTTL/time.Second),
 	).Result()
 	if err != nil {
 		return nil, err
@@ -58,3 +66,36 @@ func FlashSalePreCheck(productID, userID string) (*PreCheckResult, error) {
 		Reason:  reason,
 	}, nil
 }
+
+// checkBuckets reads one random bucket, falling back to the next one while empty
+// returns "" if a bucket has stock, else the precheck reject reason
+func (s *LuaScripts) checkBuckets(ctx context.Context, productID string, buckets int) (string, error) {
+	found := false
+	for _, key := range PickStockKeys(productID, buckets) {
+		stock, err := s.rdb.Get(ctx, key).Int64()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if stock > 0 {
+			return "", nil
+		}
+		found = true
+	}
+	if !found {
+		return "STOCK_NOT_FOUND", nil
+	}
+	return "OUT_OF_STOCK", nil
+}
+
+// Finalize: true if orderID owns the user's claim of productID, the user is then added to the purchased set
+func (s *LuaScripts) Finalize(ctx context.Context, productID, userID, orderID string, buckets int) (bool, error) {
+	if s == nil || s.FinalizeSHA.SHA == "" {
+		return false, errors.New("lua scripts not loaded")
+	}
+	// KEYS=[claimKey, userSetKey], ARGV=[userID, orderID]
+	keys := []string{ClaimKey(productID, userID, buckets), PurchasedKey(productID, userID, buckets)}
+	return s.FinalizeSHA.Run(ctx, s.rdb, keys, userID, orderID).Bool()
+}
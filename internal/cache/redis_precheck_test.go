@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestScripts(t *testing.T) (*miniredis.Miniredis, *LuaScripts) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	scripts, err := LoadLuaScripts(rdb, "../../scripts")
+	if err != nil {
+		t.Fatalf("load scripts: %v", err)
+	}
+	return mr, scripts
+}
+
+func TestPreCheckSingleKey(t *testing.T) {
+	mr, s := newTestScripts(t)
+	ctx := context.Background()
+
+	res, err := s.FlashSalePreCheck(ctx, "1", "U1", "o1", time.Minute, 0)
+	if err != nil || res.Reason != "STOCK_NOT_FOUND" {
+		t.Fatalf("missing stock = %+v, %v", res, err)
+	}
+
+	mr.Set(StockKey("1"), "1")
+	res, err = s.FlashSalePreCheck(ctx, "1", "U1", "o1", time.Minute, 0)
+	if err != nil || !res.Success {
+		t.Fatalf("first precheck = %+v, %v", res, err)
+	}
+	res, err = s.FlashSalePreCheck(ctx, "1", "U1", "o2", time.Minute, 0)
+	if err != nil || res.Reason != "USER_ALREADY_PURCHASED" {
+		t.Fatalf("second precheck = %+v, %v", res, err)
+	}
+	if owner, _ := mr.Get(ClaimKey("1", "U1", 0)); owner != "o1" {
+		t.Fatalf("claim owner = %q", owner)
+	}
+}
+
+func TestClaimsExpireOnTheirOwn(t *testing.T) {
+	mr, s := newTestScripts(t)
+	ctx := context.Background()
+	mr.Set(StockKey("1"), "10")
+
+	if res, err := s.FlashSalePreCheck(ctx, "1", "U1", "o1", 10*time.Second, 0); err != nil || !res.Success {
+		t.Fatalf("precheck U1 = %+v, %v", res, err)
+	}
+	mr.FastForward(6 * time.Second)
+	// a later claim of the product doesn't extend U1's
+	if res, err := s.FlashSalePreCheck(ctx, "1", "U2", "o2", 10*time.Second, 0); err != nil || !res.Success {
+		t.Fatalf("precheck U2 = %+v, %v", res, err)
+	}
+	mr.FastForward(5 * time.Second)
+	if mr.Exists(ClaimKey("1", "U1", 0)) {
+		t.Fatal("U1's claim outlived its ttl")
+	}
+	if owner, _ := mr.Get(ClaimKey("1", "U2", 0)); owner != "o2" {
+		t.Fatalf("U2's claim = %q", owner)
+	}
+	// U1 may try again
+	if res, err := s.FlashSalePreCheck(ctx, "1", "U1", "o3", 10*time.Second, 0); err != nil || !res.Success {
+		t.Fatalf("precheck U1 after expiry = %+v, %v", res, err)
+	}
+}
+
+func TestPreCheckBuckets(t *testing.T) {
+	mr, s := newTestScripts(t)
+	ctx := context.Background()
+	keys := StockKeys("1", 3)
+
+	res, err := s.FlashSalePreCheck(ctx, "1", "U1", "o1", time.Minute, 3)
+	if err != nil || res.Reason != "STOCK_NOT_FOUND" {
+		t.Fatalf("missing buckets = %+v, %v", res, err)
+	}
+
+	// only the last bucket has stock, every random start must fall back to it
+	mr.Set(keys[0], "0")
+	mr.Set(keys[1], "0")
+	mr.Set(keys[2], "1")
+	for i, user := range []string{"U1", "U2", "U3", "U4", "U5", "U6"} {
+		res, err := s.FlashSalePreCheck(ctx, "1", user, "o"+user, time.Minute, 3)
+		if err != nil || !res.Success {
+			t.Fatalf("precheck %d = %+v, %v", i, res, err)
+		}
+		if owner, _ := mr.Get(ClaimKey("1", user, 3)); owner != "o"+user {
+			t.Fatalf("claim of %s = %q", user, owner)
+		}
+	}
+
+	ok, err := s.Finalize(ctx, "1", "U1", "oU1", 3)
+	if err != nil || !ok {
+		t.Fatalf("finalize = %v, %v", ok, err)
+	}
+	if ok, _ := mr.SIsMember(PurchasedKey("1", "U1", 3), "U1"); !ok {
+		t.Fatal("finalized user not in its purchased partition")
+	}
+
+	mr.Set(keys[2], "0")
+	res, err = s.FlashSalePreCheck(ctx, "1", "U9", "o9", time.Minute, 3)
+	if err != nil || res.Reason != "OUT_OF_STOCK" {
+		t.Fatalf("empty buckets = %+v, %v", res, err)
+	}
+}
+
+func TestBucketKeysHaveOwnSlots(t *testing.T) {
+	keys := StockKeys("42", 4)
+	seen := map[string]bool{}
+	for _, k := range keys {
+		tag := k[len("flashsale:stock:"):]
+		if seen[tag] {
+			t.Fatalf("bucket tag %s used twice", tag)
+		}
+		seen[tag] = true
+	}
+	// the user's claim & purchased partition shares a bucket's tag
+	claim := ClaimKey("42", "U1", 4)
+	tag := strings.TrimSuffix(claim[len("flashsale:claim:"):], ":U1")
+	if !seen[tag] {
+		t.Fatalf("claim tag %s is not a bucket tag", tag)
+	}
+	if PurchasedKey("42", "U1", 4) != "flashsale:purchased:"+tag {
+		t.Fatal("claim & purchased keys of a user are in different slots")
+	}
+}
@@ -6,13 +6,16 @@ import (
 	"os"
 	"strconv"
 	"time"
+
+	"github.com/redis/go-redis/v9"
 )
 
 type TokenBucketLimiter struct {
+	Rdb redis.UniversalClient
 	SHA string
 }
 
-func LoadTokenBucketLua(path string) (*TokenBucketLimiter, error) {
+func LoadTokenBucketLua(rdb redis.UniversalClient, path string) (*TokenBucketLimiter, error) {
 	// Read lua file
 	bucketScript, err := os.ReadFile(path)
 	// error load
@@ -20,11 +23,12 @@ func LoadTokenBucketLua(path string) (*TokenBucketLimiter, error) {
 		return nil, fmt.Errorf("error read token bucket lua: %w", err)
 	}
 
-	sha, err := Rdb.ScriptLoad(context.Background(), string(bucketScript)).Result()
+	sha, err := rdb.ScriptLoad(context.Background(), string(bucketScript)).Result()
 	if err != nil {
 		return nil, fmt.Errorf("error load token bucket lua to redis: %w", err)
 	}
 	return &TokenBucketLimiter{
+		Rdb: rdb,
 		SHA: sha,
 	}, nil
 }
@@ -40,7 +44,7 @@ func LoadTokenBucketLua(path string) (*TokenBucketLimiter, error) {
 func (tbl *TokenBucketLimiter) Allow(keyPrefix string, maxTokens, refillRate float64) (allowed bool, remaining float64, err error) {
 	now := time.Now().UnixNano() / 1e9 // current time in secons
 
-	res, err := Rdb.EvalSha(
+	res, err := tbl.Rdb.EvalSha(
 		context.Background(),
 		tbl.SHA,
 		[]string{keyPrefix},
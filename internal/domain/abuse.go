@@ -0,0 +1,26 @@
+package domain
+
+import "time"
+
+// BlockKind: what a blocklist entry matches
+type BlockKind string
+
+const (
+	BlockIP   BlockKind = "ip"
+	BlockUser BlockKind = "user"
+)
+
+func (k BlockKind) Valid() bool {
+	return k == BlockIP || k == BlockUser
+}
+
+// BlockEntry is one blocked IP / user, removed by Redis TTL when ExpiresAt passes
+type BlockEntry struct {
+	Kind      BlockKind
+	Value     string // IP or user id
+	Reason    string
+	Score     int    // abuse score that caused an automatic block, 0 for manual
+	Source    string // "auto" or the admin who added it
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
@@ -0,0 +1,15 @@
+package domain
+
+import "time"
+
+// AdminAuditEntry records one admin API call, including rejected ones
+type AdminAuditEntry struct {
+	ID         int64
+	Actor      string // token subject, unauthenticated requests get no entry
+	Role       string
+	Action     string // route, e.g. "POST /admin/flashsales/:id/warmup"
+	Target     string // route params, e.g. "id=3"
+	StatusCode int
+	ClientIP   string
+	CreatedAt  time.Time
+}
@@ -0,0 +1,27 @@
+package domain
+
+// CatalogSale is an active or upcoming sale with its products, as cached by warm-up
+type CatalogSale struct {
+	Sale     FlashSale
+	Products []FlashSaleProduct
+}
+
+// StockBand hides the exact stock from clients
+type StockBand string
+
+const (
+	StockPlenty  StockBand = "plenty"
+	StockFewLeft StockBand = "few_left"
+	StockSoldOut StockBand = "sold_out"
+)
+
+// BandOf: few left is 10% of the sale stock, at least 5 items
+func BandOf(stock, saleStock int64) StockBand {
+	if stock <= 0 {
+		return StockSoldOut
+	}
+	if stock <= max(5, saleStock/10) {
+		return StockFewLeft
+	}
+	return StockPlenty
+}
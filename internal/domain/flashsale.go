@@ -11,13 +11,45 @@ const (
 )
 
 type FlashSale struct {
-	ID        int64
-	Name      string
-	StartAt   time.Time
-	EndAt     time.Time
-	Status    FlashSaleStatus
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID      int64
+	Name    string
+	StartAt time.Time
+	EndAt   time.Time
+	Status  FlashSaleStatus
+	// per user limits across the products of the sale, 0 = unlimited
+	MaxItemsPerUser    int64
+	MaxProductsPerUser int64
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+}
+
+// precheck / worker reject reason when a user limit is reached
+const ReasonUserLimitExceeded = "USER_LIMIT_EXCEEDED"
+
+// UserSaleUsage is what a user already bought in a sale
+type UserSaleUsage struct {
+	Items       int64 // successful orders
+	Products    int64 // distinct products of them
+	ThisProduct int64 // successful orders of the product being bought
+}
+
+func (fs *FlashSale) HasUserLimits() bool {
+	return fs.MaxItemsPerUser > 0 || fs.MaxProductsPerUser > 0
+}
+
+// AllowsPurchase: can the user buy one more item on top of usage
+func (fs *FlashSale) AllowsPurchase(u UserSaleUsage) bool {
+	if fs.MaxItemsPerUser > 0 && u.Items+1 > fs.MaxItemsPerUser {
+		return false
+	}
+	products := u.Products
+	if u.ThisProduct == 0 {
+		products++
+	}
+	if fs.MaxProductsPerUser > 0 && products > fs.MaxProductsPerUser {
+		return false
+	}
+	return true
 }
 
 // IsInWindow strictly checks the clock
@@ -6,4 +6,12 @@ type FlashSaleProduct struct {
 	ProductID   int64
 	SaleStock   int
 	SalePrice   int
+	// Redis stock sub-counters, set by warm-up (not a DB column), 0/1 = single key
+	StockBuckets int
+}
+
+// ProductStock is the remaining sale stock of a product
+type ProductStock struct {
+	ProductID int64 `json:"product_id"`
+	Stock     int64 `json:"stock"`
 }
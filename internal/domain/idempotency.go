@@ -0,0 +1,19 @@
+package domain
+
+import "time"
+
+type IdempotencyState string
+
+const (
+	IdempotencyPending IdempotencyState = "pending" // first request still running
+	IdempotencyDone    IdempotencyState = "done"
+)
+
+// IdempotencyRecord is the stored outcome of the first request with a key
+type IdempotencyRecord struct {
+	State       IdempotencyState `json:"state"`
+	Fingerprint string           `json:"fingerprint"` // request params, a key can't be reused for another request
+	StatusCode  int              `json:"status_code,omitempty"`
+	Response    []byte           `json:"response,omitempty"`
+	CreatedAt   time.Time        `json:"created_at"`
+}
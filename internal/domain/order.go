@@ -1,6 +1,12 @@
 package domain
 
-import "time"
+import (
+	"errors"
+	"time"
+)
+
+// ErrDuplicateOrder: the user already has a non-failed order of the product in the sale
+var ErrDuplicateOrder = errors.New("duplicate order")
 
 type OrderStatus string
 
@@ -10,6 +16,11 @@ const (
 	OrderFailed  OrderStatus = "failed"
 )
 
+// IsFinal reports whether the order will not change status anymore
+func (s OrderStatus) IsFinal() bool {
+	return s == OrderSuccess || s == OrderFailed
+}
+
 type Order struct {
 	ID          int64      `db:"id"`
 	OrderNo     string     `db:"order_no"` // Added
@@ -18,7 +29,36 @@ type Order struct {
 	FlashSaleID int64      `db:"flash_sale_id"`
 	Price       int        `db:"price"`
 	Status      string     `db:"status"`
+	FailReason  *string    `db:"fail_reason"`
 	CreatedAt   time.Time  `db:"created_at"`
 	PaidAt      *time.Time `db:"paid_at"`     // Use pointer for nullable columns
 	CanceledAt  *time.Time `db:"canceled_at"` // Use pointer for nullable columns
 }
+
+// OrderStatusCacheTTL keeps cached status long enough for clients to poll after the sale
+const OrderStatusCacheTTL = 2 * time.Hour
+
+// OrderStatusSnapshot is the order state cached in Redis for result polling
+type OrderStatusSnapshot struct {
+	OrderNo   string
+	UserID    string // owner, checked on result lookups
+	Status    OrderStatus
+	Reason    string
+	CreatedAt time.Time // zero value keeps the cached one
+	UpdatedAt time.Time
+}
+
+// OrderCursor is the keyset position (created_at, id) of the last order in a page
+type OrderCursor struct {
+	CreatedAt time.Time
+	ID        int64
+}
+
+// OrderListQuery filters a user's orders, zero values mean no filter
+type OrderListQuery struct {
+	UserID      string
+	FlashSaleID int64
+	Status      OrderStatus
+	After       *OrderCursor
+	Limit       int
+}
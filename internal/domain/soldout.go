@@ -0,0 +1,11 @@
+package domain
+
+import "time"
+
+// SoldOutEvent is broadcast when a product of a sale sells out, or gets stock back
+type SoldOutEvent struct {
+	FlashSaleID int64     `json:"flash_sale_id"`
+	ProductID   string    `json:"product_id"`
+	SoldOut     bool      `json:"sold_out"`
+	At          time.Time `json:"at"`
+}
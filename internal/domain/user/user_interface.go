@@ -1,5 +1,5 @@
 package user
 
 type UserInterface interface {
-	GetUserByID(userID int64) (*User, error)
+	GetUserByID(userID string) (*User, error)
 }
@@ -0,0 +1,26 @@
+package domain
+
+import "time"
+
+// QueueTicket is a waiting room place for one user & product
+// Admitted once the room's admitted counter reached Position
+type QueueTicket struct {
+	ID        string
+	UserID    string
+	ProductID string
+	Position  int64 // 1-based arrival order in the room
+	Admitted  int64 // room admitted counter when read
+	IssuedAt  time.Time
+}
+
+func (t *QueueTicket) IsAdmitted() bool {
+	return t.Position <= t.Admitted
+}
+
+// Ahead is the number of tickets admitted before this one
+func (t *QueueTicket) Ahead() int64 {
+	if t.IsAdmitted() {
+		return 0
+	}
+	return t.Position - t.Admitted - 1
+}
@@ -0,0 +1,23 @@
+package dto
+
+import "time"
+
+type CatalogProduct struct {
+	ProductID int64  `json:"product_id"`
+	SalePrice int    `json:"sale_price"`
+	Stock     string `json:"stock"` // plenty / few_left / sold_out
+}
+
+type CatalogSale struct {
+	ID       int64            `json:"id"`
+	Name     string           `json:"name"`
+	State    string           `json:"state"` // active / upcoming
+	StartAt  time.Time        `json:"start_at"`
+	EndAt    time.Time        `json:"end_at"`
+	Products []CatalogProduct `json:"products"`
+}
+
+type Catalog struct {
+	ServerTime time.Time     `json:"server_time"` // for countdowns, client clocks drift
+	Sales      []CatalogSale `json:"sales"`
+}
@@ -0,0 +1,20 @@
+package dto
+
+import "time"
+
+type OrderListItem struct {
+	OrderID     string     `json:"order_id"`
+	ProductID   int64      `json:"product_id"`
+	FlashSaleID int64      `json:"flash_sale_id"`
+	Price       int        `json:"price"`
+	Status      string     `json:"status"`
+	FailReason  *string    `json:"fail_reason,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	PaidAt      *time.Time `json:"paid_at,omitempty"`
+	CanceledAt  *time.Time `json:"canceled_at,omitempty"`
+}
+
+type OrderListPage struct {
+	Orders     []OrderListItem `json:"orders"`
+	NextCursor string          `json:"next_cursor,omitempty"` // empty when no more pages
+}
@@ -4,5 +4,12 @@ type OrderMessage struct {
 	OrderID   string `json:"order_id"`
 	UserID    string `json:"user_id"`
 	ProductID string `json:"product_id"`
-	Timestamp int64  `json:"timestamp"`
+	// 0 in messages published before per user limits, worker skips the limit check then
+	FlashSaleID int64 `json:"flash_sale_id,omitempty"`
+	// async create mode: the worker inserts the order row, the API only wrote the Redis marker
+	CreateOrder bool `json:"create_order,omitempty"`
+	Price       int  `json:"price,omitempty"`
+	// Redis stock sub-counters of the product, 0 = single key
+	StockBuckets int   `json:"stock_buckets,omitempty"`
+	Timestamp    int64 `json:"timestamp"`
 }
@@ -4,4 +4,10 @@ type QueueOrderReq struct {
 	OrderNo   string `json:"order_no"`
 	UserID    string `json:"user_id"`
 	ProductID int64  `json:"product_id"`
+	// set for async created orders, the compensator may have to insert the failed row
+	CreateOrder bool  `json:"create_order,omitempty"`
+	FlashSaleID int64 `json:"flash_sale_id,omitempty"`
+	Price       int   `json:"price,omitempty"`
+	// Redis stock sub-counters, the claim key of bucketed products depends on it
+	StockBuckets int `json:"stock_buckets,omitempty"`
 }
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"flashsale/internal/abuse"
+	"flashsale/internal/domain"
+	"flashsale/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AbuseHandler struct {
+	svc *abuse.Service
+}
+
+func NewAbuseHandler(svc *abuse.Service) *AbuseHandler {
+	return &AbuseHandler{svc: svc}
+}
+
+type blockRequest struct {
+	Kind   string `json:"kind"`  // "ip" / "user"
+	Value  string `json:"value"` // IP or user id
+	Reason string `json:"reason"`
+	TTLSec int64  `json:"ttl_sec"`
+}
+
+// GET /admin/abuse/blocks
+func (h *AbuseHandler) ListBlocks(c *gin.Context) {
+	entries, err := h.svc.List(c.Request.Context())
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	items := make([]gin.H, 0, len(entries))
+	for _, e := range entries {
+		items = append(items, blockJSON(e))
+	}
+	c.JSON(http.StatusOK, gin.H{"blocks": items})
+}
+
+// POST /admin/abuse/blocks {"kind":"ip","value":"1.2.3.4","reason":"...","ttl_sec":3600}
+func (h *AbuseHandler) Block(c *gin.Context) {
+	var req blockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(codeInvalidRequest, "invalid body"))
+		return
+	}
+	actor := ""
+	if claims := middleware.Claims(c); claims != nil {
+		actor = claims.Subject
+	}
+
+	entry, err := h.svc.Block(c.Request.Context(), domain.BlockKind(req.Kind), req.Value, req.Reason, actor, time.Duration(req.TTLSec)*time.Second)
+	if errors.Is(err, abuse.ErrInvalidBlock) {
+		c.JSON(http.StatusBadRequest, errorBody(codeInvalidRequest, "kind must be ip or user, value and positive ttl_sec required"))
+		return
+	}
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, blockJSON(*entry))
+}
+
+// DELETE /admin/abuse/blocks/:kind/:value
+func (h *AbuseHandler) Unblock(c *gin.Context) {
+	err := h.svc.Unblock(c.Request.Context(), domain.BlockKind(c.Param("kind")), c.Param("value"))
+	if errors.Is(err, abuse.ErrInvalidBlock) {
+		c.JSON(http.StatusBadRequest, errorBody(codeInvalidRequest, "kind must be ip or user"))
+		return
+	}
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func blockJSON(e domain.BlockEntry) gin.H {
+	return gin.H{
+		"kind":       e.Kind,
+		"value":      e.Value,
+		"reason":     e.Reason,
+		"score":      e.Score,
+		"source":     e.Source,
+		"created_at": e.CreatedAt,
+		"expires_at": e.ExpiresAt,
+	}
+}
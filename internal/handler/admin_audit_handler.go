@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"flashsale/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdminAuditHandler struct {
+	svc *service.AdminAuditService
+}
+
+func NewAdminAuditHandler(svc *service.AdminAuditService) *AdminAuditHandler {
+	return &AdminAuditHandler{svc: svc}
+}
+
+// GET /admin/audit-logs?limit=<N>
+func (h *AdminAuditHandler) ListRecent(c *gin.Context) {
+	limit := 0
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, errorBody(codeInvalidRequest, "invalid limit"))
+			return
+		}
+		limit = n
+	}
+
+	entries, err := h.svc.ListRecent(c.Request.Context(), limit)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	items := make([]gin.H, 0, len(entries))
+	for _, e := range entries {
+		items = append(items, gin.H{
+			"id":          e.ID,
+			"actor":       e.Actor,
+			"role":        e.Role,
+			"action":      e.Action,
+			"target":      e.Target,
+			"status_code": e.StatusCode,
+			"client_ip":   e.ClientIP,
+			"created_at":  e.CreatedAt,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"entries": items})
+}
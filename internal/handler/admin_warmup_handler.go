@@ -23,13 +23,13 @@ func (h *WarmUpHandler) WarmUp(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid flash sale id"})
+		c.JSON(http.StatusBadRequest, errorBody(codeInvalidRequest, "invalid flash sale id"))
 		return
 	}
 
 	// 2. call servicd
 	if err := h.svc.WarmUpByID(c.Request.Context(), id); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
 
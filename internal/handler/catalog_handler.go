@@ -0,0 +1,26 @@
+package handler
+
+import (
+	"flashsale/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CatalogHandler struct {
+	svc *service.CatalogService
+}
+
+func NewCatalogHandler(svc *service.CatalogService) *CatalogHandler {
+	return &CatalogHandler{svc: svc}
+}
+
+// GET /flashsale/catalog
+func (h *CatalogHandler) GetCatalog(c *gin.Context) {
+	catalog, err := h.svc.Catalog(c.Request.Context())
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, catalog)
+}
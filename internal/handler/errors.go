@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"flashsale/internal/middleware"
+	"flashsale/internal/service"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// status of each catalog code
+var errorStatus = map[service.ErrorCode]int{
+	service.CodeSaleNotActive:        http.StatusNotFound,
+	service.CodeSaleNotStarted:       http.StatusTooEarly,
+	service.CodeSaleNotFound:         http.StatusNotFound,
+	service.CodeStockNotFound:        http.StatusNotFound,
+	service.CodeOutOfStock:           http.StatusConflict,
+	service.CodeUserAlreadyPurchased: http.StatusConflict,
+	service.CodeUserLimitExceeded:    http.StatusForbidden,
+	service.CodeServiceUnavailable:   http.StatusServiceUnavailable,
+	service.CodeInternal:             http.StatusInternalServerError,
+}
+
+// handler level codes, next to the service catalog
+const (
+	codeInvalidRequest        service.ErrorCode = "INVALID_REQUEST"
+	codeUnauthenticated                         = middleware.CodeUnauthenticated
+	codeOrderNotFound         service.ErrorCode = "ORDER_NOT_FOUND"
+	codeQueueTicketRequired   service.ErrorCode = "QUEUE_TICKET_REQUIRED"
+	codeQueueTicketInvalid    service.ErrorCode = "QUEUE_TICKET_INVALID"
+	codeQueueNotAdmitted      service.ErrorCode = "QUEUE_NOT_ADMITTED"
+	codeQueueTicketUsed       service.ErrorCode = "QUEUE_TICKET_USED"
+	codeIdempotencyKeyReused  service.ErrorCode = "IDEMPOTENCY_KEY_REUSED"
+	codeIdempotencyInProgress service.ErrorCode = "IDEMPOTENCY_IN_PROGRESS"
+)
+
+// errorBody is the envelope middlewares answer with too, see middleware.ErrorBody
+func errorBody(code service.ErrorCode, message string) gin.H {
+	return middleware.ErrorBody(code, message)
+}
+
+// errorStatusOf maps err to its catalog error & HTTP status
+func errorStatusOf(err error) (int, *service.Error) {
+	e := service.AsError(err)
+	status, ok := errorStatus[e.Code]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	return status, e
+}
+
+// writeError sends the envelope, causes of 5xx are logged, never returned
+func writeError(c *gin.Context, err error) {
+	status, e := errorStatusOf(err)
+	if status >= http.StatusInternalServerError {
+		log.Printf("[handler] %s %s failed: %v", c.Request.Method, c.FullPath(), err)
+	}
+	if status == http.StatusServiceUnavailable {
+		c.Header("Retry-After", "1")
+	}
+	c.JSON(status, errorBody(e.Code, e.Message))
+}
@@ -1,62 +1,131 @@
 package handler
 
 import (
+	"encoding/json"
+	"errors"
+	"flashsale/internal/middleware"
 	"flashsale/internal/service"
+	"flashsale/internal/waitingroom"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
 
+// max Idempotency-Key length, keys are stored in Redis
+const maxIdempotencyKeyLen = 128
+
 type OrderHandler struct {
-	svc *service.OrderService
+	svc  *service.OrderService
+	room *waitingroom.Service // nil = waiting room off
+	idem *service.IdempotencyService
 }
 
-func NewOrderHandler(svc *service.OrderService) *OrderHandler {
-	return &OrderHandler{svc: svc}
+func NewOrderHandler(svc *service.OrderService, room *waitingroom.Service, idem *service.IdempotencyService) *OrderHandler {
+	return &OrderHandler{svc: svc, room: room, idem: idem}
 }
 
-// POST /flashsale/precheck?user_id=<USER_ID>&product_id=<PRODUCT_ID>
+// POST /flashsale/precheck?product_id=<PRODUCT_ID>
+// user comes from the bearer token only
+// waiting room on: X-Queue-Ticket must be an admitted, unused ticket of user & product
+// Idempotency-Key: retries with the same key & user get the first result, no new order
 func (h *OrderHandler) PreCheck(c *gin.Context) {
 	ctx := c.Request.Context()
 
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, errorBody(codeUnauthenticated, "unauthenticated"))
+		return
+	}
+
 	// query string or JSON body
-	userID := c.Query("user_id")
 	productID := c.Query("product_id")
 
 	// try parse the body if empty query
-	if userID == "" || productID == "" {
+	if productID == "" {
 		var body struct {
-			UserID    string `json:"user_id"`
 			ProductID string `json:"product_id"`
 		}
 		if err := c.BindJSON(&body); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "missing user_id or product_id"})
+			c.JSON(http.StatusBadRequest, errorBody(codeInvalidRequest, "missing product_id"))
 			return
 		}
-		userID = body.UserID
 		productID = body.ProductID
 	}
 
-	if userID == "" || productID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id & product_id are required"})
+	if productID == "" {
+		c.JSON(http.StatusBadRequest, errorBody(codeInvalidRequest, "product_id is required"))
 		return
 	}
 
-	result, err := h.svc.PreCheckAndQueue(ctx, userID, productID)
-	if err != nil {
-		// result might be nil
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"status":  "error",
-			"message": "internal server error",
-			"error":   err.Error(),
-		})
+	idemKey := c.GetHeader("Idempotency-Key")
+	if len(idemKey) > maxIdempotencyKeyLen {
+		c.JSON(http.StatusBadRequest, errorBody(codeInvalidRequest, "Idempotency-Key too long"))
 		return
 	}
-	// only access result if no error
-	c.JSON(http.StatusOK, gin.H{
-		"status":   result.Status,
-		"message":  result.Message,
-		"order_id": result.OrderID,
-	})
 
+	if h.room != nil {
+		// the ticket is used up here, a retry with the same Idempotency-Key passes to get its replay
+		t, err := h.room.Use(ctx, c.GetHeader("X-Queue-Ticket"), userID, productID, idemKey)
+		switch {
+		case errors.Is(err, waitingroom.ErrNotAdmitted):
+			body := errorBody(codeQueueNotAdmitted, err.Error())
+			body["position"], body["ahead"] = t.Position, t.Ahead()
+			c.JSON(http.StatusTooEarly, body)
+			return
+		case errors.Is(err, waitingroom.ErrTicketRequired):
+			c.JSON(http.StatusForbidden, errorBody(codeQueueTicketRequired, err.Error()))
+			return
+		case errors.Is(err, waitingroom.ErrTicketInvalid):
+			c.JSON(http.StatusForbidden, errorBody(codeQueueTicketInvalid, err.Error()))
+			return
+		case errors.Is(err, waitingroom.ErrTicketUsed):
+			c.JSON(http.StatusForbidden, errorBody(codeQueueTicketUsed, err.Error()))
+			return
+		case err != nil:
+			writeError(c, err)
+			return
+		}
+	}
+
+	if idemKey == "" {
+		result, err := h.svc.PreCheckAndQueue(ctx, userID, productID)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, result)
+		return
+	}
+
+	// scoped by user, the same key of another user is another request
+	// business outcomes are replayed, 5xx are not stored so a retry runs again
+	status, resp, replayed, err := h.idem.Do(ctx, "precheck:"+userID+":"+idemKey, productID, func() (int, []byte, error) {
+		result, err := h.svc.PreCheckAndQueue(ctx, userID, productID)
+		if err != nil {
+			status, e := errorStatusOf(err)
+			if status >= http.StatusInternalServerError {
+				return 0, nil, err
+			}
+			b, mErr := json.Marshal(errorBody(e.Code, e.Message))
+			return status, b, mErr
+		}
+		b, err := json.Marshal(result)
+		return http.StatusOK, b, err
+	})
+	switch {
+	case errors.Is(err, service.ErrIdempotencyKeyReused):
+		c.JSON(http.StatusUnprocessableEntity, errorBody(codeIdempotencyKeyReused, err.Error()))
+		return
+	case errors.Is(err, service.ErrIdempotencyInProgress):
+		c.Header("Retry-After", "1")
+		c.JSON(http.StatusConflict, errorBody(codeIdempotencyInProgress, err.Error()))
+		return
+	case err != nil:
+		writeError(c, err)
+		return
+	}
+	if replayed {
+		c.Header("Idempotent-Replayed", "true")
+	}
+	c.Data(status, "application/json; charset=utf-8", resp)
 }
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"errors"
+	"flashsale/internal/middleware"
+	"flashsale/internal/service"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type OrderListHandler struct {
+	svc *service.OrderListService
+}
+
+func NewOrderListHandler(svc *service.OrderListService) *OrderListHandler {
+	return &OrderListHandler{svc: svc}
+}
+
+// GET /flashsale/orders?flash_sale_id=<ID>&status=<STATUS>&limit=<N>&cursor=<NEXT_CURSOR>
+func (h *OrderListHandler) ListMyOrders(c *gin.Context) {
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, errorBody(codeUnauthenticated, "unauthenticated"))
+		return
+	}
+
+	params := service.OrderListParams{
+		UserID: userID,
+		Status: c.Query("status"),
+		Cursor: c.Query("cursor"),
+	}
+	if v := c.Query("flash_sale_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, errorBody(codeInvalidRequest, "invalid flash_sale_id"))
+			return
+		}
+		params.FlashSaleID = id
+	}
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, errorBody(codeInvalidRequest, "invalid limit"))
+			return
+		}
+		params.Limit = n
+	}
+
+	page, err := h.svc.ListUserOrders(c.Request.Context(), params)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidCursor) || errors.Is(err, service.ErrInvalidOrderStatus) {
+			c.JSON(http.StatusBadRequest, errorBody(codeInvalidRequest, err.Error()))
+			return
+		}
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
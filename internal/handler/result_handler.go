@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"errors"
+	"flashsale/internal/middleware"
 	"flashsale/internal/service"
 	"net/http"
 
@@ -19,13 +21,24 @@ func NewOrderResultHandler(svc *service.OrderResultService) *OrderResultHandler
 func (h *OrderResultHandler) GetResult(c *gin.Context) {
 	orderID := c.Param("order_id")
 	if orderID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "order_id required"})
+		c.JSON(http.StatusBadRequest, errorBody(codeInvalidRequest, "order_id required"))
 		return
 	}
 
-	result, err := h.svc.GetResult(c.Request.Context(), orderID)
+	claims := middleware.Claims(c)
+	if claims == nil {
+		c.JSON(http.StatusUnauthorized, errorBody(codeUnauthenticated, "unauthenticated"))
+		return
+	}
+	caller := service.Caller{UserID: claims.Subject, IsAdmin: claims.IsAdmin()}
+
+	result, err := h.svc.GetResult(c.Request.Context(), orderID, caller)
+	if errors.Is(err, service.ErrOrderNotFound) {
+		c.JSON(http.StatusNotFound, errorBody(codeOrderNotFound, "order not found"))
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
 
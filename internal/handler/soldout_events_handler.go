@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"flashsale/internal/service"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SoldOutEventsHandler struct {
+	cache *service.SoldOutCache
+	// one slot per open stream, caps goroutines & fds a crowd of clients can hold on this instance
+	conns chan struct{}
+}
+
+func NewSoldOutEventsHandler(cache *service.SoldOutCache, maxConns int) *SoldOutEventsHandler {
+	if maxConns < 1 {
+		maxConns = 1
+	}
+	return &SoldOutEventsHandler{cache: cache, conns: make(chan struct{}, maxConns)}
+}
+
+// GET /flashsale/events, server-sent events: "sold_out" / "restocked" with domain.SoldOutEvent as data
+// 503 when the instance already serves maxConns streams, clients retry later or keep polling
+func (h *SoldOutEventsHandler) Stream(c *gin.Context) {
+	select {
+	case h.conns <- struct{}{}:
+		defer func() { <-h.conns }()
+	default:
+		c.Header("Retry-After", "5")
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, errorBody(service.CodeServiceUnavailable, "too many event streams"))
+		return
+	}
+
+	events, stop := h.cache.Watch()
+	defer stop()
+
+	// keep proxies from closing idle streams
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case ev := <-events:
+			name := "sold_out"
+			if !ev.SoldOut {
+				name = "restocked"
+			}
+			c.SSEvent(name, ev)
+		case <-keepAlive.C:
+			c.SSEvent("ping", "")
+		}
+		return true
+	})
+}
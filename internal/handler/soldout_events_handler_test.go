@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"context"
+	"flashsale/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSoldOutEventsConnLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewSoldOutEventsHandler(service.NewSoldOutCache(nil), 1)
+	r := gin.New()
+	r.GET("/flashsale/events", h.Stream)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	// first stream holds the only slot until canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/flashsale/events", nil)
+	go func() {
+		if resp, err := http.DefaultClient.Do(req); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	waitConns(t, h, 1)
+
+	resp, err := http.Get(srv.URL + "/flashsale/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") == "" {
+		t.Fatalf("second stream = %d, Retry-After %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+
+	// a closed stream gives its slot back
+	cancel()
+	waitConns(t, h, 0)
+}
+
+func waitConns(t *testing.T, h *SoldOutEventsHandler, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for len(h.conns) != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("open streams = %d, want %d", len(h.conns), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
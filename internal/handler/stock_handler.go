@@ -16,18 +16,34 @@ func NewStockHandler(svc service.StockService) *StockHandler {
 	return &StockHandler{svc: svc}
 }
 
+// GET /flashsale/stock/:product_id
 func (h *StockHandler) GetStock(c *gin.Context) {
-	productId := c.Param("product_id")
-	pid, err := strconv.ParseInt(productId, 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product_id"})
+	pid, err := strconv.ParseInt(c.Param("product_id"), 10, 64)
+	if err != nil || pid <= 0 {
+		c.JSON(http.StatusBadRequest, errorBody(codeInvalidRequest, "invalid product_id"))
 		return
 	}
 
 	stock, err := h.svc.GetStock(c.Request.Context(), pid)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+		writeError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"product_id": pid, "stock": stock})
 }
+
+// GET /flashsale/:sale_id/stock
+func (h *StockHandler) GetSaleStock(c *gin.Context) {
+	saleID, err := strconv.ParseInt(c.Param("sale_id"), 10, 64)
+	if err != nil || saleID <= 0 {
+		c.JSON(http.StatusBadRequest, errorBody(codeInvalidRequest, "invalid sale_id"))
+		return
+	}
+
+	stocks, err := h.svc.GetSaleStock(c.Request.Context(), saleID)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"flash_sale_id": saleID, "stocks": stocks})
+}
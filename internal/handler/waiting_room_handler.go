@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"flashsale/internal/domain"
+	"flashsale/internal/middleware"
+	"flashsale/internal/waitingroom"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WaitingRoomHandler struct {
+	svc *waitingroom.Service
+}
+
+func NewWaitingRoomHandler(svc *waitingroom.Service) *WaitingRoomHandler {
+	return &WaitingRoomHandler{svc: svc}
+}
+
+// POST /flashsale/queue/join {"product_id":"p1"}
+func (h *WaitingRoomHandler) Join(c *gin.Context) {
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, errorBody(codeUnauthenticated, "unauthenticated"))
+		return
+	}
+	var body struct {
+		ProductID string `json:"product_id"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.ProductID == "" {
+		c.JSON(http.StatusBadRequest, errorBody(codeInvalidRequest, "product_id is required"))
+		return
+	}
+
+	t, err := h.svc.Join(c.Request.Context(), userID, body.ProductID)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, ticketJSON(t))
+}
+
+// GET /flashsale/queue/:ticket_id
+func (h *WaitingRoomHandler) Status(c *gin.Context) {
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, errorBody(codeUnauthenticated, "unauthenticated"))
+		return
+	}
+
+	t, err := h.svc.Status(c.Request.Context(), c.Param("ticket_id"), userID)
+	if errors.Is(err, waitingroom.ErrTicketInvalid) {
+		c.JSON(http.StatusNotFound, errorBody(codeQueueTicketInvalid, "ticket not found"))
+		return
+	}
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, ticketJSON(t))
+}
+
+func ticketJSON(t *domain.QueueTicket) gin.H {
+	return gin.H{
+		"ticket":     t.ID,
+		"product_id": t.ProductID,
+		"position":   t.Position,
+		"ahead":      t.Ahead(),
+		"admitted":   t.IsAdmitted(),
+	}
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"flashsale/internal/abuse"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AbuseGuard rejects blocked IPs / users and scores the rest, put it after Authenticate
+// Redis errors fail open, the rate limiters still apply
+func AbuseGuard(svc *abuse.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := UserID(c)
+		verdict, err := svc.Check(c.Request.Context(), abuse.Request{
+			IP:     c.ClientIP(),
+			UserID: userID,
+			Header: c.Request.Header,
+			At:     time.Now(),
+		})
+		if err != nil {
+			log.Printf("[abuse] check failed ip=%s user=%s: %v", c.ClientIP(), userID, err)
+			c.Next()
+			return
+		}
+		if !verdict.Blocked {
+			c.Next()
+			return
+		}
+
+		if retry := ceilSeconds(time.Until(verdict.Entry.ExpiresAt)); retry > 0 {
+			c.Header("Retry-After", strconv.FormatInt(retry, 10))
+		}
+		// no score or reasons in the response, don't teach bots what to change
+		c.AbortWithStatusJSON(http.StatusForbidden, ErrorBody(CodeBlocked, "blocked"))
+	}
+}
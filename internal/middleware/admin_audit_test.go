@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"context"
+	"flashsale/internal/auth"
+	"flashsale/internal/domain"
+	"flashsale/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type fakeAuditRepo struct {
+	recorded chan domain.AdminAuditEntry
+}
+
+func (r *fakeAuditRepo) Record(ctx context.Context, e domain.AdminAuditEntry) error {
+	r.recorded <- e
+	return nil
+}
+
+func (r *fakeAuditRepo) ListRecent(ctx context.Context, limit int) ([]domain.AdminAuditEntry, error) {
+	return nil, nil
+}
+
+func TestAdminAudit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys := auth.NewStaticKeySource("k1", "secret")
+	repo := &fakeAuditRepo{recorded: make(chan domain.AdminAuditEntry, 8)}
+	svc := service.NewAdminAuditService(repo)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go svc.Run(ctx)
+
+	// same chain as the /admin group of the router
+	r := gin.New()
+	admin := r.Group("/admin", AdminAudit(svc), Authenticate(auth.NewAuthenticator(keys, nil)), RequireRole(auth.RoleViewer))
+	admin.POST("/flashsales/:id/warmup", RequireRole(auth.RoleOperator), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	token := func(role string) string {
+		now := time.Now()
+		tok, err := auth.Sign(keys, auth.Claims{Subject: "A1", Role: role, IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "Bearer " + tok
+	}
+
+	tests := []struct {
+		name       string
+		authz      string
+		wantStatus int
+		wantRow    bool
+	}{
+		{"no token", "", http.StatusUnauthorized, false},
+		{"invalid token", "Bearer x.y.z", http.StatusUnauthorized, false},
+		{"role too low", token(auth.RoleViewer), http.StatusForbidden, true},
+		{"operator", token(auth.RoleOperator), http.StatusOK, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/admin/flashsales/3/warmup", nil)
+			if tt.authz != "" {
+				req.Header.Set("Authorization", tt.authz)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+
+			select {
+			case e := <-repo.recorded:
+				if !tt.wantRow {
+					t.Fatalf("unexpected audit row %+v", e)
+				}
+				want := domain.AdminAuditEntry{Action: "POST /admin/flashsales/:id/warmup", Target: "id=3", Actor: "A1", StatusCode: tt.wantStatus}
+				if e.Action != want.Action || e.Target != want.Target || e.Actor != want.Actor || e.StatusCode != want.StatusCode {
+					t.Fatalf("audit row = %+v, want %+v", e, want)
+				}
+			case <-time.After(100 * time.Millisecond):
+				if tt.wantRow {
+					t.Fatal("no audit row")
+				}
+			}
+		})
+	}
+}
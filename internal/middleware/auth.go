@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"flashsale/internal/auth"
+	"flashsale/internal/ratelimit"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// gin context keys set by Authenticate
+const (
+	ctxUserIDKey = "auth.user_id"
+	ctxClaimsKey = "auth.claims"
+)
+
+// Authenticate requires "Authorization: Bearer <token>" and puts the verified user ID into gin context
+// X-User-ID / user_id params are never trusted for identity
+func Authenticate(a *auth.Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := bearerToken(c.GetHeader("Authorization"))
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorBody(CodeUnauthenticated, "missing bearer token"))
+			return
+		}
+
+		claims, err := a.Authenticate(token)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorBody(CodeUnauthenticated, "invalid token"))
+			return
+		}
+
+		c.Set(ctxUserIDKey, claims.Subject)
+		c.Set(ctxClaimsKey, claims)
+		c.Next()
+	}
+}
+
+// RequireRole must run after Authenticate, rejects tokens below the required role
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := Claims(c)
+		if claims == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorBody(CodeUnauthenticated, "unauthenticated"))
+			return
+		}
+		if !auth.HasRole(claims.Role, role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, ErrorBody(CodeForbidden, "insufficient role"))
+			return
+		}
+		c.Next()
+	}
+}
+
+// UserID returns the authenticated user ID, false if request is not authenticated
+func UserID(c *gin.Context) (string, bool) {
+	v, ok := c.Get(ctxUserIDKey)
+	if !ok {
+		return "", false
+	}
+	id, ok := v.(string)
+	return id, ok && id != ""
+}
+
+// Claims returns the verified token claims, nil if request is not authenticated
+func Claims(c *gin.Context) *auth.Claims {
+	v, ok := c.Get(ctxClaimsKey)
+	if !ok {
+		return nil
+	}
+	claims, _ := v.(*auth.Claims)
+	return claims
+}
+
+// CallerTier is the rate limit tier from token, ratelimit.DefaultTier when absent
+func CallerTier(c *gin.Context) string {
+	if claims := Claims(c); claims != nil && claims.Tier != "" {
+		return claims.Tier
+	}
+	return ratelimit.DefaultTier
+}
+
+func bearerToken(h string) (string, bool) {
+	const prefix = "Bearer "
+	if len(h) <= len(prefix) || !strings.EqualFold(h[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(h[len(prefix):]), true
+}
@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"flashsale/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// codes of requests stopped before a handler runs, next to the service catalog
+const (
+	CodeUnauthenticated service.ErrorCode = "UNAUTHENTICATED"
+	CodeForbidden       service.ErrorCode = "FORBIDDEN"
+	CodeRateLimited     service.ErrorCode = "RATE_LIMITED"
+	CodeBlocked         service.ErrorCode = "BLOCKED"
+)
+
+// ErrorBody is the error envelope of every endpoint: {"error": {"code": "OUT_OF_STOCK", "message": "sold out"}}
+func ErrorBody(code service.ErrorCode, message string) gin.H {
+	return gin.H{"error": gin.H{"code": code, "message": message}}
+}
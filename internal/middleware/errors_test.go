@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"flashsale/internal/auth"
+	"flashsale/internal/cache"
+	"flashsale/internal/ratelimit"
+	"flashsale/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// one request per user, 503 when Redis is gone
+const envelopePolicies = `{"routes": {"precheck": {
+	"on_error": "closed",
+	"tiers": {"default": {"capacity": 1, "refill_per_sec": 0.001}}
+}}}`
+
+// TestErrorEnvelope: rejects of the precheck middlewares use the handlers' envelope
+func TestErrorEnvelope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	policies, err := ratelimit.NewRegistry(context.Background(), staticSource(envelopePolicies))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hybrid, err := cache.LoadHybridLimiter(rdb, "../../scripts/rate_limit_hybrid.lua")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rl := NewRateLimiter(policies, rdb, hybrid, nil, nil)
+	keys := auth.NewStaticKeySource("k1", "secret")
+
+	r := gin.New()
+	authn := Authenticate(auth.NewAuthenticator(keys, nil))
+	r.POST("/precheck", authn, rl.LayeredHybridLimiter("precheck"), func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.POST("/admin", authn, RequireRole(auth.RoleOperator), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	now := time.Now()
+	token, err := auth.Sign(keys, auth.Claims{Subject: "U1", IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	send := func(path, authz string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		if authz != "" {
+			req.Header.Set("Authorization", "Bearer "+authz)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		authz      string
+		closeRedis bool
+		wantStatus int
+		wantCode   service.ErrorCode
+	}{
+		{"no token", "/precheck", "", false, http.StatusUnauthorized, CodeUnauthenticated},
+		{"invalid token", "/precheck", "x.y.z", false, http.StatusUnauthorized, CodeUnauthenticated},
+		{"role too low", "/admin", token, false, http.StatusForbidden, CodeForbidden},
+		{"allowed", "/precheck", token, false, http.StatusOK, ""},
+		{"rate limited", "/precheck", token, false, http.StatusTooManyRequests, CodeRateLimited},
+		{"limiter down", "/precheck", token, true, http.StatusServiceUnavailable, service.CodeServiceUnavailable},
+	}
+	for _, tt := range tests {
+		if tt.closeRedis {
+			mr.Close()
+		}
+		w := send(tt.path, tt.authz)
+		if w.Code != tt.wantStatus {
+			t.Fatalf("%s: status %d, want %d", tt.name, w.Code, tt.wantStatus)
+		}
+		if tt.wantCode == "" {
+			continue
+		}
+		var body struct {
+			Error struct {
+				Code    service.ErrorCode `json:"code"`
+				Message string            `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Error.Code != tt.wantCode || body.Error.Message == "" {
+			t.Fatalf("%s: body %s, want code %s", tt.name, w.Body, tt.wantCode)
+		}
+	}
+}
@@ -2,96 +2,171 @@ package middleware
 
 import (
 	"flashsale/internal/cache"
+	"flashsale/internal/ratelimit"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// 1. init global hybrid rate limiter
-// 2. ip limiter + user limiter + global limiter
+// ip limiter + user limiter + global limiter, or all of them layered
+// limits come from the policy registry per route & caller tier, so they can change at runtime
 
-// global hybrid rate limiter instance
-var HybridLimiter *cache.HybridLimiter
-
-func InitHybridLimiter(h *cache.HybridLimiter) {
-	HybridLimiter = h
-}
-
-// wrapper params: capacity(burst), refillRate(tokens/sec), slidingLimit()
-
-func UserHybridLimiter(capacity, refillPerSec float64, slidingLimit int64, windowSec int64) gin.HandlerFunc {
+// LayeredHybridLimiter enforces global + per IP + per user budgets of route in one EVALSHA
+// in Redis Cluster each layer is its own slot & call, global first: a global reject charges nothing else
+// IP budget always applies, so requests without user are still limited
+// with a local tier set, Redis is only asked when a local bucket is close to empty
+func (rl *RateLimiter) LayeredHybridLimiter(route string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// 1. get user id from header X-User-ID -> else fallback to query
-		userID := c.GetHeader("X-User-ID")
-		if userID == "" {
-			userID = c.Query("user_id")
+		layers := make([]cache.LimitLayer, 0, 3)
+		keys := make([]ratelimit.LocalKey, 0, 3)
+		add := func(name, key string, l ratelimit.Limit) {
+			layers = append(layers, limitLayer(route, name, key, l))
+			keys = append(keys, localKey(route, key, l))
 		}
-		if userID == "" {
-			// no user id -> then fallback to ip limiter/ Allow
-			c.Next()
-			return
+		if l, ok := rl.policies.GlobalLimit(route); ok {
+			add("global", "global", l)
 		}
-		// 2. call HybridLimiter.Allow
-		allowed, reason, tokensLeft, swCount, err := HybridLimiter.Allow(c.Request.Context(), "user:"+userID, capacity, refillPerSec, slidingLimit, windowSec)
-		if err != nil {
-			// fail open
-			c.Next()
+		if l, ok := rl.policies.IPLimit(route); ok {
+			add("ip", "ip:"+c.ClientIP(), l)
+		}
+		if userID, ok := UserID(c); ok {
+			if l, ok := rl.policies.Limit(route, CallerTier(c)); ok {
+				add("user", "user:"+userID, l)
+			}
+		}
+		if rl.localTier == nil || len(layers) == 0 {
+			rl.hybridLimit(c, route, layers, keys)
 			return
 		}
 
-		// debug headers
-		c.Header("X-Rate-Allowed", strconv.FormatBool(allowed))
-		c.Header("X-Rate-Reason", reason)
-		c.Header("X-Rate-Tokens", strconv.FormatFloat(tokensLeft, 'f', 2, 64))
-		c.Header("X-Rate-Sliding-Count", strconv.FormatInt(swCount, 10))
-
-		if !allowed {
-			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
-				"error":  "rate limit exceeded",
-				"reason": reason,
-			})
-			return
+		decision, idx := rl.localTier.Take(keys, time.Now())
+		switch decision {
+		case ratelimit.LocalReject:
+			// this instance used up its share, no Redis round-trip
+			c.Header("X-Rate-Tier", "local")
+			c.Header("X-Rate-Layer", layers[idx].Name)
+			c.Header("Retry-After", "1")
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, ErrorBody(CodeRateLimited, "rate limit exceeded"))
+		case ratelimit.LocalAllow:
+			c.Header("X-Rate-Tier", "local")
+			c.Next()
+		default:
+			// borderline, Redis sees all instances and decides
+			c.Header("X-Rate-Tier", "redis")
+			rl.hybridLimit(c, route, layers, keys)
 		}
-		c.Next()
 	}
-
 }
 
-func IPHybridLimiter(capacity, refillPerSec float64, slidingLimit int64, windowSec int64) gin.HandlerFunc {
+// UserHybridLimiter limits per user, falls back to the IP budget when no user
+func (rl *RateLimiter) UserHybridLimiter(route string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		ip := c.ClientIP()
-		allowed, reason, tokens, sw, err := HybridLimiter.Allow(c.Request.Context(), "ip:"+ip, capacity, refillPerSec, slidingLimit, windowSec)
-		if err != nil {
+		// 1. get authenticated user id, set by Authenticate
+		userID, ok := UserID(c)
+		if !ok {
+			// no user id -> fallback to ip limiter
+			if l, ok := rl.policies.IPLimit(route); ok {
+				key := "ip:" + c.ClientIP()
+				rl.hybridLimit(c, route, []cache.LimitLayer{limitLayer(route, "ip", key, l)}, []ratelimit.LocalKey{localKey(route, key, l)})
+				return
+			}
 			c.Next()
 			return
 		}
-		c.Header("X-Rate-Allowed", strconv.FormatBool(allowed))
-		c.Header("X-Rate-Reason", reason)
-		c.Header("X-Rate-Tokens", strconv.FormatFloat(tokens, 'f', 2, 64))
-		c.Header("X-Rate-Sliding", strconv.FormatInt(sw, 10))
-		if !allowed {
-			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded", "reason": reason})
+		limit, ok := rl.policies.Limit(route, CallerTier(c))
+		if !ok {
+			// no policy for route -> unlimited
+			c.Next()
 			return
 		}
-		c.Next()
+		key := "user:" + userID
+		rl.hybridLimit(c, route, []cache.LimitLayer{limitLayer(route, "user", key, limit)}, []ratelimit.LocalKey{localKey(route, key, limit)})
 	}
 }
 
-// Global limiter: use a single key "global"
-func GlobalHybridLimiter(capacity, refillPerSec float64, slidingLimit int64, windowSec int64) gin.HandlerFunc {
+func (rl *RateLimiter) IPHybridLimiter(route string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		allowed, reason, _, _, err := HybridLimiter.Allow(c.Request.Context(), "global", capacity, refillPerSec, slidingLimit, windowSec)
-		if err != nil {
+		limit, ok := rl.policies.IPLimit(route)
+		if !ok {
 			c.Next()
 			return
 		}
-		c.Header("X-Rate-Allowed", strconv.FormatBool(allowed))
-		c.Header("X-Rate-Reason", reason)
-		if !allowed {
-			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "global rate limit exceeded", "reason": reason})
+		key := "ip:" + c.ClientIP()
+		rl.hybridLimit(c, route, []cache.LimitLayer{limitLayer(route, "ip", key, limit)}, []ratelimit.LocalKey{localKey(route, key, limit)})
+	}
+}
+
+// Global limiter: use a single key "global"
+func (rl *RateLimiter) GlobalHybridLimiter(route string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, ok := rl.policies.GlobalLimit(route)
+		if !ok {
+			c.Next()
 			return
 		}
+		rl.hybridLimit(c, route, []cache.LimitLayer{limitLayer(route, "global", "global", limit)}, []ratelimit.LocalKey{localKey(route, "global", limit)})
+	}
+}
+
+// limitLayer tags the Redis keys with {route:key}, so in cluster mode users / IPs spread over the slots
+func limitLayer(route, name, key string, l ratelimit.Limit) cache.LimitLayer {
+	return cache.LimitLayer{
+		Name:             name,
+		Key:              "{" + route + ":" + key + "}",
+		MaxTokens:        l.Capacity,
+		RefillRate:       l.RefillPerSec,
+		SlidingLimit:     l.SlidingLimit,
+		SlidingWindowSec: l.WindowSec,
+		WindowAlgorithm:  l.WindowAlgo,
+	}
+}
+
+// hybridLimit calls the hybrid limiter for all layers, aborts with 429 if any layer rejects
+// on Redis errors the route fail mode decides, keys are the in-process buckets of layers
+func (rl *RateLimiter) hybridLimit(c *gin.Context, route string, layers []cache.LimitLayer, keys []ratelimit.LocalKey) {
+	if len(layers) == 0 {
 		c.Next()
+		return
 	}
+
+	var res *cache.LimitResult
+	err := rl.limiterCall(c, func() (err error) {
+		res, err = rl.hybrid.AllowLayers(c.Request.Context(), layers)
+		return err
+	})
+	if err != nil {
+		rl.limiterUnavailable(c, route, keys)
+		return
+	}
+
+	// IETF RateLimit headers of the tightest / rejecting layer
+	c.Header("RateLimit-Limit", strconv.FormatInt(res.Limit, 10))
+	c.Header("RateLimit-Remaining", strconv.FormatInt(res.Remaining, 10))
+	c.Header("RateLimit-Reset", strconv.FormatInt(ceilSeconds(res.Reset), 10))
+
+	// debug headers
+	c.Header("X-Rate-Allowed", strconv.FormatBool(res.Allowed))
+	c.Header("X-Rate-Reason", res.Reason)
+	c.Header("X-Rate-Layer", res.Layer)
+	c.Header("X-Rate-Tokens", strconv.FormatFloat(res.TokensLeft, 'f', 2, 64))
+	c.Header("X-Rate-Sliding-Count", strconv.FormatInt(res.SlidingCount, 10))
+
+	if !res.Allowed {
+		// at least 1s, 0 would invite an immediate retry
+		retryAfter := ceilSeconds(res.RetryAfter)
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+		c.Header("Retry-After", strconv.FormatInt(retryAfter, 10))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, ErrorBody(CodeRateLimited, "rate limit exceeded"))
+		return
+	}
+	c.Next()
+}
+
+// ceilSeconds: headers use whole seconds, round up so clients don't retry too early
+func ceilSeconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
 }
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"context"
+	"flashsale/internal/cache"
+	"flashsale/internal/ratelimit"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// staticSource serves fixed policies to the registry
+type staticSource []byte
+
+func (s staticSource) Name() string                              { return "static" }
+func (s staticSource) Fetch(ctx context.Context) ([]byte, error) { return s, nil }
+
+// budgets far above the benchmark load, so every request is allowed and only the decision path is timed
+const benchPolicies = `{"routes": {"bench": {
+	"global": {"capacity": 1e9, "refill_per_sec": 1e9},
+	"ip": {"capacity": 1e6, "refill_per_sec": 1e6, "sliding_limit": 1000000000, "window_sec": 5}
+}}}`
+
+func newBenchRouter(b *testing.B, localTier bool) (*gin.Engine, *miniredis.Miniredis) {
+	b.Helper()
+	gin.SetMode(gin.ReleaseMode)
+	mr := miniredis.RunT(b)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	b.Cleanup(func() { rdb.Close() })
+
+	policies, err := ratelimit.NewRegistry(context.Background(), staticSource(benchPolicies))
+	if err != nil {
+		b.Fatal(err)
+	}
+	hybrid, err := cache.LoadHybridLimiter(rdb, "../../scripts/rate_limit_hybrid.lua")
+	if err != nil {
+		b.Fatal(err)
+	}
+	local := ratelimit.NewLocalLimiter(1, 0.5)
+	rl := NewRateLimiter(policies, rdb, hybrid, nil, local)
+	if localTier {
+		rl.WithLocalTier(local)
+	}
+
+	r := gin.New()
+	r.GET("/bench", rl.LayeredHybridLimiter("bench"), func(c *gin.Context) { c.Status(http.StatusOK) })
+	return r, mr
+}
+
+// BenchmarkLayeredHybridLimiter: every request through Redis vs the local tier deciding the comfortable ones
+// redis_cmds/op is what the local tier saves per request on a shared Redis
+func BenchmarkLayeredHybridLimiter(b *testing.B) {
+	for _, tc := range []struct {
+		name      string
+		localTier bool
+	}{
+		{"redis_only", false},
+		{"local_tier", true},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			r, mr := newBenchRouter(b, tc.localTier)
+			reqs := make([]*http.Request, 256)
+			for i := range reqs {
+				reqs[i] = httptest.NewRequest(http.MethodGet, "/bench", nil)
+				reqs[i].RemoteAddr = fmt.Sprintf("10.0.%d.%d:1234", i/256, i%256)
+			}
+
+			start := mr.CommandCount()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, reqs[i%len(reqs)])
+				if w.Code != http.StatusOK {
+					b.Fatalf("status = %d", w.Code)
+				}
+			}
+			b.StopTimer()
+			b.ReportMetric(float64(mr.CommandCount()-start)/float64(b.N), "redis_cmds/op")
+		})
+	}
+}
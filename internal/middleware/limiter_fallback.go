@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"flashsale/internal/ratelimit"
+	"flashsale/internal/service"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// limiterCall runs one Redis limiter call through the breaker
+func (rl *RateLimiter) limiterCall(c *gin.Context, fn func() error) error {
+	if rl.breaker == nil {
+		return fn()
+	}
+	return rl.breaker.Call(c.Request.Context(), fn)
+}
+
+// limiterUnavailable decides the request by the route fail mode when Redis can't
+func (rl *RateLimiter) limiterUnavailable(c *gin.Context, route string, keys []ratelimit.LocalKey) {
+	mode := rl.policies.FailMode(route)
+	if mode == ratelimit.FailLocal && rl.fallback == nil {
+		mode = ratelimit.FailOpen
+	}
+	ratelimit.RecordFallback(mode)
+	c.Header("X-Rate-Tier", "fallback-"+string(mode))
+
+	switch mode {
+	case ratelimit.FailClosed:
+		c.Header("Retry-After", "1")
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, ErrorBody(service.CodeServiceUnavailable, "rate limiter unavailable"))
+	case ratelimit.FailLocal:
+		// only this instance's share, borderline is allowed since there is nobody to ask
+		if decision, _ := rl.fallback.Take(keys, time.Now()); decision == ratelimit.LocalReject {
+			c.Header("Retry-After", "1")
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, ErrorBody(CodeRateLimited, "rate limit exceeded"))
+			return
+		}
+		c.Next()
+	default:
+		c.Next()
+	}
+}
+
+// localKey is the in-process bucket of one Redis limiter key
+func localKey(route, key string, l ratelimit.Limit) ratelimit.LocalKey {
+	return ratelimit.LocalKey{Key: route + ":" + key, Limit: l}
+}
@@ -2,7 +2,7 @@ package middleware
 
 import (
 	"context"
-	"flashsale/internal/cache"
+	"flashsale/internal/ratelimit"
 	"fmt"
 	"net/http"
 	"time"
@@ -10,60 +10,64 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// fixed window: per-user-per-second rate limiter, use Redis INCR+EXPIRE
+// fixed window: per-user rate limiter, use Redis INCR+EXPIRE
 
-// Basic settings
-var (
-	// requests per user per second
-	UserLimitPerSecond = int64(5)
-	// requests per IP per second
-	IPLimitPerSecond  = int64(20)
-	AllowOnRedisError = true
-)
+// limits: policy registry SlidingLimit requests per WindowSec window
+// Redis errors: route fail mode decides, see limiterUnavailable
+
+// windowKey buckets now into windowSec sized windows
+func windowKey(prefix string, windowSec int64) string {
+	if windowSec <= 0 {
+		windowSec = 1
+	}
+	return fmt.Sprintf("%s:%d", prefix, time.Now().Unix()/windowSec)
+}
 
 // incrWithExpire does INCR & set EXPIRE when first created
-func incrWithExpire(ctx context.Context, key string, expireSec int) (int64, error) {
+func (rl *RateLimiter) incrWithExpire(ctx context.Context, key string, expireSec int) (int64, error) {
 	// redis do INCR
-	n, err := cache.Rdb.Incr(ctx, key).Result()
+	n, err := rl.rdb.Incr(ctx, key).Result()
 	if err != nil {
 		return 0, err
 	}
 	// if first time, set expire
 	if n == 1 {
-		cache.Rdb.Expire(ctx, key, time.Duration(expireSec)*time.Second)
+		rl.rdb.Expire(ctx, key, time.Duration(expireSec)*time.Second)
 	}
 	return n, nil
 }
 
-// UserRateLimit middleware uses X-User-ID header
-func UserRateLimit() gin.HandlerFunc {
+// UserRateLimit middleware uses the authenticated user ID
+func (rl *RateLimiter) UserRateLimit(route string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx := c.Request.Context()
-		// get user ID from header
-		userID := c.GetHeader("X-User-ID")
-		if userID == "" {
-			userID = c.Query("user_id")
-		}
-		if userID == "" {
+		// get user ID set by Authenticate
+		userID, ok := UserID(c)
+		if !ok {
 			// no user provided, treat as anonymous user -> use IP rate limit
 			c.Next()
 			return
 		}
+		limit, ok := rl.policies.Limit(route, CallerTier(c))
+		if !ok || limit.SlidingLimit == 0 {
+			c.Next()
+			return
+		}
 
 		// build redis key
-		key := fmt.Sprintf("ratelimit:user:%s:%d", userID, time.Now().Unix())
-		n, err := incrWithExpire(ctx, key, 1)
+		key := windowKey("ratelimit:user:"+userID, limit.WindowSec)
+		var n int64
+		err := rl.limiterCall(c, func() (err error) {
+			n, err = rl.incrWithExpire(ctx, key, int(limit.WindowSec))
+			return err
+		})
 		if err != nil {
-			if AllowOnRedisError {
-				c.Next()
-				return
-			}
-			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit check failed"})
+			rl.limiterUnavailable(c, route, []ratelimit.LocalKey{localKey(route, "user:"+userID, limit)})
 			return
 		}
 
-		if n > UserLimitPerSecond {
-			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "user rate limit exceeded"})
+		if n > limit.SlidingLimit {
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, ErrorBody(CodeRateLimited, "user rate limit exceeded"))
 			return
 		}
 		c.Next()
@@ -71,24 +75,29 @@ func UserRateLimit() gin.HandlerFunc {
 }
 
 // IPRateLimit middleware uses request IP address
-func IPRateLimit() gin.HandlerFunc {
+func (rl *RateLimiter) IPRateLimit(route string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx := c.Request.Context()
+		limit, ok := rl.policies.IPLimit(route)
+		if !ok || limit.SlidingLimit == 0 {
+			c.Next()
+			return
+		}
 		// get client IP
 		ip := c.ClientIP()
 		// build redis key
-		key := fmt.Sprintf("ratelimit:ip:%s:%d", ip, time.Now().Unix())
-		n, err := incrWithExpire(ctx, key, 1)
+		key := windowKey("ratelimit:ip:"+ip, limit.WindowSec)
+		var n int64
+		err := rl.limiterCall(c, func() (err error) {
+			n, err = rl.incrWithExpire(ctx, key, int(limit.WindowSec))
+			return err
+		})
 		if err != nil {
-			if AllowOnRedisError {
-				c.Next()
-				return
-			}
-			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "ip rate limit check failed"})
+			rl.limiterUnavailable(c, route, []ratelimit.LocalKey{localKey(route, "ip:"+ip, limit)})
 			return
 		}
-		if n > IPLimitPerSecond {
-			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "ip rate limit exceeded"})
+		if n > limit.SlidingLimit {
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, ErrorBody(CodeRateLimited, "ip rate limit exceeded"))
 			return
 		}
 		c.Next()
@@ -96,22 +105,27 @@ func IPRateLimit() gin.HandlerFunc {
 }
 
 // simple global limiter
-func GlobalRateLimit(maxPerSecond int64) gin.HandlerFunc {
+func (rl *RateLimiter) GlobalRateLimit(route string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx := c.Request.Context()
+		limit, ok := rl.policies.GlobalLimit(route)
+		if !ok || limit.SlidingLimit == 0 {
+			c.Next()
+			return
+		}
 		// build redis key
-		key := fmt.Sprintf("ratelimit:global:%d", time.Now().Unix())
-		n, err := incrWithExpire(ctx, key, 1)
+		key := windowKey("ratelimit:global", limit.WindowSec)
+		var n int64
+		err := rl.limiterCall(c, func() (err error) {
+			n, err = rl.incrWithExpire(ctx, key, int(limit.WindowSec))
+			return err
+		})
 		if err != nil {
-			if AllowOnRedisError {
-				c.Next()
-				return
-			}
-			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "global rate limit check failed"})
+			rl.limiterUnavailable(c, route, []ratelimit.LocalKey{localKey(route, "global", limit)})
 			return
 		}
-		if n > maxPerSecond {
-			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "global rate limit exceeded"})
+		if n > limit.SlidingLimit {
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, ErrorBody(CodeRateLimited, "global rate limit exceeded"))
 			return
 		}
 		c.Next()
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"context"
+	"flashsale/internal/cache"
+	"flashsale/internal/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// bucket: burst of 2, a token every 2s; window: 3 per 10s with a bucket that never runs out
+const headerPolicies = `{"routes": {
+	"bucket": {"ip": {"capacity": 2, "refill_per_sec": 0.5}},
+	"window": {"ip": {"capacity": 100, "refill_per_sec": 100, "sliding_limit": 3, "window_sec": 10, "window_algo": "fixed"}}
+}}`
+
+func TestRateLimitHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	policies, err := ratelimit.NewRegistry(context.Background(), staticSource(headerPolicies))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hybrid, err := cache.LoadHybridLimiter(rdb, "../../scripts/rate_limit_hybrid.lua")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// frozen clock, the bucket doesn't refill between requests
+	now := time.Unix(1_700_000_000, 0)
+	hybrid.Now = func() time.Time { return now }
+	rl := NewRateLimiter(policies, rdb, hybrid, nil, nil)
+
+	r := gin.New()
+	for _, route := range []string{"bucket", "window"} {
+		r.GET("/"+route, rl.IPHybridLimiter(route), func(c *gin.Context) { c.Status(http.StatusOK) })
+	}
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	tests := []struct {
+		path                    string
+		wantStatus              int
+		limit, remaining, reset string
+		retryAfter              string
+	}{
+		// bucket quota: capacity & whole tokens left, reset when the bucket is full again
+		{"/bucket", http.StatusOK, "2", "1", "2", ""},
+		{"/bucket", http.StatusOK, "2", "0", "4", ""},
+		// one token is 2s away
+		{"/bucket", http.StatusTooManyRequests, "2", "0", "4", "2"},
+		// window quota: the window limit & what's left of it, reset at most a window away
+		{"/window", http.StatusOK, "3", "2", "", ""},
+		{"/window", http.StatusOK, "3", "1", "", ""},
+		{"/window", http.StatusOK, "3", "0", "", ""},
+		{"/window", http.StatusTooManyRequests, "3", "0", "", ""},
+	}
+	for i, tt := range tests {
+		w := get(tt.path)
+		h := w.Header()
+		if w.Code != tt.wantStatus {
+			t.Fatalf("%d %s: status %d, want %d", i, tt.path, w.Code, tt.wantStatus)
+		}
+		if h.Get("RateLimit-Limit") != tt.limit || h.Get("RateLimit-Remaining") != tt.remaining {
+			t.Fatalf("%d %s: limit %q remaining %q, want %s %s", i, tt.path, h.Get("RateLimit-Limit"), h.Get("RateLimit-Remaining"), tt.limit, tt.remaining)
+		}
+		if tt.reset != "" && h.Get("RateLimit-Reset") != tt.reset {
+			t.Fatalf("%d %s: reset %q, want %s", i, tt.path, h.Get("RateLimit-Reset"), tt.reset)
+		}
+		if tt.retryAfter != "" && h.Get("Retry-After") != tt.retryAfter {
+			t.Fatalf("%d %s: Retry-After %q, want %s", i, tt.path, h.Get("Retry-After"), tt.retryAfter)
+		}
+		if tt.wantStatus == http.StatusOK && h.Get("Retry-After") != "" {
+			t.Fatalf("%d %s: Retry-After on an allowed request", i, tt.path)
+		}
+		if tt.path == "/window" {
+			// whole seconds, rounded up, never past the window
+			if reset, _ := strconv.Atoi(h.Get("RateLimit-Reset")); reset < 1 || reset > 10 {
+				t.Fatalf("%d window reset = %q", i, h.Get("RateLimit-Reset"))
+			}
+			if retry, _ := strconv.Atoi(h.Get("Retry-After")); tt.wantStatus == http.StatusTooManyRequests && retry < 1 {
+				t.Fatalf("window Retry-After = %q", h.Get("Retry-After"))
+			}
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"flashsale/internal/cache"
+	"flashsale/internal/ratelimit"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RateLimiter builds the limiter middlewares of routes, all share one Redis client & breaker
+type RateLimiter struct {
+	policies *ratelimit.Registry
+	rdb      redis.UniversalClient // fixed window limiters
+	hybrid   *cache.HybridLimiter
+	// nil = Redis token bucket middlewares unusable
+	tokenBucket *cache.TokenBucketLimiter
+	// optional in-process tier in front of the hybrid limiter, nil = every request goes to Redis
+	localTier *ratelimit.LocalLimiter
+	// Redis breaker shared by all limiter middlewares, nil = always call Redis
+	breaker *ratelimit.Breaker
+	// in-process limiter for routes with on_error "local"
+	fallback *ratelimit.LocalLimiter
+}
+
+func NewRateLimiter(policies *ratelimit.Registry, rdb redis.UniversalClient, hybrid *cache.HybridLimiter, breaker *ratelimit.Breaker, fallback *ratelimit.LocalLimiter) *RateLimiter {
+	return &RateLimiter{policies: policies, rdb: rdb, hybrid: hybrid, breaker: breaker, fallback: fallback}
+}
+
+// WithLocalTier puts l in front of the hybrid limiter, see LayeredHybridLimiter
+func (rl *RateLimiter) WithLocalTier(l *ratelimit.LocalLimiter) *RateLimiter {
+	rl.localTier = l
+	return rl
+}
+
+// WithTokenBucket enables UserTokenBucket / IPTokenBucket
+func (rl *RateLimiter) WithTokenBucket(tb *cache.TokenBucketLimiter) *RateLimiter {
+	rl.tokenBucket = tb
+	return rl
+}
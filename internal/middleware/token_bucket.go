@@ -1,40 +1,41 @@
 package middleware
 
 import (
-	"flashsale/internal/cache"
+	"flashsale/internal/ratelimit"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
 
-var TB *cache.TokenBucketLimiter
-
-// Init token bucket limiter
-func InitTokenBucketLimiter(tb *cache.TokenBucketLimiter) {
-	TB = tb
-}
-
-// User based token bucket
-func UserTokenBucket(maxTokens, refillPerSec float64) gin.HandlerFunc {
+// User based token bucket, Capacity & RefillPerSec from policy
+func (rl *RateLimiter) UserTokenBucket(route string) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		userID := ctx.GetHeader("X-User-ID")
-		if userID == "" {
+		userID, ok := UserID(ctx)
+		if !ok {
 			// no user -> fallback to IP
 			ctx.Next()
 			return
 		}
+		limit, ok := rl.policies.Limit(route, CallerTier(ctx))
+		if !ok {
+			ctx.Next()
+			return
+		}
 
 		// redis keyPrefix
 		keyPrefix := "tb:user:" + userID
-		allowed, _, err := TB.Allow(keyPrefix, maxTokens, refillPerSec)
+		var allowed bool
+		err := rl.limiterCall(ctx, func() (err error) {
+			allowed, _, err = rl.tokenBucket.Allow(keyPrefix, limit.Capacity, limit.RefillPerSec)
+			return err
+		})
 		if err != nil {
-			// fail open
-			ctx.Next()
+			rl.limiterUnavailable(ctx, route, []ratelimit.LocalKey{localKey(route, "user:"+userID, limit)})
 			return
 		}
 
 		if !allowed {
-			ctx.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "user rate limit blocked"})
+			ctx.AbortWithStatusJSON(http.StatusTooManyRequests, ErrorBody(CodeRateLimited, "user rate limit blocked"))
 			return
 		}
 		ctx.Next()
@@ -42,17 +43,26 @@ func UserTokenBucket(maxTokens, refillPerSec float64) gin.HandlerFunc {
 }
 
 // IP token bucket
-func IPTokenBucket(maxTokens, refillPerSec float64) gin.HandlerFunc {
+func (rl *RateLimiter) IPTokenBucket(route string) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
+		limit, ok := rl.policies.IPLimit(route)
+		if !ok {
+			ctx.Next()
+			return
+		}
 		ip := ctx.ClientIP()
 		kexPrefix := "tb:ip:" + ip
-		allowed, _, err := TB.Allow(kexPrefix, maxTokens, refillPerSec)
+		var allowed bool
+		err := rl.limiterCall(ctx, func() (err error) {
+			allowed, _, err = rl.tokenBucket.Allow(kexPrefix, limit.Capacity, limit.RefillPerSec)
+			return err
+		})
 		if err != nil {
-			ctx.Next()
+			rl.limiterUnavailable(ctx, route, []ratelimit.LocalKey{localKey(route, "ip:"+ip, limit)})
 			return
 		}
 		if !allowed {
-			ctx.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "IP rate limit blocked"})
+			ctx.AbortWithStatusJSON(http.StatusTooManyRequests, ErrorBody(CodeRateLimited, "IP rate limit blocked"))
 			return
 		}
 		ctx.Next()
@@ -18,13 +18,10 @@ func NewRabbitMQOrderPublisher(client *mq.RabbitMQClient) serviceiface.OrderPubl
 	return &RabbitMQOrderPublisher{Client: client}
 }
 
-func (p *RabbitMQOrderPublisher) PublishOrder(ctx context.Context, orderID, userID, productID string) error {
+func (p *RabbitMQOrderPublisher) PublishOrder(ctx context.Context, msg dto.OrderMessage) error {
 	// 1. prepare msg content
-	msg := dto.OrderMessage{
-		OrderID:   orderID,
-		UserID:    userID,
-		ProductID: productID,
-		Timestamp: NowUnix(),
+	if msg.Timestamp == 0 {
+		msg.Timestamp = NowUnix()
 	}
 	// 2. msg content to json format
 	body, err := json.Marshal(msg)
@@ -0,0 +1,137 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrBreakerOpen is returned instead of calling Redis while the breaker is open
+var ErrBreakerOpen = errors.New("rate limiter circuit breaker open")
+
+// BreakerState of the Redis circuit breaker
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"    // calls go to Redis
+	BreakerOpen     BreakerState = "open"      // calls fail fast until cooldown passed
+	BreakerHalfOpen BreakerState = "half_open" // one probe call decides
+)
+
+// limiter metrics, exposed on /admin/debug/vars
+var metrics = expvar.NewMap("ratelimit")
+
+// RecordFallback counts requests decided by the fail mode instead of Redis
+func RecordFallback(mode FailMode) {
+	metrics.Add("fallback_"+string(mode), 1)
+}
+
+// Breaker trips after threshold consecutive Redis errors,
+// after cooldown one probe call is let through and closes it again on success
+type Breaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func NewBreaker(name string, threshold int, cooldown time.Duration) *Breaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	b := &Breaker{name: name, threshold: threshold, cooldown: cooldown, state: BreakerClosed}
+	metrics.Set(name+"_state", expvar.Func(func() any { return string(b.State()) }))
+	return b
+}
+
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Call runs fn unless the breaker is open, fn errors count towards tripping
+// canceled / deadline from the caller's request say nothing about Redis, not counted
+func (b *Breaker) Call(ctx context.Context, fn func() error) error {
+	if !b.allow() {
+		metrics.Add(b.name+"_rejected", 1)
+		return ErrBreakerOpen
+	}
+	err := fn()
+	if err != nil && ctx.Err() != nil {
+		b.release()
+		return err
+	}
+	b.done(err)
+	return err
+}
+
+func (b *Breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.setState(BreakerHalfOpen)
+		b.probing = true
+		return true
+	case BreakerHalfOpen:
+		// only one probe at a time
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// release gives the probe slot back without a verdict
+func (b *Breaker) release() {
+	b.mu.Lock()
+	b.probing = false
+	b.mu.Unlock()
+}
+
+func (b *Breaker) done(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if err == nil {
+		b.failures = 0
+		if b.state != BreakerClosed {
+			b.setState(BreakerClosed)
+		}
+		return
+	}
+
+	metrics.Add(b.name+"_errors", 1)
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		if b.state != BreakerOpen {
+			metrics.Add(b.name+"_trips", 1)
+			log.Printf("[breaker] %s tripped after %d errors, last: %v", b.name, b.failures, err)
+		}
+		b.openedAt = time.Now()
+		b.setState(BreakerOpen)
+	}
+}
+
+// setState logs transitions, callers hold mu
+func (b *Breaker) setState(s BreakerState) {
+	if b.state == s {
+		return
+	}
+	log.Printf("[breaker] %s %s -> %s", b.name, b.state, s)
+	b.state = s
+}
@@ -0,0 +1,124 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errRedis = errors.New("redis down")
+
+func failing() error    { return errRedis }
+func succeeding() error { return nil }
+
+func TestBreakerOpensAfterThreshold(t *testing.T) {
+	b := NewBreaker("test_open", 3, time.Hour)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := b.Call(ctx, failing); !errors.Is(err, errRedis) {
+			t.Fatalf("call %d = %v", i, err)
+		}
+	}
+	if s := b.State(); s != BreakerClosed {
+		t.Fatalf("state after 2 errors = %s", s)
+	}
+	// a success resets the count
+	_ = b.Call(ctx, succeeding)
+	for i := 0; i < 2; i++ {
+		_ = b.Call(ctx, failing)
+	}
+	if s := b.State(); s != BreakerClosed {
+		t.Fatalf("state after reset & 2 errors = %s", s)
+	}
+
+	_ = b.Call(ctx, failing)
+	if s := b.State(); s != BreakerOpen {
+		t.Fatalf("state after threshold = %s", s)
+	}
+	called := false
+	err := b.Call(ctx, func() error { called = true; return nil })
+	if !errors.Is(err, ErrBreakerOpen) || called {
+		t.Fatalf("open breaker = %v, called %v", err, called)
+	}
+}
+
+func TestBreakerHalfOpenProbe(t *testing.T) {
+	ctx := context.Background()
+	cooldown := 20 * time.Millisecond
+
+	t.Run("success closes", func(t *testing.T) {
+		b := NewBreaker("test_close", 1, cooldown)
+		_ = b.Call(ctx, failing)
+		time.Sleep(2 * cooldown)
+
+		// only one probe while half open
+		probe := make(chan struct{})
+		done := make(chan error)
+		go func() {
+			done <- b.Call(ctx, func() error { <-probe; return nil })
+		}()
+		waitState(t, b, BreakerHalfOpen)
+		if err := b.Call(ctx, succeeding); !errors.Is(err, ErrBreakerOpen) {
+			t.Fatalf("second call while probing = %v", err)
+		}
+		close(probe)
+		if err := <-done; err != nil {
+			t.Fatalf("probe = %v", err)
+		}
+		if s := b.State(); s != BreakerClosed {
+			t.Fatalf("state after probe success = %s", s)
+		}
+	})
+
+	t.Run("failure reopens", func(t *testing.T) {
+		b := NewBreaker("test_reopen", 1, cooldown)
+		_ = b.Call(ctx, failing)
+		time.Sleep(2 * cooldown)
+
+		if err := b.Call(ctx, failing); !errors.Is(err, errRedis) {
+			t.Fatalf("probe = %v", err)
+		}
+		if s := b.State(); s != BreakerOpen {
+			t.Fatalf("state after probe failure = %s", s)
+		}
+		// cooldown starts again
+		if err := b.Call(ctx, succeeding); !errors.Is(err, ErrBreakerOpen) {
+			t.Fatalf("call after reopen = %v", err)
+		}
+	})
+
+	t.Run("canceled probe gives the slot back", func(t *testing.T) {
+		b := NewBreaker("test_cancel", 1, cooldown)
+		_ = b.Call(ctx, failing)
+		time.Sleep(2 * cooldown)
+
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		if err := b.Call(canceled, func() error { return canceled.Err() }); !errors.Is(err, context.Canceled) {
+			t.Fatalf("canceled probe = %v", err)
+		}
+		if s := b.State(); s != BreakerHalfOpen {
+			t.Fatalf("state after canceled probe = %s", s)
+		}
+		if err := b.Call(ctx, succeeding); err != nil {
+			t.Fatalf("next probe = %v", err)
+		}
+		if s := b.State(); s != BreakerClosed {
+			t.Fatalf("state after next probe = %s", s)
+		}
+	})
+}
+
+// waitState polls until a concurrent call moved the breaker to s
+func waitState(t *testing.T, b *Breaker, s BreakerState) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for b.State() != s {
+		if time.Now().After(deadline) {
+			t.Fatalf("state = %s, want %s", b.State(), s)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
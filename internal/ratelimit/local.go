@@ -0,0 +1,126 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// LocalLimiter is the in-process tier in front of the Redis hybrid limiter
+// every API instance gets 1/instances of each budget, with even load balancing the shares add up to the budget
+type LocalLimiter struct {
+	share      float64 // 1 / number of API instances
+	borderline float64 // fraction of local capacity below which Redis decides
+
+	mu      sync.Mutex
+	buckets map[string]*localBucket
+}
+
+type localBucket struct {
+	tokens   float64
+	last     time.Time
+	capacity float64
+	refill   float64
+}
+
+// LocalDecision of the local tier
+type LocalDecision int
+
+const (
+	LocalReject     LocalDecision = iota // local share exhausted, no Redis call
+	LocalAllow                           // comfortably within local share, no Redis call
+	LocalBorderline                      // close to the limit, ask Redis
+)
+
+func NewLocalLimiter(instances int, borderline float64) *LocalLimiter {
+	if instances < 1 {
+		instances = 1
+	}
+	return &LocalLimiter{
+		share:      1 / float64(instances),
+		borderline: borderline,
+		buckets:    make(map[string]*localBucket),
+	}
+}
+
+// LocalKey is one budget to check locally, Key like "user:U1"
+type LocalKey struct {
+	Key   string
+	Limit Limit
+}
+
+// Take consumes one token from every bucket if all have one, and tells if Redis must decide
+// on LocalReject the index of the exhausted key is returned, -1 otherwise
+func (l *LocalLimiter) Take(keys []LocalKey, now time.Time) (LocalDecision, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	buckets := make([]*localBucket, len(keys))
+	decision := LocalAllow
+	for i, k := range keys {
+		b := l.bucket(k, now)
+		if b.tokens < 1 {
+			return LocalReject, i
+		}
+		if b.tokens-1 < b.capacity*l.borderline {
+			decision = LocalBorderline
+		}
+		buckets[i] = b
+	}
+	for _, b := range buckets {
+		b.tokens--
+	}
+	return decision, -1
+}
+
+// bucket refills or creates the bucket of k, sized to this instance's share
+func (l *LocalLimiter) bucket(k LocalKey, now time.Time) *localBucket {
+	capacity := k.Limit.Capacity * l.share
+	refill := k.Limit.RefillPerSec * l.share
+	// window limit caps the bucket too, a share of it per window
+	if k.Limit.SlidingLimit > 0 && k.Limit.WindowSec > 0 {
+		perSec := float64(k.Limit.SlidingLimit) / float64(k.Limit.WindowSec) * l.share
+		if perSec < refill {
+			refill = perSec
+		}
+	}
+	// always allow at least one request per instance
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	b, ok := l.buckets[k.Key]
+	if !ok {
+		b = &localBucket{tokens: capacity, last: now}
+		l.buckets[k.Key] = b
+	} else if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * refill
+		b.last = now
+	}
+	// policies may be hot-reloaded, follow the current size
+	b.capacity, b.refill = capacity, refill
+	if b.tokens > capacity {
+		b.tokens = capacity
+	}
+	return b
+}
+
+// Janitor drops buckets that are full again, they behave the same as new ones
+func (l *LocalLimiter) Janitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			l.mu.Lock()
+			for key, b := range l.buckets {
+				if b.tokens+now.Sub(b.last).Seconds()*b.refill >= b.capacity {
+					delete(l.buckets, key)
+				}
+			}
+			l.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"flashsale/internal/cache"
+	"fmt"
+)
+
+// DefaultTier is used when the caller tier has no own limit
+const DefaultTier = "default"
+
+// Limit is one hybrid limiter budget
+type Limit struct {
+	Capacity     float64 `json:"capacity"`       // token bucket burst
+	RefillPerSec float64 `json:"refill_per_sec"` // tokens per second
+	SlidingLimit int64   `json:"sliding_limit"`  // max reqs in window, 0 disables
+	WindowSec    int64   `json:"window_sec"`
+	// "fixed" / "sliding_counter" / "sliding_log", empty uses the limiter default
+	WindowAlgo cache.WindowAlgorithm `json:"window_algo,omitempty"`
+}
+
+// FailMode: what a limiter does when Redis can't answer
+type FailMode string
+
+const (
+	FailOpen   FailMode = "open"   // let the request through (default)
+	FailClosed FailMode = "closed" // reject with 503
+	FailLocal  FailMode = "local"  // decide with the in-process limiter only
+)
+
+func (m FailMode) Valid() bool {
+	switch m {
+	case FailOpen, FailClosed, FailLocal:
+		return true
+	}
+	return false
+}
+
+// RoutePolicy holds the budgets of one route, nil/missing layers are not limited
+type RoutePolicy struct {
+	Global *Limit           `json:"global,omitempty"` // shared by all callers
+	IP     *Limit           `json:"ip,omitempty"`     // per client IP
+	Tiers  map[string]Limit `json:"tiers"`            // per user, by caller tier
+	// behaviour on Redis errors / open breaker, empty = FailOpen
+	OnError FailMode `json:"on_error,omitempty"`
+}
+
+// Policies is the config file / Redis document, keyed by route name (eg. "precheck")
+type Policies struct {
+	Routes map[string]RoutePolicy `json:"routes"`
+}
+
+func ParsePolicies(data []byte) (*Policies, error) {
+	var p Policies
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parse rate limit policies: %w", err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (p *Policies) validate() error {
+	for route, rp := range p.Routes {
+		if rp.OnError != "" && !rp.OnError.Valid() {
+			return fmt.Errorf("route %q: unknown on_error %q", route, rp.OnError)
+		}
+		if rp.Global != nil {
+			if err := rp.Global.validate(); err != nil {
+				return fmt.Errorf("route %q global: %w", route, err)
+			}
+		}
+		if rp.IP != nil {
+			if err := rp.IP.validate(); err != nil {
+				return fmt.Errorf("route %q ip: %w", route, err)
+			}
+		}
+		for tier, l := range rp.Tiers {
+			if err := l.validate(); err != nil {
+				return fmt.Errorf("route %q tier %q: %w", route, tier, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (l Limit) validate() error {
+	if l.Capacity <= 0 || l.RefillPerSec <= 0 {
+		return fmt.Errorf("capacity and refill_per_sec must be > 0")
+	}
+	if l.SlidingLimit < 0 || (l.SlidingLimit > 0 && l.WindowSec <= 0) {
+		return fmt.Errorf("sliding_limit needs a positive window_sec")
+	}
+	if l.WindowAlgo != "" && !l.WindowAlgo.Valid() {
+		return fmt.Errorf("unknown window_algo %q", l.WindowAlgo)
+	}
+	return nil
+}
+
+// lookup returns the tier limit, falling back to DefaultTier
+func (p *Policies) lookup(route, tier string) (Limit, bool) {
+	rp, ok := p.Routes[route]
+	if !ok {
+		return Limit{}, false
+	}
+	if l, ok := rp.Tiers[tier]; ok {
+		return l, true
+	}
+	l, ok := rp.Tiers[DefaultTier]
+	return l, ok
+}
@@ -0,0 +1,135 @@
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Registry serves the current policies to limiter middlewares, safe to reload concurrently
+type Registry struct {
+	sources []Source // by priority, first source with data wins
+
+	current atomic.Pointer[Policies]
+
+	mu      sync.Mutex
+	lastRaw []byte
+	lastSrc string
+}
+
+// NewRegistry does the first load, at least one source must have valid policies
+func NewRegistry(ctx context.Context, sources ...Source) (*Registry, error) {
+	r := &Registry{sources: sources}
+	changed, err := r.Reload(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !changed {
+		return nil, errors.New("no rate limit policies found in any source")
+	}
+	return r, nil
+}
+
+// Limit resolves the per user limit for route & caller tier
+func (r *Registry) Limit(route, tier string) (Limit, bool) {
+	p := r.current.Load()
+	if p == nil {
+		return Limit{}, false
+	}
+	return p.lookup(route, tier)
+}
+
+// GlobalLimit is the budget shared by all callers of route
+func (r *Registry) GlobalLimit(route string) (Limit, bool) {
+	return r.layer(route, func(rp RoutePolicy) *Limit { return rp.Global })
+}
+
+// IPLimit is the per client IP budget of route
+func (r *Registry) IPLimit(route string) (Limit, bool) {
+	return r.layer(route, func(rp RoutePolicy) *Limit { return rp.IP })
+}
+
+// FailMode of route, FailOpen when not configured
+func (r *Registry) FailMode(route string) FailMode {
+	p := r.current.Load()
+	if p == nil {
+		return FailOpen
+	}
+	if m := p.Routes[route].OnError; m != "" {
+		return m
+	}
+	return FailOpen
+}
+
+func (r *Registry) layer(route string, pick func(RoutePolicy) *Limit) (Limit, bool) {
+	p := r.current.Load()
+	if p == nil {
+		return Limit{}, false
+	}
+	rp, ok := p.Routes[route]
+	if !ok {
+		return Limit{}, false
+	}
+	l := pick(rp)
+	if l == nil {
+		return Limit{}, false
+	}
+	return *l, true
+}
+
+// Reload fetches sources & swaps policies when the document changed
+// invalid documents are rejected and the previous policies stay active
+func (r *Registry) Reload(ctx context.Context) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, src := range r.sources {
+		raw, err := src.Fetch(ctx)
+		if err != nil {
+			// with policies active, a higher priority source may still hold an override, keep them
+			if r.current.Load() != nil {
+				return false, fmt.Errorf("fetch %s: %w", src.Name(), err)
+			}
+			log.Printf("[ratelimit] fetch %s failed, try next source: %v", src.Name(), err)
+			continue
+		}
+		if raw == nil {
+			continue
+		}
+		if src.Name() == r.lastSrc && bytes.Equal(raw, r.lastRaw) {
+			return false, nil
+		}
+
+		p, err := ParsePolicies(raw)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", src.Name(), err)
+		}
+		r.current.Store(p)
+		r.lastRaw = raw
+		r.lastSrc = src.Name()
+		log.Printf("[ratelimit] policies loaded from %s (%d routes)", src.Name(), len(p.Routes))
+		return true, nil
+	}
+	return false, nil
+}
+
+// Watch polls sources every interval until ctx is done
+func (r *Registry) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.Reload(ctx); err != nil {
+				log.Printf("[ratelimit] reload failed, keep previous policies: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// memSource is a policies document ops can change or break
+type memSource struct {
+	name string
+	data []byte
+	err  error
+}
+
+func (s *memSource) Name() string { return s.name }
+
+func (s *memSource) Fetch(ctx context.Context) ([]byte, error) { return s.data, s.err }
+
+const filePolicies = `{"routes": {"precheck": {
+	"on_error": "closed",
+	"global": {"capacity": 1000, "refill_per_sec": 500},
+	"ip": {"capacity": 20, "refill_per_sec": 10},
+	"tiers": {"default": {"capacity": 5, "refill_per_sec": 1}, "vip": {"capacity": 10, "refill_per_sec": 2}}
+}}}`
+
+func TestRegistryLookup(t *testing.T) {
+	r, err := NewRegistry(context.Background(), &memSource{name: "file", data: []byte(filePolicies)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if l, ok := r.Limit("precheck", "vip"); !ok || l.Capacity != 10 {
+		t.Fatalf("vip = %+v, %v", l, ok)
+	}
+	// unknown tiers get the default one
+	if l, ok := r.Limit("precheck", "gold"); !ok || l.Capacity != 5 {
+		t.Fatalf("unknown tier = %+v, %v", l, ok)
+	}
+	if l, ok := r.GlobalLimit("precheck"); !ok || l.Capacity != 1000 {
+		t.Fatalf("global = %+v, %v", l, ok)
+	}
+	if l, ok := r.IPLimit("precheck"); !ok || l.Capacity != 20 {
+		t.Fatalf("ip = %+v, %v", l, ok)
+	}
+	if m := r.FailMode("precheck"); m != FailClosed {
+		t.Fatalf("fail mode = %s", m)
+	}
+
+	// routes without policy are not limited and fail open
+	if _, ok := r.Limit("queue", DefaultTier); ok {
+		t.Fatal("limit for a route without policy")
+	}
+	if _, ok := r.GlobalLimit("queue"); ok {
+		t.Fatal("global limit for a route without policy")
+	}
+	if m := r.FailMode("queue"); m != FailOpen {
+		t.Fatalf("fail mode without policy = %s", m)
+	}
+}
+
+func TestRegistryReload(t *testing.T) {
+	ctx := context.Background()
+	override := &memSource{name: "redis"}
+	file := &memSource{name: "file", data: []byte(filePolicies)}
+	r, err := NewRegistry(ctx, override, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// same document, nothing swapped
+	if changed, err := r.Reload(ctx); err != nil || changed {
+		t.Fatalf("reload unchanged = %v, %v", changed, err)
+	}
+
+	// ops set the Redis override, it wins over the file
+	override.data = []byte(`{"routes": {"precheck": {"tiers": {"default": {"capacity": 2, "refill_per_sec": 1}}}}}`)
+	if changed, err := r.Reload(ctx); err != nil || !changed {
+		t.Fatalf("reload override = %v, %v", changed, err)
+	}
+	if l, _ := r.Limit("precheck", DefaultTier); l.Capacity != 2 {
+		t.Fatalf("limit after override = %+v", l)
+	}
+
+	// a broken document is rejected, the previous policies stay
+	for _, bad := range []string{
+		`{"routes": `,
+		`{"routes": {"precheck": {"on_error": "maybe"}}}`,
+		`{"routes": {"precheck": {"tiers": {"default": {"capacity": 0, "refill_per_sec": 1}}}}}`,
+		`{"routes": {"precheck": {"ip": {"capacity": 1, "refill_per_sec": 1, "sliding_limit": 5}}}}`,
+		`{"routes": {"precheck": {"global": {"capacity": 1, "refill_per_sec": 1, "window_algo": "bogus"}}}}`,
+	} {
+		override.data = []byte(bad)
+		if _, err := r.Reload(ctx); err == nil {
+			t.Fatalf("reload of %s succeeded", bad)
+		}
+		if l, _ := r.Limit("precheck", DefaultTier); l.Capacity != 2 {
+			t.Fatalf("limit after rejected %s = %+v", bad, l)
+		}
+	}
+
+	// an unreachable override keeps the active policies instead of falling back to the file
+	override.err = errors.New("redis down")
+	if _, err := r.Reload(ctx); err == nil {
+		t.Fatal("reload with the override down succeeded")
+	}
+	if l, _ := r.Limit("precheck", DefaultTier); l.Capacity != 2 {
+		t.Fatalf("limit with override down = %+v", l)
+	}
+
+	// override deleted, back to the file
+	override.data, override.err = nil, nil
+	if changed, err := r.Reload(ctx); err != nil || !changed {
+		t.Fatalf("reload after delete = %v, %v", changed, err)
+	}
+	if l, _ := r.Limit("precheck", DefaultTier); l.Capacity != 5 {
+		t.Fatalf("limit after delete = %+v", l)
+	}
+}
+
+func TestNewRegistryNeedsPolicies(t *testing.T) {
+	ctx := context.Background()
+	if _, err := NewRegistry(ctx, &memSource{name: "redis"}, &memSource{name: "file"}); err == nil {
+		t.Fatal("registry without any policies")
+	}
+	// first load: a failing source is skipped
+	r, err := NewRegistry(ctx, &memSource{name: "redis", err: errors.New("redis down")}, &memSource{name: "file", data: []byte(filePolicies)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.Limit("precheck", DefaultTier); !ok {
+		t.Fatal("file policies not loaded")
+	}
+}
@@ -0,0 +1,46 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Source returns the raw policies document, nil data means the source has none
+type Source interface {
+	Name() string
+	Fetch(ctx context.Context) ([]byte, error)
+}
+
+// FileSource reads a JSON file, eg. ./config/ratelimit.json
+type FileSource struct {
+	Path string
+}
+
+func (s FileSource) Name() string { return "file:" + s.Path }
+
+func (s FileSource) Fetch(ctx context.Context) ([]byte, error) {
+	b, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return b, err
+}
+
+// RedisSource reads a JSON string key, ops can SET it to change limits for every instance
+type RedisSource struct {
+	Rdb redis.UniversalClient
+	Key string
+}
+
+func (s RedisSource) Name() string { return "redis:" + s.Key }
+
+func (s RedisSource) Fetch(ctx context.Context) ([]byte, error) {
+	b, err := s.Rdb.Get(ctx, s.Key).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	return b, err
+}
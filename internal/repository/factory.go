@@ -8,7 +8,7 @@ import (
 )
 
 // The factory function's signature must include all external dependencies
-// required by any concrete implementation it might create (pool and locker).
+// required by any concrete implementation it might create.
 func NewOrderRepository(pool *pgxpool.Pool, dbType string) repositoryiface.OrderRepository {
 
 	// The factory logic decides which concrete implementation to return.
@@ -47,3 +47,14 @@ func NewWarmUpRepository(pool *pgxpool.Pool, dbType string) repositoryiface.Flas
 		return nil
 	}
 }
+
+func NewAuditLogRepository(pool *pgxpool.Pool, dbType string) repositoryiface.AuditLogRepository {
+
+	switch dbType {
+	case "postgres":
+		return postgres.NewAuditLogPGRepo(pool)
+
+	default:
+		return nil
+	}
+}
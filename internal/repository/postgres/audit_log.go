@@ -0,0 +1,57 @@
+package postgres
+
+import (
+	"context"
+	"flashsale/internal/domain"
+	"flashsale/internal/repository/repositoryiface"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type AuditLogPGRepo struct {
+	pool *pgxpool.Pool
+}
+
+func NewAuditLogPGRepo(pool *pgxpool.Pool) repositoryiface.AuditLogRepository {
+	return &AuditLogPGRepo{pool: pool}
+}
+
+func (r *AuditLogPGRepo) Record(ctx context.Context, e domain.AdminAuditEntry) error {
+	_, err := r.pool.Exec(ctx, `
+		INSERT INTO admin_audit_log (actor, role, action, target, status_code, client_ip)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, e.Actor, e.Role, e.Action, e.Target, e.StatusCode, e.ClientIP)
+	return err
+}
+
+func (r *AuditLogPGRepo) ListRecent(ctx context.Context, limit int) ([]domain.AdminAuditEntry, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT id, actor, role, action, target, status_code, client_ip, created_at
+		FROM admin_audit_log
+		ORDER BY id DESC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []domain.AdminAuditEntry
+	for rows.Next() {
+		var e domain.AdminAuditEntry
+		if err := rows.Scan(
+			&e.ID,
+			&e.Actor,
+			&e.Role,
+			&e.Action,
+			&e.Target,
+			&e.StatusCode,
+			&e.ClientIP,
+			&e.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		res = append(res, e)
+	}
+	return res, rows.Err()
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"flashsale/internal/domain"
 	"flashsale/internal/repository/repositoryiface"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -18,7 +19,7 @@ func NewFlashSalePGRepo(pool *pgxpool.Pool) repositoryiface.FlashSaleRepository
 
 func (r *FlashSalePGRepo) GetActiveFlashSale(ctx context.Context) (*domain.FlashSale, error) {
 	row := r.pool.QueryRow(ctx, `
-		SELECT id, name, start_at, end_at, status, created_at, updated_at
+		SELECT id, name, start_at, end_at, status, max_items_per_user, max_products_per_user, created_at, updated_at
 		FROM flash_sales
 		WHERE status = 'active'
 		LIMIT 1
@@ -31,6 +32,8 @@ func (r *FlashSalePGRepo) GetActiveFlashSale(ctx context.Context) (*domain.Flash
 		&fs.StartAt,
 		&fs.EndAt,
 		&fs.Status,
+		&fs.MaxItemsPerUser,
+		&fs.MaxProductsPerUser,
 		&fs.CreatedAt,
 		&fs.UpdatedAt,
 	)
@@ -42,7 +45,7 @@ func (r *FlashSalePGRepo) GetActiveFlashSale(ctx context.Context) (*domain.Flash
 
 func (r *FlashSalePGRepo) GetFlashSaleByID(ctx context.Context, id int64) (*domain.FlashSale, error) {
 	row := r.pool.QueryRow(ctx, `
-        SELECT id, name, start_at, end_at, status, created_at, updated_at
+        SELECT id, name, start_at, end_at, status, max_items_per_user, max_products_per_user, created_at, updated_at
         FROM flash_sales
         WHERE id = $1
     `, id)
@@ -54,6 +57,8 @@ func (r *FlashSalePGRepo) GetFlashSaleByID(ctx context.Context, id int64) (*doma
 		&fs.StartAt,
 		&fs.EndAt,
 		&fs.Status,
+		&fs.MaxItemsPerUser,
+		&fs.MaxProductsPerUser,
 		&fs.CreatedAt,
 		&fs.UpdatedAt,
 	)
@@ -63,6 +68,39 @@ func (r *FlashSalePGRepo) GetFlashSaleByID(ctx context.Context, id int64) (*doma
 	return &fs, nil
 }
 
+func (r *FlashSalePGRepo) ListUpcomingFlashSales(ctx context.Context, now time.Time) ([]domain.FlashSale, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT id, name, start_at, end_at, status, max_items_per_user, max_products_per_user, created_at, updated_at
+		FROM flash_sales
+		WHERE status IN ('scheduled', 'active') AND end_at > $1
+		ORDER BY start_at, id
+	`, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []domain.FlashSale
+	for rows.Next() {
+		var fs domain.FlashSale
+		if err := rows.Scan(
+			&fs.ID,
+			&fs.Name,
+			&fs.StartAt,
+			&fs.EndAt,
+			&fs.Status,
+			&fs.MaxItemsPerUser,
+			&fs.MaxProductsPerUser,
+			&fs.CreatedAt,
+			&fs.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		res = append(res, fs)
+	}
+	return res, rows.Err()
+}
+
 func (r *FlashSalePGRepo) GetFlashSaleProducts(ctx context.Context, flashSaleID int64) ([]domain.FlashSaleProduct, error) {
 
 	rows, err := r.pool.Query(ctx, `
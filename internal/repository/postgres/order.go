@@ -2,13 +2,13 @@ package postgres
 
 import (
 	"context"
-	"flashsale/internal/cache"
+	"errors"
 	"flashsale/internal/domain"
 	"flashsale/internal/repository/repositoryiface"
 	"fmt"
-	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -38,13 +38,30 @@ func (r *OrderPGRepo) CreatePendingOrder(ctx context.Context, orderNo, userID, p
 		VALUES ($1, $2, $3, $4, $5, 'pending')
 		ON CONFLICT (order_no) DO NOTHING;
 	`, orderNo, userID, productID, flashSaleID, price)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "uq_orders_sale_product_user_active" {
+		return domain.ErrDuplicateOrder
+	}
+	return err
+}
+
+func (r *OrderPGRepo) CreateOrderTx(ctx context.Context, tx pgx.Tx, o *domain.Order) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO orders (order_no, user_id, product_id, flash_sale_id, price, status, fail_reason, canceled_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, CASE WHEN $6::text = 'failed' THEN NOW() END)
+		ON CONFLICT (order_no) DO NOTHING;
+	`, o.OrderNo, o.UserID, o.ProductID, o.FlashSaleID, o.Price, o.Status, o.FailReason)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "uq_orders_sale_product_user_active" {
+		return domain.ErrDuplicateOrder
+	}
 	return err
 }
 
 func (r *OrderPGRepo) GetByOrderNo(ctx context.Context, orderNo string) (*domain.Order, error) {
 	row := r.Pool.QueryRow(ctx, `
 		SELECT id, order_no, user_id, product_id, flash_sale_id,
-		       price, status, created_at, paid_at, canceled_at
+		       price, status, fail_reason, created_at, paid_at, canceled_at
 		FROM orders
 		WHERE order_no = $1
 	`, orderNo)
@@ -58,6 +75,7 @@ func (r *OrderPGRepo) GetByOrderNo(ctx context.Context, orderNo string) (*domain
 		&o.FlashSaleID,
 		&o.Price,
 		&o.Status,
+		&o.FailReason,
 		&o.CreatedAt,
 		&o.PaidAt,
 		&o.CanceledAt,
@@ -68,6 +86,59 @@ func (r *OrderPGRepo) GetByOrderNo(ctx context.Context, orderNo string) (*domain
 	return &o, nil
 }
 
+// ListByUser uses keyset pagination: (created_at, id) < cursor, backed by idx_orders_user_created
+func (r *OrderPGRepo) ListByUser(ctx context.Context, q domain.OrderListQuery) ([]domain.Order, error) {
+	query := `
+		SELECT id, order_no, user_id, product_id, flash_sale_id,
+		       price, status, fail_reason, created_at, paid_at, canceled_at
+		FROM orders
+		WHERE user_id = $1`
+	args := []any{q.UserID}
+
+	if q.FlashSaleID > 0 {
+		args = append(args, q.FlashSaleID)
+		query += fmt.Sprintf(" AND flash_sale_id = $%d", len(args))
+	}
+	if q.Status != "" {
+		args = append(args, string(q.Status))
+		query += fmt.Sprintf(" AND status = $%d", len(args))
+	}
+	if q.After != nil {
+		args = append(args, q.After.CreatedAt, q.After.ID)
+		query += fmt.Sprintf(" AND (created_at, id) < ($%d, $%d)", len(args)-1, len(args))
+	}
+	args = append(args, q.Limit)
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d", len(args))
+
+	rows, err := r.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []domain.Order
+	for rows.Next() {
+		var o domain.Order
+		if err := rows.Scan(
+			&o.ID,
+			&o.OrderNo,
+			&o.UserID,
+			&o.ProductID,
+			&o.FlashSaleID,
+			&o.Price,
+			&o.Status,
+			&o.FailReason,
+			&o.CreatedAt,
+			&o.PaidAt,
+			&o.CanceledAt,
+		); err != nil {
+			return nil, err
+		}
+		res = append(res, o)
+	}
+	return res, rows.Err()
+}
+
 // UPDATE: reduce stock
 func (r *OrderPGRepo) ReduceStockTx(ctx context.Context, tx pgx.Tx, productID string, qty int64) (bool, error) {
 
@@ -95,17 +166,6 @@ func (r *OrderPGRepo) GetOrderStatus(ctx context.Context, orderNo string) (strin
 	return status, err
 }
 
-// Redis lock, SET NX
-func (r *OrderPGRepo) AcquireStockLock(ctx context.Context, key string, ttlSeconds int) (bool, error) {
-	ok, err := cache.Rdb.SetNX(ctx, key, "1", time.Duration(ttlSeconds)*time.Second).Result()
-	return ok, err
-}
-
-func (r *OrderPGRepo) ReleaseStockLock(ctx context.Context, key string) error {
-	_, err := cache.Rdb.Del(ctx, key).Result()
-	return err
-}
-
 func (r *OrderPGRepo) MarkOrderSuccessTx(ctx context.Context, tx pgx.Tx, orderNo string) error {
 	_, err := tx.Exec(ctx, `
 		UPDATE orders
@@ -125,6 +185,23 @@ func (r *OrderPGRepo) MarkOrderFailedTx(ctx context.Context, tx pgx.Tx, orderNo
 	return err
 }
 
+func (r *OrderPGRepo) UserSaleUsageTx(ctx context.Context, tx pgx.Tx, flashSaleID int64, userID, productID string) (domain.UserSaleUsage, error) {
+	var u domain.UserSaleUsage
+	// serialize per user & sale, released on commit / rollback
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`,
+		fmt.Sprintf("sale_user:%d:%s", flashSaleID, userID)); err != nil {
+		return u, err
+	}
+	err := tx.QueryRow(ctx, `
+		SELECT COUNT(*),
+		       COUNT(DISTINCT product_id),
+		       COUNT(*) FILTER (WHERE product_id = $3)
+		FROM orders
+		WHERE flash_sale_id = $1 AND user_id = $2 AND status = 'success'
+	`, flashSaleID, userID, productID).Scan(&u.Items, &u.Products, &u.ThisProduct)
+	return u, err
+}
+
 func (r *OrderPGRepo) MarkOrderFailed(ctx context.Context, orderNo string, reason string) error {
 	fmt.Printf("MarkOrderFailed - fail_reason: %s", reason)
 	_, err := r.Pool.Exec(ctx, `
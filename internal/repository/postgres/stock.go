@@ -2,6 +2,7 @@ package postgres
 
 import (
 	"context"
+	"flashsale/internal/domain"
 	"flashsale/internal/repository/repositoryiface"
 	"fmt"
 
@@ -26,3 +27,21 @@ func (p *StockPGRepo) GetStock(ctx context.Context, productID int64) (int64, err
 	}
 	return stock, nil
 }
+
+func (p *StockPGRepo) GetSaleStocks(ctx context.Context, flashSaleID int64) ([]domain.ProductStock, error) {
+	rows, err := p.db.Query(ctx, `SELECT product_id, sale_stock FROM flash_sale_products WHERE flash_sale_id=$1 ORDER BY product_id`, flashSaleID)
+	if err != nil {
+		return nil, fmt.Errorf("db GetSaleStocks: %w", err)
+	}
+	defer rows.Close()
+
+	var res []domain.ProductStock
+	for rows.Next() {
+		var s domain.ProductStock
+		if err := rows.Scan(&s.ProductID, &s.Stock); err != nil {
+			return nil, fmt.Errorf("db GetSaleStocks: %w", err)
+		}
+		res = append(res, s)
+	}
+	return res, rows.Err()
+}
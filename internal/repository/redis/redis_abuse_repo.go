@@ -0,0 +1,218 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"flashsale/internal/domain"
+	"flashsale/internal/repository/repositoryiface"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// blocklist index: zset of "kind:value" scored by expiry, entries live in their own key with TTL
+const blocklistIndexKey = "abuse:blocks"
+
+type BlocklistRedisRepo struct {
+	rdb redis.UniversalClient
+}
+
+func NewBlocklistRedisRepo(rdb redis.UniversalClient) repositoryiface.BlocklistRepository {
+	return &BlocklistRedisRepo{rdb: rdb}
+}
+
+func blockMember(kind domain.BlockKind, value string) string {
+	return string(kind) + ":" + value
+}
+
+func blockKey(member string) string {
+	return "abuse:block:" + member
+}
+
+type blockRecord struct {
+	Kind      domain.BlockKind `json:"kind"`
+	Value     string           `json:"value"`
+	Reason    string           `json:"reason"`
+	Score     int              `json:"score"`
+	Source    string           `json:"source"`
+	CreatedAt int64            `json:"created_at"`
+	ExpiresAt int64            `json:"expires_at"`
+}
+
+func (r *BlocklistRedisRepo) Block(ctx context.Context, e domain.BlockEntry) error {
+	ttl := time.Until(e.ExpiresAt)
+	if ttl <= 0 {
+		return fmt.Errorf("block %s:%s already expired", e.Kind, e.Value)
+	}
+	data, err := json.Marshal(blockRecord{
+		Kind:      e.Kind,
+		Value:     e.Value,
+		Reason:    e.Reason,
+		Score:     e.Score,
+		Source:    e.Source,
+		CreatedAt: e.CreatedAt.Unix(),
+		ExpiresAt: e.ExpiresAt.Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	member := blockMember(e.Kind, e.Value)
+	// not MULTI: entry & index are in different cluster slots, List tolerates a missing entry
+	pipe := r.rdb.Pipeline()
+	pipe.Set(ctx, blockKey(member), data, ttl)
+	pipe.ZAdd(ctx, blocklistIndexKey, redis.Z{Score: float64(e.ExpiresAt.Unix()), Member: member})
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (r *BlocklistRedisRepo) Unblock(ctx context.Context, kind domain.BlockKind, value string) error {
+	member := blockMember(kind, value)
+	pipe := r.rdb.Pipeline()
+	pipe.Del(ctx, blockKey(member))
+	pipe.ZRem(ctx, blocklistIndexKey, member)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (r *BlocklistRedisRepo) Find(ctx context.Context, ip, userID string) (*domain.BlockEntry, error) {
+	keys := []string{blockKey(blockMember(domain.BlockIP, ip))}
+	if userID != "" {
+		keys = append(keys, blockKey(blockMember(domain.BlockUser, userID)))
+	}
+	vals, err := r.getAll(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range vals {
+		if s == "" {
+			continue
+		}
+		return decodeBlock(s)
+	}
+	return nil, nil
+}
+
+// getAll: pipelined GETs instead of MGET, keys may be in different cluster slots
+// missing keys are ""
+func (r *BlocklistRedisRepo) getAll(ctx context.Context, keys []string) ([]string, error) {
+	pipe := r.rdb.Pipeline()
+	cmds := make([]*redis.StringCmd, len(keys))
+	for i, k := range keys {
+		cmds[i] = pipe.Get(ctx, k)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	vals := make([]string, len(keys))
+	for i, cmd := range cmds {
+		v, err := cmd.Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = v
+	}
+	return vals, nil
+}
+
+func (r *BlocklistRedisRepo) List(ctx context.Context) ([]domain.BlockEntry, error) {
+	// drop index members whose key already expired
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	if err := r.rdb.ZRemRangeByScore(ctx, blocklistIndexKey, "-inf", "("+now).Err(); err != nil {
+		return nil, err
+	}
+	members, err := r.rdb.ZRange(ctx, blocklistIndexKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		return []domain.BlockEntry{}, nil
+	}
+
+	keys := make([]string, len(members))
+	for i, m := range members {
+		keys[i] = blockKey(m)
+	}
+	vals, err := r.getAll(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]domain.BlockEntry, 0, len(vals))
+	for _, s := range vals {
+		if s == "" {
+			continue // unblocked or expired in between
+		}
+		e, err := decodeBlock(s)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *e)
+	}
+	return entries, nil
+}
+
+func decodeBlock(s string) (*domain.BlockEntry, error) {
+	var rec blockRecord
+	if err := json.Unmarshal([]byte(s), &rec); err != nil {
+		return nil, fmt.Errorf("decode block entry: %w", err)
+	}
+	return &domain.BlockEntry{
+		Kind:      rec.Kind,
+		Value:     rec.Value,
+		Reason:    rec.Reason,
+		Score:     rec.Score,
+		Source:    rec.Source,
+		CreatedAt: time.Unix(rec.CreatedAt, 0),
+		ExpiresAt: time.Unix(rec.ExpiresAt, 0),
+	}, nil
+}
+
+type AbuseSignalRedisRepo struct {
+	rdb redis.UniversalClient
+}
+
+func NewAbuseSignalRedisRepo(rdb redis.UniversalClient) repositoryiface.AbuseSignalRepository {
+	return &AbuseSignalRedisRepo{rdb: rdb}
+}
+
+// TrackIPUser uses a HyperLogLog per ip, the window starts with the first user seen
+func (r *AbuseSignalRedisRepo) TrackIPUser(ctx context.Context, ip, userID string, window time.Duration) (int64, error) {
+	key := "abuse:ipusers:" + ip
+	pipe := r.rdb.TxPipeline()
+	pipe.PFAdd(ctx, key, userID)
+	pipe.ExpireNX(ctx, key, window)
+	count := pipe.PFCount(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return count.Val(), nil
+}
+
+// TrackUserRequest keeps the latest request times (unix ms) in a capped list
+func (r *AbuseSignalRedisRepo) TrackUserRequest(ctx context.Context, userID string, at time.Time, keep int, window time.Duration) ([]time.Time, error) {
+	key := "abuse:reqts:" + userID
+	pipe := r.rdb.TxPipeline()
+	pipe.LPush(ctx, key, at.UnixMilli())
+	pipe.LTrim(ctx, key, 0, int64(keep-1))
+	pipe.Expire(ctx, key, window)
+	list := pipe.LRange(ctx, key, 0, -1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	times := make([]time.Time, 0, len(list.Val()))
+	for _, v := range list.Val() {
+		ms, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			continue
+		}
+		times = append(times, time.UnixMilli(ms))
+	}
+	return times, nil
+}
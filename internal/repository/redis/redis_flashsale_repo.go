@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"strconv"
 	"time"
 
+	"flashsale/internal/cache"
 	"flashsale/internal/domain"
 	"flashsale/internal/repository/repositoryiface"
 
@@ -14,19 +16,15 @@ import (
 )
 
 type FlashSaleRedisRepo struct {
-	rdb *redis.Client
+	rdb redis.UniversalClient
 }
 
 const ActiveFlashSaleKey = "flashsale:active:info"
 
-func NewFlashSaleRedisRepo(rdb *redis.Client) repositoryiface.FlashSaleRedisRepository {
+func NewFlashSaleRedisRepo(rdb redis.UniversalClient) repositoryiface.FlashSaleRedisRepository {
 	return &FlashSaleRedisRepo{rdb: rdb}
 }
 
-func stockKey(productID int64) string {
-	return fmt.Sprintf("flashsale:stock:%d", productID)
-}
-
 func (r *FlashSaleRedisRepo) WarmUpStock(
 	ctx context.Context,
 	flashSale domain.FlashSale,
@@ -39,35 +37,74 @@ func (r *FlashSaleRedisRepo) WarmUpStock(
 	}
 
 	// check to prevent overwrite by warmup
-	// check if first product key exists to determine if was warmed
+	// check if first product key (single or first bucket) exists to determine if was warmed
 	if len(products) > 0 {
-		firstKey := stockKey(products[0].ProductID)
-		exists, err := r.rdb.Exists(ctx, firstKey).Result()
+		firstID := strconv.FormatInt(products[0].ProductID, 10)
+		// separate calls, the single key & bucket 0 are in different cluster slots
+		exists, err := r.rdb.Exists(ctx, cache.StockKey(firstID)).Result()
+		if err == nil && exists == 0 {
+			exists, err = r.rdb.Exists(ctx, cache.StockKeys(firstID, 2)[0]).Result()
+		}
 		if err != nil {
 			return fmt.Errorf("check redis key existence failed: %w", err)
 		}
 		if exists > 0 {
 			// skip warm up if data exists to avoid overwrite the stock deduction
 			log.Printf("[warmup] stock already exists in redis, skipping to prevent override")
-			return nil
+			return r.loadStockBuckets(ctx, products)
 		}
 	}
 
 	pipe := r.rdb.Pipeline()
-	for _, p := range products {
-		pipe.Set(
-			ctx,
-			stockKey(p.ProductID),
-			p.SaleStock,
-			ttl,
-		)
+	for i := range products {
+		p := &products[i]
+		pid := strconv.FormatInt(p.ProductID, 10)
+		// every bucket gets at least 1 item
+		if p.StockBuckets > p.SaleStock {
+			p.StockBuckets = p.SaleStock
+		}
+		if p.StockBuckets <= 1 {
+			p.StockBuckets = 0
+			pipe.Set(ctx, cache.StockKey(pid), p.SaleStock, ttl)
+			pipe.HDel(ctx, cache.StockBucketsKey, pid)
+			continue
+		}
+		// split evenly, the first buckets take the remainder
+		for b, key := range cache.StockKeys(pid, p.StockBuckets) {
+			n := p.SaleStock / p.StockBuckets
+			if b < p.SaleStock%p.StockBuckets {
+				n++
+			}
+			pipe.Set(ctx, key, n, ttl)
+		}
+		pipe.HSet(ctx, cache.StockBucketsKey, pid, p.StockBuckets)
 	}
+	pipe.Expire(ctx, cache.StockBucketsKey, ttl)
 	_, err := pipe.Exec(ctx)
 	return err
 }
 
+// loadStockBuckets sets StockBuckets of products to the layout already in Redis
+func (r *FlashSaleRedisRepo) loadStockBuckets(ctx context.Context, products []domain.FlashSaleProduct) error {
+	fields := make([]string, len(products))
+	for i, p := range products {
+		fields[i] = strconv.FormatInt(p.ProductID, 10)
+	}
+	vals, err := r.rdb.HMGet(ctx, cache.StockBucketsKey, fields...).Result()
+	if err != nil {
+		return err
+	}
+	for i, v := range vals {
+		products[i].StockBuckets = 0
+		if s, ok := v.(string); ok {
+			products[i].StockBuckets, _ = strconv.Atoi(s)
+		}
+	}
+	return nil
+}
+
 func (r *FlashSaleRedisRepo) GetStock(ctx context.Context, productID int64) (int64, error) {
-	return r.rdb.Get(ctx, stockKey(productID)).Int64()
+	return r.rdb.Get(ctx, cache.StockKey(strconv.FormatInt(productID, 10))).Int64()
 }
 
 func (r *FlashSaleRedisRepo) SetActiveFlashSale(ctx context.Context, fs *domain.FlashSale, expiration time.Duration) error {
@@ -92,3 +129,85 @@ func (r *FlashSaleRedisRepo) GetActiveFlashSale(ctx context.Context) (*domain.Fl
 	}
 	return &fs, nil
 }
+
+func saleProductsKey(flashSaleID int64) string {
+	return fmt.Sprintf("flashsale:products:%d", flashSaleID)
+}
+
+// SetSaleProducts: hash product_id -> product json
+func (r *FlashSaleRedisRepo) SetSaleProducts(ctx context.Context, flashSaleID int64, products []domain.FlashSaleProduct, expiration time.Duration) error {
+	if len(products) == 0 {
+		return nil
+	}
+	fields := make([]any, 0, len(products)*2)
+	for _, p := range products {
+		data, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		fields = append(fields, strconv.FormatInt(p.ProductID, 10), data)
+	}
+
+	key := saleProductsKey(flashSaleID)
+	pipe := r.rdb.TxPipeline()
+	pipe.HSet(ctx, key, fields...)
+	pipe.Expire(ctx, key, expiration)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (r *FlashSaleRedisRepo) GetSaleProduct(ctx context.Context, flashSaleID int64, productID string) (*domain.FlashSaleProduct, error) {
+	data, err := r.rdb.HGet(ctx, saleProductsKey(flashSaleID), productID).Bytes()
+	if err == redis.Nil {
+		return nil, nil // no cache
+	} else if err != nil {
+		return nil, err
+	}
+
+	var p domain.FlashSaleProduct
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *FlashSaleRedisRepo) GetSaleProductIDs(ctx context.Context, flashSaleID int64) ([]int64, error) {
+	fields, err := r.rdb.HKeys(ctx, saleProductsKey(flashSaleID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, 0, len(fields))
+	for _, f := range fields {
+		id, err := strconv.ParseInt(f, 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+const catalogKey = "flashsale:catalog"
+
+func (r *FlashSaleRedisRepo) SetCatalog(ctx context.Context, sales []domain.CatalogSale, expiration time.Duration) error {
+	data, err := json.Marshal(sales)
+	if err != nil {
+		return err
+	}
+	return r.rdb.Set(ctx, catalogKey, data, expiration).Err()
+}
+
+func (r *FlashSaleRedisRepo) GetCatalog(ctx context.Context) ([]domain.CatalogSale, bool, error) {
+	data, err := r.rdb.Get(ctx, catalogKey).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil // no cache
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	var sales []domain.CatalogSale
+	if err := json.Unmarshal(data, &sales); err != nil {
+		return nil, false, err
+	}
+	return sales, true, nil
+}
@@ -0,0 +1,68 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"flashsale/internal/domain"
+	"flashsale/internal/repository/repositoryiface"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type IdempotencyRedisRepo struct {
+	rdb redis.UniversalClient
+}
+
+func NewIdempotencyRedisRepo(rdb redis.UniversalClient) repositoryiface.IdempotencyRepository {
+	return &IdempotencyRedisRepo{rdb: rdb}
+}
+
+func idempotencyKey(key string) string {
+	return "idem:" + key
+}
+
+func (r *IdempotencyRedisRepo) Begin(ctx context.Context, key string, rec domain.IdempotencyRecord, pendingTTL time.Duration) (bool, *domain.IdempotencyRecord, error) {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return false, nil, err
+	}
+	ok, err := r.rdb.SetNX(ctx, idempotencyKey(key), data, pendingTTL).Result()
+	if err != nil {
+		return false, nil, err
+	}
+	if ok {
+		return true, nil, nil
+	}
+	existing, err := r.Get(ctx, key)
+	return false, existing, err
+}
+
+func (r *IdempotencyRedisRepo) Get(ctx context.Context, key string) (*domain.IdempotencyRecord, error) {
+	data, err := r.rdb.Get(ctx, idempotencyKey(key)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rec domain.IdempotencyRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("decode idempotency record: %w", err)
+	}
+	return &rec, nil
+}
+
+func (r *IdempotencyRedisRepo) Complete(ctx context.Context, key string, rec domain.IdempotencyRecord, ttl time.Duration) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return r.rdb.Set(ctx, idempotencyKey(key), data, ttl).Err()
+}
+
+func (r *IdempotencyRedisRepo) Abandon(ctx context.Context, key string) error {
+	return r.rdb.Del(ctx, idempotencyKey(key)).Err()
+}
@@ -0,0 +1,76 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"flashsale/internal/domain"
+	"flashsale/internal/repository/repositoryiface"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type OrderStatusRedisRepo struct {
+	rdb redis.UniversalClient
+}
+
+func NewOrderStatusRedisRepo(rdb redis.UniversalClient) repositoryiface.OrderStatusCacheRepository {
+	return &OrderStatusRedisRepo{rdb: rdb}
+}
+
+func orderStatusKey(orderNo string) string {
+	return fmt.Sprintf("flashsale:order:%s", orderNo)
+}
+
+// SaveStatus writes hash fields: user_id, status, reason, created_at, updated_at (unix seconds)
+func (r *OrderStatusRedisRepo) SaveStatus(ctx context.Context, snap domain.OrderStatusSnapshot, ttl time.Duration) error {
+	key := orderStatusKey(snap.OrderNo)
+
+	updatedAt := snap.UpdatedAt
+	if updatedAt.IsZero() {
+		updatedAt = time.Now()
+	}
+	fields := []any{
+		"status", string(snap.Status),
+		"reason", snap.Reason,
+		"updated_at", updatedAt.Unix(),
+	}
+
+	pipe := r.rdb.TxPipeline()
+	pipe.HSet(ctx, key, fields...)
+	if snap.UserID != "" {
+		pipe.HSet(ctx, key, "user_id", snap.UserID)
+	}
+	if !snap.CreatedAt.IsZero() {
+		pipe.HSet(ctx, key, "created_at", snap.CreatedAt.Unix())
+	}
+	pipe.Expire(ctx, key, ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (r *OrderStatusRedisRepo) GetStatus(ctx context.Context, orderNo string) (*domain.OrderStatusSnapshot, error) {
+	vals, err := r.rdb.HGetAll(ctx, orderStatusKey(orderNo)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(vals) == 0 || vals["status"] == "" {
+		return nil, nil // no cache
+	}
+
+	snap := &domain.OrderStatusSnapshot{
+		OrderNo: orderNo,
+		UserID:  vals["user_id"],
+		Status:  domain.OrderStatus(vals["status"]),
+		Reason:  vals["reason"],
+	}
+	if v, err := strconv.ParseInt(vals["created_at"], 10, 64); err == nil {
+		snap.CreatedAt = time.Unix(v, 0)
+	}
+	if v, err := strconv.ParseInt(vals["updated_at"], 10, 64); err == nil {
+		snap.UpdatedAt = time.Unix(v, 0)
+	}
+	return snap, nil
+}
@@ -0,0 +1,35 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"flashsale/internal/cache"
+	"flashsale/internal/repository/repositoryiface"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type PurchaseClaimRedisRepo struct {
+	rdb     redis.UniversalClient
+	release *redis.Script
+}
+
+// NewPurchaseClaimRedisRepo loads purchase_claim_release.lua from scriptDir
+func NewPurchaseClaimRedisRepo(rdb redis.UniversalClient, scriptDir string) (repositoryiface.PurchaseClaimRepository, error) {
+	release, err := os.ReadFile(filepath.Join(scriptDir, "purchase_claim_release.lua"))
+	if err != nil {
+		return nil, fmt.Errorf("read purchase claim release lua: %w", err)
+	}
+	return &PurchaseClaimRedisRepo{rdb: rdb, release: redis.NewScript(string(release))}, nil
+}
+
+func (r *PurchaseClaimRedisRepo) Release(ctx context.Context, productID, userID, orderID string, buckets int) error {
+	keys := []string{
+		cache.ClaimKey(productID, userID, buckets),
+		cache.PurchasedKey(productID, userID, buckets),
+	}
+	return r.release.Run(ctx, r.rdb, keys, userID, orderID).Err()
+}
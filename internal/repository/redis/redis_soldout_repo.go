@@ -0,0 +1,90 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"flashsale/internal/domain"
+	"flashsale/internal/repository/repositoryiface"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const soldOutChannel = "flashsale:soldout:events"
+
+type SoldOutRedisRepo struct {
+	rdb redis.UniversalClient
+}
+
+func NewSoldOutRedisRepo(rdb redis.UniversalClient) repositoryiface.SoldOutRepository {
+	return &SoldOutRedisRepo{rdb: rdb}
+}
+
+// set of sold out product ids, per sale so a new sale starts clean
+func soldOutKey(flashSaleID int64) string {
+	return fmt.Sprintf("flashsale:soldout:%d", flashSaleID)
+}
+
+func (r *SoldOutRedisRepo) Mark(ctx context.Context, flashSaleID int64, productID string, ttl time.Duration) error {
+	key := soldOutKey(flashSaleID)
+	pipe := r.rdb.TxPipeline()
+	added := pipe.SAdd(ctx, key, productID)
+	pipe.Expire(ctx, key, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	if added.Val() == 0 {
+		return nil // already sold out
+	}
+	return r.publish(ctx, domain.SoldOutEvent{FlashSaleID: flashSaleID, ProductID: productID, SoldOut: true, At: time.Now()})
+}
+
+func (r *SoldOutRedisRepo) Clear(ctx context.Context, flashSaleID int64, productID string) error {
+	removed, err := r.rdb.SRem(ctx, soldOutKey(flashSaleID), productID).Result()
+	if err != nil || removed == 0 {
+		return err
+	}
+	return r.publish(ctx, domain.SoldOutEvent{FlashSaleID: flashSaleID, ProductID: productID, SoldOut: false, At: time.Now()})
+}
+
+func (r *SoldOutRedisRepo) List(ctx context.Context, flashSaleID int64) ([]string, error) {
+	return r.rdb.SMembers(ctx, soldOutKey(flashSaleID)).Result()
+}
+
+func (r *SoldOutRedisRepo) publish(ctx context.Context, ev domain.SoldOutEvent) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	return r.rdb.Publish(ctx, soldOutChannel, data).Err()
+}
+
+func (r *SoldOutRedisRepo) Subscribe(ctx context.Context, fn func(domain.SoldOutEvent)) error {
+	sub := r.rdb.Subscribe(ctx, soldOutChannel)
+	defer sub.Close()
+	// wait for the subscription, so callers can resync right after
+	if _, err := sub.Receive(ctx); err != nil {
+		return err
+	}
+
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-ch:
+			if !ok {
+				return fmt.Errorf("sold out subscription closed")
+			}
+			var ev domain.SoldOutEvent
+			if err := json.Unmarshal([]byte(msg.Payload), &ev); err != nil {
+				log.Printf("[soldout] warn: bad event %q: %v", msg.Payload, err)
+				continue
+			}
+			fn(ev)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"flashsale/internal/repository/repositoryiface"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type StockLockRedisRepo struct {
+	rdb redis.UniversalClient
+}
+
+func NewStockLockRedisRepo(rdb redis.UniversalClient) repositoryiface.StockLockRepository {
+	return &StockLockRedisRepo{rdb: rdb}
+}
+
+// Redis lock, SET NX
+func (r *StockLockRedisRepo) AcquireStockLock(ctx context.Context, key string, ttlSeconds int) (bool, error) {
+	return r.rdb.SetNX(ctx, key, "1", time.Duration(ttlSeconds)*time.Second).Result()
+}
+
+func (r *StockLockRedisRepo) ReleaseStockLock(ctx context.Context, key string) error {
+	return r.rdb.Del(ctx, key).Err()
+}
@@ -2,23 +2,173 @@ package redis
 
 import (
 	"context"
+	"flashsale/internal/cache"
+	"flashsale/internal/domain"
 	"flashsale/internal/repository/repositoryiface"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
 type RedisStockRepository struct {
-	rdb *redis.Client
+	rdb  redis.UniversalClient
+	decr *redis.Script
 }
 
-func NewRedisStockRepo(rdb *redis.Client) repositoryiface.RedisStockRepository {
+// NewRedisStockRepo loads stock_bucket_decr.lua from scriptDir
+func NewRedisStockRepo(rdb redis.UniversalClient, scriptDir string) (repositoryiface.RedisStockRepository, error) {
+	decr, err := os.ReadFile(filepath.Join(scriptDir, "stock_bucket_decr.lua"))
+	if err != nil {
+		return nil, fmt.Errorf("read stock bucket decr lua: %w", err)
+	}
 	return &RedisStockRepository{
-		rdb: rdb,
+		rdb:  rdb,
+		decr: redis.NewScript(string(decr)),
+	}, nil
+}
+
+// RestoreStock puts stock back into a random bucket, so restores spread like the deductions
+func (r *RedisStockRepository) RestoreStock(ctx context.Context, productID string, buckets, qty int) error {
+	return r.rdb.IncrBy(ctx, cache.PickStockKeys(productID, buckets)[0], int64(qty)).Err()
+}
+
+// DecrStock deducts from one random bucket, the next ones are tried from here while empty
+// so each call runs on a single cluster slot; the buckets are only summed once one runs out
+func (r *RedisStockRepository) DecrStock(ctx context.Context, productID string, buckets int) (bool, int64, error) {
+	keys := cache.PickStockKeys(productID, buckets)
+	for _, key := range keys {
+		res, err := r.decr.Run(ctx, r.rdb, []string{key}).Int64Slice()
+		if err != nil {
+			return false, 0, err
+		}
+		if len(res) < 2 {
+			return false, 0, fmt.Errorf("unexpected stock decr return: %v", res)
+		}
+		if res[0] == 1 {
+			if res[1] > 0 || len(keys) == 1 {
+				return true, res[1], nil
+			}
+			remaining, err := r.sumStock(ctx, keys)
+			return true, remaining, err
+		}
+	}
+	return false, 0, nil
+}
+
+// sumStock adds up the buckets, missing ones count as empty
+func (r *RedisStockRepository) sumStock(ctx context.Context, keys []string) (int64, error) {
+	pipe := r.rdb.Pipeline()
+	cmds := make([]*redis.StringCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.Get(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return 0, err
+	}
+	var total int64
+	for _, cmd := range cmds {
+		if v, err := cmd.Int64(); err == nil {
+			total += v
+		}
+	}
+	return total, nil
+}
+
+func (r *RedisStockRepository) ClearStock(ctx context.Context, productID string, buckets int) error {
+	pipe := r.rdb.Pipeline()
+	for _, key := range cache.StockKeys(productID, buckets) {
+		pipe.Set(ctx, key, 0, redis.KeepTTL)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// stock read from DB while the live key is missing (not warmed up yet / sale over)
+func stockFallbackKey(productID int64) string {
+	return fmt.Sprintf("flashsale:stock:db:%d", productID)
+}
+
+func (r *RedisStockRepository) GetStocks(ctx context.Context, productIDs []int64) (map[int64]int64, error) {
+	return r.getStocks(ctx, productIDs, true)
+}
+
+func (r *RedisStockRepository) GetLiveStocks(ctx context.Context, productIDs []int64) (map[int64]int64, error) {
+	return r.getStocks(ctx, productIDs, false)
+}
+
+// getStocks sums the live counters, withFallback serves the cached DB value of products without one
+func (r *RedisStockRepository) getStocks(ctx context.Context, productIDs []int64, withFallback bool) (map[int64]int64, error) {
+	// 1. single keys, fallback values & bucket layout
+	pipe := r.rdb.Pipeline()
+	live := make([]*redis.StringCmd, len(productIDs))
+	fallback := make([]*redis.StringCmd, len(productIDs))
+	buckets := make([]*redis.StringCmd, len(productIDs))
+	for i, id := range productIDs {
+		pid := strconv.FormatInt(id, 10)
+		live[i] = pipe.Get(ctx, cache.StockKey(pid))
+		fallback[i] = pipe.Get(ctx, stockFallbackKey(id))
+		buckets[i] = pipe.HGet(ctx, cache.StockBucketsKey, pid)
+	}
+	// redis.Nil of missing keys is reported per command
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
 	}
+
+	// 2. sum the buckets of bucketed products
+	bucketPipe := r.rdb.Pipeline()
+	bucketCmds := make(map[int64][]*redis.StringCmd)
+	for i, id := range productIDs {
+		n, err := buckets[i].Int()
+		if err != nil || n <= 1 {
+			continue
+		}
+		for _, key := range cache.StockKeys(strconv.FormatInt(id, 10), n) {
+			bucketCmds[id] = append(bucketCmds[id], bucketPipe.Get(ctx, key))
+		}
+	}
+	if len(bucketCmds) > 0 {
+		if _, err := bucketPipe.Exec(ctx); err != nil && err != redis.Nil {
+			return nil, err
+		}
+	}
+
+	res := make(map[int64]int64, len(productIDs))
+	for i, id := range productIDs {
+		if cmds, ok := bucketCmds[id]; ok {
+			var total int64
+			found := false
+			for _, cmd := range cmds {
+				if v, err := cmd.Int64(); err == nil {
+					total += v
+					found = true
+				}
+			}
+			if found {
+				res[id] = total
+				continue
+			}
+		}
+		if v, err := live[i].Int64(); err == nil {
+			res[id] = v
+		} else if v, err := fallback[i].Int64(); err == nil && withFallback {
+			res[id] = v
+		}
+	}
+	return res, nil
 }
 
-func (r *RedisStockRepository) RestoreStock(ctx context.Context, productID string, qty int) error {
-	key := fmt.Sprintf("flashsale:stock:%s", productID)
-	return r.rdb.Incr(ctx, key).Err()
+func (r *RedisStockRepository) CacheStocks(ctx context.Context, stocks []domain.ProductStock, ttl time.Duration) error {
+	if len(stocks) == 0 {
+		return nil
+	}
+	pipe := r.rdb.Pipeline()
+	for _, s := range stocks {
+		pipe.Set(ctx, stockFallbackKey(s.ProductID), s.Stock, ttl)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
 }
@@ -0,0 +1,98 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"flashsale/internal/cache"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestDecrStockBuckets(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	repo, err := NewRedisStockRepo(rdb, "../../../scripts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	keys := cache.StockKeys("1", 3)
+	mr.Set(keys[0], "2")
+	mr.Set(keys[1], "0")
+	mr.Set(keys[2], "1")
+
+	// 3 items over the buckets, random starts fall back to the ones left
+	for i := 0; i < 3; i++ {
+		ok, remaining, err := repo.DecrStock(ctx, "1", 3)
+		if err != nil || !ok {
+			t.Fatalf("decr %d = %v, %v", i, ok, err)
+		}
+		if want := int64(2 - i); (remaining <= 0) != (want <= 0) {
+			t.Fatalf("decr %d remaining = %d, %d items left", i, remaining, want)
+		}
+	}
+	ok, remaining, err := repo.DecrStock(ctx, "1", 3)
+	if err != nil || ok || remaining != 0 {
+		t.Fatalf("decr of empty buckets = %v, %d, %v", ok, remaining, err)
+	}
+	for _, k := range keys {
+		if v, _ := mr.Get(k); v != "0" {
+			t.Fatalf("%s = %s after selling out", k, v)
+		}
+	}
+}
+
+func TestDecrStockSingleKey(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	repo, err := NewRedisStockRepo(rdb, "../../../scripts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	mr.Set(cache.StockKey("1"), "1")
+	ok, remaining, err := repo.DecrStock(ctx, "1", 0)
+	if err != nil || !ok || remaining != 0 {
+		t.Fatalf("decr = %v, %d, %v", ok, remaining, err)
+	}
+	ok, _, err = repo.DecrStock(ctx, "1", 0)
+	if err != nil || ok {
+		t.Fatalf("decr of empty key = %v, %v", ok, err)
+	}
+}
+
+func TestRestoreStockSpreadsBuckets(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	repo, err := NewRedisStockRepo(rdb, "../../../scripts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	for i := 0; i < 60; i++ {
+		if err := repo.RestoreStock(ctx, "1", 3, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	total := 0
+	for _, k := range cache.StockKeys("1", 3) {
+		v, _ := mr.Get(k)
+		if v == "" {
+			t.Fatalf("%s never restored", k)
+		}
+		n, _ := strconv.Atoi(v)
+		total += n
+	}
+	if total != 60 {
+		t.Fatalf("restored %d, want 60", total)
+	}
+}
@@ -0,0 +1,54 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"flashsale/internal/repository/repositoryiface"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type UserQuotaRedisRepo struct {
+	rdb     redis.UniversalClient
+	reserve *redis.Script
+	release *redis.Script
+}
+
+// NewUserQuotaRedisRepo loads user_quota_reserve.lua & user_quota_release.lua from scriptDir
+func NewUserQuotaRedisRepo(rdb redis.UniversalClient, scriptDir string) (repositoryiface.UserQuotaRepository, error) {
+	reserve, err := os.ReadFile(filepath.Join(scriptDir, "user_quota_reserve.lua"))
+	if err != nil {
+		return nil, fmt.Errorf("read user quota reserve lua: %w", err)
+	}
+	release, err := os.ReadFile(filepath.Join(scriptDir, "user_quota_release.lua"))
+	if err != nil {
+		return nil, fmt.Errorf("read user quota release lua: %w", err)
+	}
+	return &UserQuotaRedisRepo{
+		rdb:     rdb,
+		reserve: redis.NewScript(string(reserve)),
+		release: redis.NewScript(string(release)),
+	}, nil
+}
+
+// user's items & products in the sale
+func userQuotaKey(saleID int64, userID string) string {
+	return fmt.Sprintf("flashsale:quota:%d:%s", saleID, userID)
+}
+
+func (r *UserQuotaRedisRepo) Reserve(ctx context.Context, saleID int64, userID, productID string, maxItems, maxProducts int64, ttl time.Duration) (bool, error) {
+	n, err := r.reserve.Run(ctx, r.rdb, []string{userQuotaKey(saleID, userID)},
+		productID, maxItems, maxProducts, int64(ttl/time.Second)).Int64()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (r *UserQuotaRedisRepo) Release(ctx context.Context, saleID int64, userID, productID string) error {
+	return r.release.Run(ctx, r.rdb, []string{userQuotaKey(saleID, userID)}, productID).Err()
+}
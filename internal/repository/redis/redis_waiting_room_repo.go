@@ -0,0 +1,152 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"flashsale/internal/domain"
+	"flashsale/internal/repository/repositoryiface"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const waitingRoomsKey = "wr:rooms"
+
+type WaitingRoomRedisRepo struct {
+	rdb   redis.UniversalClient
+	join  *redis.Script
+	admit *redis.Script
+	use   *redis.Script
+}
+
+// NewWaitingRoomRedisRepo loads waiting_room_*.lua from scriptDir
+func NewWaitingRoomRedisRepo(rdb redis.UniversalClient, scriptDir string) (repositoryiface.WaitingRoomRepository, error) {
+	join, err := os.ReadFile(filepath.Join(scriptDir, "waiting_room_join.lua"))
+	if err != nil {
+		return nil, fmt.Errorf("read waiting room join lua: %w", err)
+	}
+	admit, err := os.ReadFile(filepath.Join(scriptDir, "waiting_room_admit.lua"))
+	if err != nil {
+		return nil, fmt.Errorf("read waiting room admit lua: %w", err)
+	}
+	use, err := os.ReadFile(filepath.Join(scriptDir, "waiting_room_use.lua"))
+	if err != nil {
+		return nil, fmt.Errorf("read waiting room use lua: %w", err)
+	}
+	return &WaitingRoomRedisRepo{
+		rdb:   rdb,
+		join:  redis.NewScript(string(join)),
+		admit: redis.NewScript(string(admit)),
+		use:   redis.NewScript(string(use)),
+	}, nil
+}
+
+// keys of a room are hash tagged {product_id}, the join script uses them in one cluster slot
+
+func waitingRoomKey(productID string) string {
+	return fmt.Sprintf("wr:room:{%s}", productID)
+}
+
+func waitingRoomUserKey(productID, userID string) string {
+	return fmt.Sprintf("wr:room:{%s}:user:%s", productID, userID)
+}
+
+// issued ticket ids are "<product_id>.<id>", so the ticket key can be tagged by product
+func queueTicketID(productID, id string) string {
+	return productID + "." + id
+}
+
+func queueTicketKey(ticketID string) string {
+	productID, id, ok := strings.Cut(ticketID, ".")
+	if !ok {
+		// not issued by Join, the key just won't exist
+		return "wr:ticket:" + ticketID
+	}
+	return fmt.Sprintf("wr:ticket:{%s}:%s", productID, id)
+}
+
+func (r *WaitingRoomRedisRepo) Join(ctx context.Context, productID, userID, ticketID string, ttl time.Duration) (*domain.QueueTicket, error) {
+	// 1. issue the ticket
+	ticketID = queueTicketID(productID, ticketID)
+	keys := []string{
+		waitingRoomKey(productID),
+		waitingRoomUserKey(productID, userID),
+		queueTicketKey(ticketID),
+	}
+	id, err := r.join.Run(ctx, r.rdb, keys, ticketID, userID, productID, time.Now().Unix(), int64(ttl/time.Second)).Text()
+	if err != nil {
+		return nil, err
+	}
+	// 2. register the room for the admitter, other slot than the room keys
+	// after the script: the room exists, so Admit won't drop it as expired; a retried Join re-adds it
+	if err := r.rdb.SAdd(ctx, waitingRoomsKey, productID).Err(); err != nil {
+		return nil, err
+	}
+	t, err := r.GetTicket(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, fmt.Errorf("ticket %s expired right after join", id)
+	}
+	return t, nil
+}
+
+func (r *WaitingRoomRedisRepo) GetTicket(ctx context.Context, ticketID string) (*domain.QueueTicket, error) {
+	vals, err := r.rdb.HGetAll(ctx, queueTicketKey(ticketID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(vals) == 0 {
+		return nil, nil
+	}
+
+	t := &domain.QueueTicket{
+		ID:        ticketID,
+		UserID:    vals["user_id"],
+		ProductID: vals["product_id"],
+	}
+	t.Position, _ = strconv.ParseInt(vals["position"], 10, 64)
+	if v, err := strconv.ParseInt(vals["issued_at"], 10, 64); err == nil {
+		t.IssuedAt = time.Unix(v, 0)
+	}
+
+	admitted, err := r.rdb.HGet(ctx, waitingRoomKey(t.ProductID), "admitted").Int64()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	t.Admitted = admitted
+	return t, nil
+}
+
+func (r *WaitingRoomRedisRepo) UseTicket(ctx context.Context, t *domain.QueueTicket, requestKey string) (bool, error) {
+	keys := []string{queueTicketKey(t.ID), waitingRoomUserKey(t.ProductID, t.UserID)}
+	n, err := r.use.Run(ctx, r.rdb, keys, t.ID, requestKey).Int64()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (r *WaitingRoomRedisRepo) Admit(ctx context.Context, ratePerSec float64) error {
+	rooms, err := r.rdb.SMembers(ctx, waitingRoomsKey).Result()
+	if err != nil {
+		return err
+	}
+	for _, productID := range rooms {
+		admitted, err := r.admit.Run(ctx, r.rdb, []string{waitingRoomKey(productID)}, ratePerSec).Int64()
+		if err != nil {
+			return fmt.Errorf("admit room %s: %w", productID, err)
+		}
+		if admitted < 0 {
+			// room expired with its last ticket
+			r.rdb.SRem(ctx, waitingRoomsKey, productID)
+		}
+	}
+	return nil
+}
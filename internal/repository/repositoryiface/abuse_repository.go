@@ -0,0 +1,24 @@
+package repositoryiface
+
+import (
+	"context"
+	"flashsale/internal/domain"
+	"time"
+)
+
+type BlocklistRepository interface {
+	Block(ctx context.Context, e domain.BlockEntry) error
+	Unblock(ctx context.Context, kind domain.BlockKind, value string) error
+	// first matching entry of ip or user, nil,nil when neither is blocked
+	Find(ctx context.Context, ip, userID string) (*domain.BlockEntry, error)
+	// active entries, soonest expiry first
+	List(ctx context.Context) ([]domain.BlockEntry, error)
+}
+
+// AbuseSignalRepository keeps short-lived per IP / per user request history
+type AbuseSignalRepository interface {
+	// TrackIPUser adds userID to the users seen from ip within window, returns the distinct count
+	TrackIPUser(ctx context.Context, ip, userID string, window time.Duration) (int64, error)
+	// TrackUserRequest adds at to the user's latest keep request times, returns them newest first
+	TrackUserRequest(ctx context.Context, userID string, at time.Time, keep int, window time.Duration) ([]time.Time, error)
+}
@@ -0,0 +1,12 @@
+package repositoryiface
+
+import (
+	"context"
+	"flashsale/internal/domain"
+)
+
+type AuditLogRepository interface {
+	Record(ctx context.Context, e domain.AdminAuditEntry) error
+	// newest first
+	ListRecent(ctx context.Context, limit int) ([]domain.AdminAuditEntry, error)
+}
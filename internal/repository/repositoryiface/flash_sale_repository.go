@@ -10,6 +10,8 @@ type FlashSaleRepository interface {
 	// DB
 	GetActiveFlashSale(ctx context.Context) (*domain.FlashSale, error)
 	GetFlashSaleByID(ctx context.Context, id int64) (*domain.FlashSale, error)
+	// scheduled / active sales not ended at now, by start_at
+	ListUpcomingFlashSales(ctx context.Context, now time.Time) ([]domain.FlashSale, error)
 	GetFlashSaleProducts(ctx context.Context, flashSaleID int64) ([]domain.FlashSaleProduct, error)
 	GetFlashSaleProduct(ctx context.Context, flashSaleID int64, productID string) (*domain.FlashSaleProduct, error)
 	UpdateStatus(ctx context.Context, id int64, status domain.FlashSaleStatus) error
@@ -17,6 +19,8 @@ type FlashSaleRepository interface {
 
 type FlashSaleRedisRepository interface {
 	// Redis
+	// WarmUpStock splits the stock of products with StockBuckets > 1 into sub-counters,
+	// and sets StockBuckets of products to the layout actually in Redis
 	WarmUpStock(
 		ctx context.Context,
 		flashSale domain.FlashSale,
@@ -27,4 +31,15 @@ type FlashSaleRedisRepository interface {
 
 	SetActiveFlashSale(ctx context.Context, fs *domain.FlashSale, expiration time.Duration) error
 	GetActiveFlashSale(ctx context.Context) (*domain.FlashSale, error)
+
+	// sale price etc. of the sale products, so precheck doesn't read Postgres
+	SetSaleProducts(ctx context.Context, flashSaleID int64, products []domain.FlashSaleProduct, expiration time.Duration) error
+	// nil, nil on cache miss
+	GetSaleProduct(ctx context.Context, flashSaleID int64, productID string) (*domain.FlashSaleProduct, error)
+	// empty on cache miss
+	GetSaleProductIDs(ctx context.Context, flashSaleID int64) ([]int64, error)
+
+	// client catalog of active & upcoming sales, ok is false on cache miss
+	SetCatalog(ctx context.Context, sales []domain.CatalogSale, expiration time.Duration) error
+	GetCatalog(ctx context.Context) (sales []domain.CatalogSale, ok bool, err error)
 }
@@ -0,0 +1,18 @@
+package repositoryiface
+
+import (
+	"context"
+	"flashsale/internal/domain"
+	"time"
+)
+
+type IdempotencyRepository interface {
+	// Begin stores rec as pending if key is new and returns true,
+	// otherwise returns the existing record, nil if it expired in between
+	Begin(ctx context.Context, key string, rec domain.IdempotencyRecord, pendingTTL time.Duration) (bool, *domain.IdempotencyRecord, error)
+	// Get returns nil,nil when the key doesn't exist
+	Get(ctx context.Context, key string) (*domain.IdempotencyRecord, error)
+	Complete(ctx context.Context, key string, rec domain.IdempotencyRecord, ttl time.Duration) error
+	// Abandon drops a pending key so the client can retry, eg. after an internal error
+	Abandon(ctx context.Context, key string) error
+}
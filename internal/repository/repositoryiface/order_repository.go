@@ -3,12 +3,16 @@ package repositoryiface
 import (
 	"context"
 	"flashsale/internal/domain"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 )
 
 type OrderRepository interface {
 	CreatePendingOrder(ctx context.Context, orderNo, userID, productID string, flashSaleID int64, price int) error
+	// CreateOrderTx inserts o with its Status & FailReason, used when the worker creates the order (async mode)
+	// an existing order_no is left as is, ErrDuplicateOrder if the user has another active order of the product
+	CreateOrderTx(ctx context.Context, tx pgx.Tx, o *domain.Order) error
 	GetOrderStatus(ctx context.Context, orderNo string) (string, error)
 
 	BeginTx(ctx context.Context) (pgx.Tx, error)
@@ -16,8 +20,13 @@ type OrderRepository interface {
 	ReduceStockTx(ctx context.Context, tx pgx.Tx, productID string, qty int64) (bool, error)
 	MarkOrderSuccessTx(ctx context.Context, tx pgx.Tx, orderNo string) error
 	MarkOrderFailedTx(ctx context.Context, tx pgx.Tx, orderNo string, reason string) error
+	// UserSaleUsageTx counts the user's successful orders of the sale,
+	// holding a per user & sale lock until tx ends so concurrent orders can't both pass the limits
+	UserSaleUsageTx(ctx context.Context, tx pgx.Tx, flashSaleID int64, userID, productID string) (domain.UserSaleUsage, error)
 
 	GetByOrderNo(ctx context.Context, orderID string) (*domain.Order, error)
+	// newest first, keyset paginated on (created_at, id)
+	ListByUser(ctx context.Context, q domain.OrderListQuery) ([]domain.Order, error)
 
 	// decrease stock, return true if stock > 0 -> reduce success
 	// ReduceStock(ctx context.Context, productID string, qty int64) (bool, error)
@@ -25,10 +34,13 @@ type OrderRepository interface {
 	// check remaining stock
 	GetStock(ctx context.Context, productID string) (int64, error)
 
-	// distributed lock for stock reduction
-	AcquireStockLock(ctx context.Context, key string, ttlSeconds int) (bool, error)
-	ReleaseStockLock(ctx context.Context, key string) error
-
 	// MarkOrderSuccess(ctx context.Context, orderNo string) error
 	MarkOrderFailed(ctx context.Context, orderNo string, reason string) error
 }
+
+// OrderStatusCacheRepository keeps order status in Redis so result polling skips Postgres
+type OrderStatusCacheRepository interface {
+	SaveStatus(ctx context.Context, snap domain.OrderStatusSnapshot, ttl time.Duration) error
+	// GetStatus returns nil, nil on cache miss
+	GetStatus(ctx context.Context, orderNo string) (*domain.OrderStatusSnapshot, error)
+}
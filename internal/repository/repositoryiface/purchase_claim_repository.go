@@ -0,0 +1,10 @@
+package repositoryiface
+
+import "context"
+
+// PurchaseClaimRepository gives back the user's product slot claimed at precheck
+type PurchaseClaimRepository interface {
+	// Release the slot if orderID still owns it, no-op otherwise
+	// buckets: stock layout of the product, picks the user's claim partition
+	Release(ctx context.Context, productID, userID, orderID string, buckets int) error
+}
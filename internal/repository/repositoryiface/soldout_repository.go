@@ -0,0 +1,17 @@
+package repositoryiface
+
+import (
+	"context"
+	"flashsale/internal/domain"
+	"time"
+)
+
+// SoldOutRepository keeps the sold out products of each sale and broadcasts changes
+type SoldOutRepository interface {
+	// Mark / Clear publish an event only when the flag actually changes
+	Mark(ctx context.Context, flashSaleID int64, productID string, ttl time.Duration) error
+	Clear(ctx context.Context, flashSaleID int64, productID string) error
+	List(ctx context.Context, flashSaleID int64) ([]string, error)
+	// Subscribe calls fn for every event until ctx is done or the connection fails
+	Subscribe(ctx context.Context, fn func(domain.SoldOutEvent)) error
+}
@@ -0,0 +1,9 @@
+package repositoryiface
+
+import "context"
+
+// StockLockRepository: distributed lock around the worker's stock reduction
+type StockLockRepository interface {
+	AcquireStockLock(ctx context.Context, key string, ttlSeconds int) (bool, error)
+	ReleaseStockLock(ctx context.Context, key string) error
+}
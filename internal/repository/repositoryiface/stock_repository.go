@@ -1,11 +1,30 @@
 package repositoryiface
 
-import "context"
+import (
+	"context"
+	"flashsale/internal/domain"
+	"time"
+)
 
 type StockRepository interface {
 	GetStock(ctx context.Context, productID int64) (int64, error)
+	// all products of the sale, empty if the sale has none
+	GetSaleStocks(ctx context.Context, flashSaleID int64) ([]domain.ProductStock, error)
 }
 
 type RedisStockRepository interface {
-	RestoreStock(ctx context.Context, productID string, qty int) error
+	// buckets: stock sub-counters of the product, 0/1 = single key
+	RestoreStock(ctx context.Context, productID string, buckets, qty int) error
+	// DecrStock takes 1 from a random bucket with stock left, remaining is > 0 while the product has stock
+	// and the total of all buckets once the deducted bucket is empty
+	DecrStock(ctx context.Context, productID string, buckets int) (deducted bool, remaining int64, err error)
+	// ClearStock sets all counters to 0, when the DB has no stock left
+	ClearStock(ctx context.Context, productID string, buckets int) error
+	// GetStocks reads the live stock (buckets summed), or the cached DB value if the live key is missing
+	// products found in neither are left out
+	GetStocks(ctx context.Context, productIDs []int64) (map[int64]int64, error)
+	// GetLiveStocks reads the counters precheck & worker use (buckets summed), never the cached DB value
+	GetLiveStocks(ctx context.Context, productIDs []int64) (map[int64]int64, error)
+	// CacheStocks keeps DB values for reads only, precheck never sees them
+	CacheStocks(ctx context.Context, stocks []domain.ProductStock, ttl time.Duration) error
 }
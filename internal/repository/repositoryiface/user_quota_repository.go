@@ -0,0 +1,14 @@
+package repositoryiface
+
+import (
+	"context"
+	"time"
+)
+
+// UserQuotaRepository reserves & gives back per user sale limits
+type UserQuotaRepository interface {
+	// Reserve one item of productID, false when it would exceed maxItems / maxProducts (0 = unlimited)
+	Reserve(ctx context.Context, saleID int64, userID, productID string, maxItems, maxProducts int64, ttl time.Duration) (bool, error)
+	// Release one item of productID, no-op when nothing is reserved
+	Release(ctx context.Context, saleID int64, userID, productID string) error
+}
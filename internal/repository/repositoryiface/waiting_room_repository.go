@@ -0,0 +1,19 @@
+package repositoryiface
+
+import (
+	"context"
+	"flashsale/internal/domain"
+	"time"
+)
+
+type WaitingRoomRepository interface {
+	// Join issues ticketID for user, or returns the user's existing ticket of the room
+	Join(ctx context.Context, productID, userID, ticketID string, ttl time.Duration) (*domain.QueueTicket, error)
+	// nil,nil when the ticket doesn't exist or expired
+	GetTicket(ctx context.Context, ticketID string) (*domain.QueueTicket, error)
+	// UseTicket marks an admitted ticket used by the request with requestKey and frees the user's place
+	// false if another request used it already, the same non-empty requestKey may use it again
+	UseTicket(ctx context.Context, t *domain.QueueTicket, requestKey string) (bool, error)
+	// Admit releases tickets of every room at ratePerSec, based on Redis time so all instances can run it
+	Admit(ctx context.Context, ratePerSec float64) error
+}
@@ -1,30 +1,21 @@
 package router
 
 import (
-	"flashsale/internal/cache"
+	"expvar"
+	"flashsale/internal/abuse"
+	"flashsale/internal/auth"
 	"flashsale/internal/handler"
 	"flashsale/internal/middleware"
+	"flashsale/internal/service"
 
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRouter(warmUpHandler *handler.WarmUpHandler, orderHandler *handler.OrderHandler, stockHandler *handler.StockHandler, resultHandler *handler.OrderResultHandler) *gin.Engine {
+func SetupRouter(warmUpHandler *handler.WarmUpHandler, orderHandler *handler.OrderHandler, stockHandler *handler.StockHandler, resultHandler *handler.OrderResultHandler, orderListHandler *handler.OrderListHandler, auditHandler *handler.AdminAuditHandler, authenticator *auth.Authenticator, auditService *service.AdminAuditService, limiter *middleware.RateLimiter, abuseHandler *handler.AbuseHandler, abuseService *abuse.Service, waitingRoomHandler *handler.WaitingRoomHandler, catalogHandler *handler.CatalogHandler, soldOutEventsHandler *handler.SoldOutEventsHandler) *gin.Engine {
 	r := gin.Default()
 
-	// // load token bucket lua
-	// tb, err := cache.LoadTokenBucketLua("./scripts/rate_limit_token_bucket.lua")
-	// if err != nil {
-	// 	panic(err)
-	// }
-
-	// middleware.InitTokenBucketLimiter(tb)
-
-	// load hybrid lua
-	hl, err := cache.LoadHybridLimiter(cache.Rdb, "./scripts/rate_limit_hybrid.lua")
-	if err != nil {
-		panic(err)
-	}
-	middleware.InitHybridLimiter(hl)
+	// verified identity from bearer token, required before user limiters
+	authn := middleware.Authenticate(authenticator)
 
 	// health check
 	// r.GET("/health", func(c *gin.Context) {
@@ -32,27 +23,62 @@ func SetupRouter(warmUpHandler *handler.WarmUpHandler, orderHandler *handler.Ord
 	// })
 
 	// Precheck endpoint
-	// r.POST("/flashsale/precheck", middleware.UserRateLimit(), orderHandler.PreCheck)
+	// r.POST("/flashsale/precheck", limiter.UserRateLimit("precheck"), orderHandler.PreCheck)
 
 	flash := r.Group("/flashsale")
 	{
 		flash.POST("/precheck",
-			middleware.UserHybridLimiter(20, 10, 50, 5),
-			// middleware.UserTokenBucket(5, 3), // burst: 5, refill: 3 tokens/sec
+			authn,
+			limiter.LayeredHybridLimiter("precheck"),
+			// limiter.UserTokenBucket("precheck"),
+			middleware.AbuseGuard(abuseService),
 			orderHandler.PreCheck)
-		flash.POST("/stock/:product_id",
-			middleware.UserHybridLimiter(20, 10, 50, 5),
+		flash.GET("/catalog",
+			limiter.LayeredHybridLimiter("catalog"),
+			catalogHandler.GetCatalog)
+		flash.GET("/events",
+			limiter.LayeredHybridLimiter("catalog"),
+			soldOutEventsHandler.Stream)
+		flash.GET("/stock/:product_id",
+			limiter.LayeredHybridLimiter("stock"),
 			stockHandler.GetStock)
+		flash.GET("/:sale_id/stock",
+			limiter.LayeredHybridLimiter("stock"),
+			stockHandler.GetSaleStock)
 		flash.GET("/result/:order_id",
-			middleware.UserHybridLimiter(5, 2, 10, 1),
+			authn,
+			limiter.LayeredHybridLimiter("result"),
 			resultHandler.GetResult)
+		flash.GET("/orders",
+			authn,
+			limiter.LayeredHybridLimiter("orders"),
+			orderListHandler.ListMyOrders)
+
+		// waiting room, only when enabled
+		if waitingRoomHandler != nil {
+			flash.POST("/queue/join",
+				authn,
+				limiter.LayeredHybridLimiter("queue"),
+				waitingRoomHandler.Join)
+			flash.GET("/queue/:ticket_id",
+				authn,
+				limiter.LayeredHybridLimiter("queue"),
+				waitingRoomHandler.Status)
+		}
 
 	}
 
-	admin := r.Group("/admin")
+	// audit first, so 403 attempts are recorded as well, 401s are only counted
+	admin := r.Group("/admin", middleware.AdminAudit(auditService), authn, middleware.RequireRole(auth.RoleViewer))
 	{
 		// POST /admin/flashsales/{id}/warmup
-		admin.POST("/flashsales/:id/warmup", warmUpHandler.WarmUp)
+		admin.POST("/flashsales/:id/warmup", middleware.RequireRole(auth.RoleOperator), warmUpHandler.WarmUp)
+		admin.GET("/audit-logs", auditHandler.ListRecent)
+		// limiter breaker state & fallback counters, expvar also dumps cmdline & memstats
+		admin.GET("/debug/vars", middleware.RequireRole(auth.RoleOperator), gin.WrapH(expvar.Handler()))
+		admin.GET("/abuse/blocks", abuseHandler.ListBlocks)
+		admin.POST("/abuse/blocks", middleware.RequireRole(auth.RoleOperator), abuseHandler.Block)
+		admin.DELETE("/abuse/blocks/:kind/:value", middleware.RequireRole(auth.RoleOperator), abuseHandler.Unblock)
 	}
 	return r
 }
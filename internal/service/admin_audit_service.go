@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"expvar"
+	"flashsale/internal/domain"
+	"flashsale/internal/repository/repositoryiface"
+	"log"
+	"time"
+)
+
+const (
+	maxAuditPageSize = 200
+	// entries waiting for the writer, a slow / down DB drops above this instead of blocking admin requests
+	auditQueueSize = 1024
+	// how long Run keeps writing queued entries after ctx is done
+	auditDrainTimeout = 3 * time.Second
+)
+
+// audit counters, exposed on /admin/debug/vars
+var auditMetrics = expvar.NewMap("admin_audit")
+
+type AdminAuditService struct {
+	repo         repositoryiface.AuditLogRepository
+	queue        chan domain.AdminAuditEntry
+	drainTimeout time.Duration
+}
+
+func NewAdminAuditService(repo repositoryiface.AuditLogRepository) *AdminAuditService {
+	return &AdminAuditService{
+		repo:         repo,
+		queue:        make(chan domain.AdminAuditEntry, auditQueueSize),
+		drainTimeout: auditDrainTimeout,
+	}
+}
+
+// Enqueue hands e to the writer started by Run, never blocks
+// false if the queue is full, the entry is dropped and counted
+func (s *AdminAuditService) Enqueue(e domain.AdminAuditEntry) bool {
+	select {
+	case s.queue <- e:
+		return true
+	default:
+		auditMetrics.Add("dropped", 1)
+		log.Printf("[admin audit] warn: queue full, dropped action=%s actor=%s", e.Action, e.Actor)
+		return false
+	}
+}
+
+// CountUnauthenticated counts an admin request without identity, those get no row
+// so a flood of unauthenticated requests can't fill the table or the DB pool
+func (s *AdminAuditService) CountUnauthenticated() {
+	auditMetrics.Add("unauthenticated", 1)
+}
+
+// Run writes queued entries one by one until ctx is done, then drains the queue for a short while
+func (s *AdminAuditService) Run(ctx context.Context) {
+	// writes outlive ctx by drainTimeout, a write in flight at shutdown included
+	writeCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+	context.AfterFunc(ctx, func() { time.AfterFunc(s.drainTimeout, cancel) })
+	for {
+		select {
+		case <-ctx.Done():
+			s.drain(writeCtx)
+			return
+		case e := <-s.queue:
+			s.write(writeCtx, e)
+		}
+	}
+}
+
+// drain writes what was queued before shutdown, entries left at the deadline are dropped & counted
+func (s *AdminAuditService) drain(ctx context.Context) {
+	for ctx.Err() == nil {
+		select {
+		case e := <-s.queue:
+			s.write(ctx, e)
+		default:
+			return
+		}
+	}
+	if n := len(s.queue); n > 0 {
+		auditMetrics.Add("dropped", int64(n))
+		log.Printf("[admin audit] warn: shutdown, dropped %d queued entries", n)
+	}
+}
+
+func (s *AdminAuditService) write(ctx context.Context, e domain.AdminAuditEntry) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	if err := s.repo.Record(ctx, e); err != nil {
+		auditMetrics.Add("failed", 1)
+		log.Printf("[admin audit] record failed action=%s actor=%s: %v", e.Action, e.Actor, err)
+	}
+}
+
+func (s *AdminAuditService) ListRecent(ctx context.Context, limit int) ([]domain.AdminAuditEntry, error) {
+	if limit <= 0 || limit > maxAuditPageSize {
+		limit = maxAuditPageSize
+	}
+	return s.repo.ListRecent(ctx, limit)
+}
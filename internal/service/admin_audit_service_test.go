@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"flashsale/internal/domain"
+	"testing"
+	"time"
+)
+
+// fakeAuditRepo hands recorded entries to the test
+type fakeAuditRepo struct {
+	recorded chan domain.AdminAuditEntry
+	err      error
+}
+
+func (r *fakeAuditRepo) Record(ctx context.Context, e domain.AdminAuditEntry) error {
+	r.recorded <- e
+	return r.err
+}
+
+func (r *fakeAuditRepo) ListRecent(ctx context.Context, limit int) ([]domain.AdminAuditEntry, error) {
+	return nil, nil
+}
+
+func TestAdminAuditQueueWrites(t *testing.T) {
+	repo := &fakeAuditRepo{recorded: make(chan domain.AdminAuditEntry, 1), err: errors.New("db down")}
+	svc := NewAdminAuditService(repo)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go svc.Run(ctx)
+
+	// a failed write doesn't stop the writer
+	for _, action := range []string{"GET /admin/audit-logs", "POST /admin/abuse/blocks"} {
+		if !svc.Enqueue(domain.AdminAuditEntry{Action: action, Actor: "A1"}) {
+			t.Fatalf("enqueue %s dropped", action)
+		}
+		select {
+		case e := <-repo.recorded:
+			if e.Action != action {
+				t.Fatalf("recorded %q, want %q", e.Action, action)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s not written", action)
+		}
+	}
+}
+
+func TestAdminAuditQueueFullDrops(t *testing.T) {
+	// no writer running, the queue only fills
+	svc := NewAdminAuditService(&fakeAuditRepo{})
+	for i := 0; i < auditQueueSize; i++ {
+		if !svc.Enqueue(domain.AdminAuditEntry{Actor: "A1"}) {
+			t.Fatalf("entry %d dropped before the queue was full", i)
+		}
+	}
+	done := make(chan bool)
+	go func() { done <- svc.Enqueue(domain.AdminAuditEntry{Actor: "A1"}) }()
+	select {
+	case ok := <-done:
+		if ok {
+			t.Fatal("entry queued beyond the queue size")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Enqueue blocked on a full queue")
+	}
+}
+
+func TestAdminAuditRunDrainsOnShutdown(t *testing.T) {
+	repo := &fakeAuditRepo{recorded: make(chan domain.AdminAuditEntry, 3)}
+	svc := NewAdminAuditService(repo)
+	// queued while the writer was busy, then the server shuts down
+	for _, actor := range []string{"A1", "A2", "A3"} {
+		svc.Enqueue(domain.AdminAuditEntry{Actor: actor})
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	svc.Run(ctx)
+
+	if len(repo.recorded) != 3 {
+		t.Fatalf("recorded %d entries on shutdown, want 3", len(repo.recorded))
+	}
+}
+
+// blockingAuditRepo is a DB that never answers
+type blockingAuditRepo struct{ fakeAuditRepo }
+
+func (r *blockingAuditRepo) Record(ctx context.Context, e domain.AdminAuditEntry) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestAdminAuditDrainDeadline(t *testing.T) {
+	svc := NewAdminAuditService(&blockingAuditRepo{})
+	svc.drainTimeout = 50 * time.Millisecond
+	for i := 0; i < 10; i++ {
+		svc.Enqueue(domain.AdminAuditEntry{Actor: "A1"})
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		svc.Run(ctx)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run didn't stop at the drain deadline")
+	}
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"flashsale/internal/domain"
+	"flashsale/internal/dto"
+	"flashsale/internal/repository/repositoryiface"
+	"log"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// a shared build serves every waiting caller, so it runs on its own deadline instead of the first caller's ctx
+const catalogBuildTimeout = 3 * time.Second
+
+// CatalogService is the public list of active & upcoming sales
+// lookup order: in-process cache -> Redis (written by warm-up) -> Postgres
+type CatalogService struct {
+	db    repositoryiface.FlashSaleRepository
+	redis repositoryiface.FlashSaleRedisRepository
+	stock repositoryiface.RedisStockRepository
+	// CATALOG_CACHE_TTL, of the in-process response & the Redis sale list backfilled on a miss
+	ttl time.Duration
+
+	group   singleflight.Group
+	mu      sync.RWMutex
+	sales   []dto.CatalogSale
+	expires time.Time
+}
+
+func NewCatalogService(db repositoryiface.FlashSaleRepository, redis repositoryiface.FlashSaleRedisRepository, stock repositoryiface.RedisStockRepository, ttl time.Duration) *CatalogService {
+	return &CatalogService{db: db, redis: redis, stock: stock, ttl: ttl}
+}
+
+func (s *CatalogService) Catalog(ctx context.Context) (*dto.Catalog, error) {
+	now := time.Now()
+	s.mu.RLock()
+	sales, fresh := s.sales, now.Before(s.expires)
+	s.mu.RUnlock()
+
+	if !fresh {
+		v, err, _ := s.group.Do("catalog", func() (any, error) {
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), catalogBuildTimeout)
+			defer cancel()
+			sales, err := s.build(ctx)
+			if err != nil {
+				return nil, err
+			}
+			s.mu.Lock()
+			s.sales, s.expires = sales, time.Now().Add(s.ttl)
+			s.mu.Unlock()
+			return sales, nil
+		})
+		if err != nil {
+			return nil, internal(err)
+		}
+		sales = v.([]dto.CatalogSale)
+	}
+	return &dto.Catalog{ServerTime: now, Sales: sales}, nil
+}
+
+// build reads the cached sales and stamps state & stock bands
+func (s *CatalogService) build(ctx context.Context) ([]dto.CatalogSale, error) {
+	cached, ok, err := s.redis.GetCatalog(ctx)
+	if err != nil {
+		log.Printf("[catalog] warn: redis catalog read failed: %v", err)
+	}
+	if !ok {
+		if cached, err = loadCatalog(ctx, s.db); err != nil {
+			return nil, err
+		}
+		if err := s.redis.SetCatalog(ctx, cached, s.ttl); err != nil {
+			log.Printf("[catalog] warn: catalog backfill failed: %v", err)
+		}
+	}
+
+	var ids []int64
+	for _, cs := range cached {
+		for _, p := range cs.Products {
+			ids = append(ids, p.ProductID)
+		}
+	}
+	stocks := map[int64]int64{}
+	if len(ids) > 0 {
+		if stocks, err = s.stock.GetStocks(ctx, ids); err != nil {
+			// bands from the cached sale stock, better than no catalog
+			log.Printf("[catalog] warn: redis stock read failed: %v", err)
+			stocks = map[int64]int64{}
+		}
+	}
+
+	now := time.Now()
+	res := make([]dto.CatalogSale, 0, len(cached))
+	for _, cs := range cached {
+		fs := cs.Sale
+		if !now.Before(fs.EndAt) {
+			continue
+		}
+		state := "upcoming"
+		if fs.IsActive(now) {
+			state = "active"
+		}
+		sale := dto.CatalogSale{
+			ID:       fs.ID,
+			Name:     fs.Name,
+			State:    state,
+			StartAt:  fs.StartAt,
+			EndAt:    fs.EndAt,
+			Products: make([]dto.CatalogProduct, 0, len(cs.Products)),
+		}
+		for _, p := range cs.Products {
+			stock, ok := stocks[p.ProductID]
+			if !ok {
+				stock = int64(p.SaleStock) // not warmed up yet
+			}
+			sale.Products = append(sale.Products, dto.CatalogProduct{
+				ProductID: p.ProductID,
+				SalePrice: p.SalePrice,
+				Stock:     string(domain.BandOf(stock, int64(p.SaleStock))),
+			})
+		}
+		res = append(res, sale)
+	}
+	return res, nil
+}
+
+// loadCatalog reads active & upcoming sales with their products from Postgres
+func loadCatalog(ctx context.Context, db repositoryiface.FlashSaleRepository) ([]domain.CatalogSale, error) {
+	sales, err := db.ListUpcomingFlashSales(ctx, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.CatalogSale, 0, len(sales))
+	for _, fs := range sales {
+		products, err := db.GetFlashSaleProducts(ctx, fs.ID)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, domain.CatalogSale{Sale: fs, Products: products})
+	}
+	return res, nil
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"flashsale/internal/cache"
+	"flashsale/internal/domain"
+	"flashsale/internal/dto"
+	"flashsale/internal/repository/redis"
+	"flashsale/internal/repository/repositoryiface"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// fakeCatalogDB lists sales with their products, counts list reads
+type fakeCatalogDB struct {
+	repositoryiface.FlashSaleRepository
+	sales    []domain.FlashSale
+	products map[int64][]domain.FlashSaleProduct
+	lists    int
+	// set: list reads wait for release and fail with the ctx error they got
+	started, release chan struct{}
+}
+
+func (f *fakeCatalogDB) ListUpcomingFlashSales(ctx context.Context, now time.Time) ([]domain.FlashSale, error) {
+	f.lists++
+	if f.release != nil {
+		close(f.started)
+		<-f.release
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return f.sales, nil
+}
+
+func (f *fakeCatalogDB) GetFlashSaleProducts(ctx context.Context, flashSaleID int64) ([]domain.FlashSaleProduct, error) {
+	return f.products[flashSaleID], nil
+}
+
+type catalogEnv struct {
+	mr  *miniredis.Miniredis
+	db  *fakeCatalogDB
+	svc *CatalogService
+}
+
+func newCatalogEnv(t *testing.T, ttl time.Duration) *catalogEnv {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	redisStock, err := redis.NewRedisStockRepo(rdb, "../../scripts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	db := &fakeCatalogDB{
+		sales:    []domain.FlashSale{{ID: 7, Name: "noon", Status: domain.StatusActive, StartAt: now.Add(-time.Minute), EndAt: now.Add(time.Hour)}},
+		products: map[int64][]domain.FlashSaleProduct{7: {{FlashSaleID: 7, ProductID: 1, SaleStock: 100, SalePrice: 990}}},
+	}
+	return &catalogEnv{mr: mr, db: db, svc: NewCatalogService(db, redis.NewFlashSaleRedisRepo(rdb), redisStock, ttl)}
+}
+
+func TestCatalogBuildOutlivesCaller(t *testing.T) {
+	env := newCatalogEnv(t, 10*time.Second)
+	env.db.started, env.db.release = make(chan struct{}), make(chan struct{})
+
+	// the caller leading the shared build goes away mid-read
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-env.db.started
+		cancel()
+		close(env.db.release)
+	}()
+	c, err := env.svc.Catalog(ctx)
+	if err != nil || len(c.Sales) != 1 {
+		t.Fatalf("catalog = %+v, %v", c, err)
+	}
+	if _, err := env.svc.Catalog(context.Background()); err != nil || env.db.lists != 1 {
+		t.Fatalf("second catalog = %v, %d DB reads", err, env.db.lists)
+	}
+	// the Redis backfill lives as long as the in-process copy
+	if ttl := env.mr.TTL("flashsale:catalog"); ttl != 10*time.Second {
+		t.Fatalf("redis catalog ttl = %v, want CATALOG_CACHE_TTL", ttl)
+	}
+}
+
+func TestCatalogBands(t *testing.T) {
+	env := newCatalogEnv(t, 10*time.Second)
+	ctx := context.Background()
+	now := time.Now()
+	env.db.sales = []domain.FlashSale{
+		{ID: 7, Name: "noon", Status: domain.StatusActive, StartAt: now.Add(-time.Minute), EndAt: now.Add(time.Hour)},
+		{ID: 8, Name: "night", Status: domain.StatusScheduled, StartAt: now.Add(time.Hour), EndAt: now.Add(2 * time.Hour)},
+	}
+	env.db.products = map[int64][]domain.FlashSaleProduct{
+		7: {
+			{ProductID: 1, SaleStock: 100, SalePrice: 990},
+			{ProductID: 2, SaleStock: 100},
+			{ProductID: 3, SaleStock: 100},
+			{ProductID: 4, SaleStock: 20},
+		},
+		// not warmed up yet, bands from the sale stock
+		8: {{ProductID: 5, SaleStock: 3}, {ProductID: 6, SaleStock: 50}},
+	}
+	// few left: 10% of the sale stock, at least 5
+	env.mr.Set(cache.StockKey("1"), "11")
+	env.mr.Set(cache.StockKey("2"), "10")
+	env.mr.Set(cache.StockKey("3"), "0")
+	env.mr.Set(cache.StockKey("4"), "5")
+
+	c, err := env.svc.Catalog(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bands := map[int64]string{}
+	states := map[int64]string{}
+	for _, s := range c.Sales {
+		states[s.ID] = s.State
+		for _, p := range s.Products {
+			bands[p.ProductID] = p.Stock
+		}
+	}
+	wantBands := map[int64]string{1: "plenty", 2: "few_left", 3: "sold_out", 4: "few_left", 5: "few_left", 6: "plenty"}
+	if !reflect.DeepEqual(bands, wantBands) {
+		t.Fatalf("bands = %v, want %v", bands, wantBands)
+	}
+	if !reflect.DeepEqual(states, map[int64]string{7: "active", 8: "upcoming"}) {
+		t.Fatalf("states = %v", states)
+	}
+	if p := c.Sales[0].Products[0]; p != (dto.CatalogProduct{ProductID: 1, SalePrice: 990, Stock: "plenty"}) {
+		t.Fatalf("product = %+v", p)
+	}
+}
+
+func TestCatalogCaches(t *testing.T) {
+	env := newCatalogEnv(t, 10*time.Second)
+	ctx := context.Background()
+	env.mr.Set(cache.StockKey("1"), "50")
+
+	if _, err := env.svc.Catalog(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// in-process copy: stock changes show after the ttl
+	env.mr.Set(cache.StockKey("1"), "0")
+	c, err := env.svc.Catalog(ctx)
+	if err != nil || c.Sales[0].Products[0].Stock != "plenty" {
+		t.Fatalf("cached catalog = %+v, %v", c, err)
+	}
+
+	// another instance reads the Redis copy, no DB
+	other := NewCatalogService(env.db, env.svc.redis, env.svc.stock, env.svc.ttl)
+	c, err = other.Catalog(ctx)
+	if err != nil || c.Sales[0].Products[0].Stock != "sold_out" || env.db.lists != 1 {
+		t.Fatalf("other instance = %+v, %v, %d DB reads", c, err, env.db.lists)
+	}
+
+	// a sale that ended while its Redis copy lives drops out
+	ended := env.db.sales[0]
+	ended.EndAt = time.Now().Add(-time.Second)
+	if err := env.svc.redis.SetCatalog(ctx, []domain.CatalogSale{{Sale: ended}}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	other = NewCatalogService(env.db, env.svc.redis, env.svc.stock, env.svc.ttl)
+	if c, err := other.Catalog(ctx); err != nil || len(c.Sales) != 0 {
+		t.Fatalf("ended sale = %+v, %v", c, err)
+	}
+}
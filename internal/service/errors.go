@@ -0,0 +1,83 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrorCode is the machine readable code clients get in the error envelope
+type ErrorCode string
+
+const (
+	CodeSaleNotActive        ErrorCode = "SALE_NOT_ACTIVE"
+	CodeSaleNotStarted       ErrorCode = "SALE_NOT_STARTED"
+	CodeSaleNotFound         ErrorCode = "SALE_NOT_FOUND"
+	CodeStockNotFound        ErrorCode = "STOCK_NOT_FOUND"
+	CodeOutOfStock           ErrorCode = "OUT_OF_STOCK"
+	CodeUserAlreadyPurchased ErrorCode = "USER_ALREADY_PURCHASED"
+	CodeUserLimitExceeded    ErrorCode = "USER_LIMIT_EXCEEDED"
+	CodeServiceUnavailable   ErrorCode = "SERVICE_UNAVAILABLE"
+	CodeInternal             ErrorCode = "INTERNAL"
+)
+
+// Error is a business outcome or a failure with a stable code,
+// the cause is for logs only and never sent to clients
+type Error struct {
+	Code    ErrorCode
+	Message string
+	cause   error
+}
+
+func (e *Error) Error() string {
+	if e.cause != nil {
+		return fmt.Sprintf("%s: %v", e.Code, e.cause)
+	}
+	return string(e.Code)
+}
+
+func (e *Error) Unwrap() error { return e.cause }
+
+// Is matches by code, so errors.Is(err, ErrOutOfStock) works for wrapped copies
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// catalog
+var (
+	ErrSaleNotActive        = &Error{Code: CodeSaleNotActive, Message: "flash sale not active"}
+	ErrSaleNotStarted       = &Error{Code: CodeSaleNotStarted, Message: "flash sale not started yet"}
+	ErrSaleNotFound         = &Error{Code: CodeSaleNotFound, Message: "flash sale not found"}
+	ErrStockNotFound        = &Error{Code: CodeStockNotFound, Message: "product not in this flash sale"}
+	ErrSoldOut              = &Error{Code: CodeOutOfStock, Message: "sold out"}
+	ErrUserAlreadyPurchased = &Error{Code: CodeUserAlreadyPurchased, Message: "user already purchased this product"}
+	ErrUserLimitExceeded    = &Error{Code: CodeUserLimitExceeded, Message: "user purchase limit of this sale reached"}
+	ErrServiceUnavailable   = &Error{Code: CodeServiceUnavailable, Message: "service temporarily unavailable, retry later"}
+	ErrInternal             = &Error{Code: CodeInternal, Message: "internal server error"}
+)
+
+// precheck Lua reasons
+var precheckReasonErrors = map[string]*Error{
+	"STOCK_NOT_FOUND":        ErrStockNotFound,
+	"OUT_OF_STOCK":           ErrSoldOut,
+	"USER_ALREADY_PURCHASED": ErrUserAlreadyPurchased,
+	"USER_LIMIT_EXCEEDED":    ErrUserLimitExceeded,
+}
+
+// unavailable: a dependency (Redis / MQ) failed, retrying later may work
+func unavailable(cause error) *Error {
+	return &Error{Code: CodeServiceUnavailable, Message: ErrServiceUnavailable.Message, cause: cause}
+}
+
+func internal(cause error) *Error {
+	return &Error{Code: CodeInternal, Message: ErrInternal.Message, cause: cause}
+}
+
+// AsError returns the catalog error of err, anything unknown is internal
+func AsError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return internal(err)
+}
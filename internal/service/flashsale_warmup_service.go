@@ -2,45 +2,62 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"time"
 
 	"flashsale/internal/domain"
 	"flashsale/internal/repository/repositoryiface"
+
+	"github.com/jackc/pgx/v5"
 )
 
 type FlashSaleWarmUpService struct {
 	dbRepo    repositoryiface.FlashSaleRepository
 	redisRepo repositoryiface.FlashSaleRedisRepository
+	// stock sub-counters per product, <= 1 = single key
+	stockBuckets int
+	// TTL of the client catalog written after each warm-up
+	catalogTTL time.Duration
 }
 
 func NewFlashSaleWarmUpService(
 	dbRepo repositoryiface.FlashSaleRepository,
 	redisRepo repositoryiface.FlashSaleRedisRepository,
+	stockBuckets int,
+	catalogTTL time.Duration,
 ) *FlashSaleWarmUpService {
 	return &FlashSaleWarmUpService{
-		dbRepo:    dbRepo,
-		redisRepo: redisRepo,
+		dbRepo:       dbRepo,
+		redisRepo:    redisRepo,
+		stockBuckets: stockBuckets,
+		catalogTTL:   catalogTTL,
 	}
 }
 
 func (s *FlashSaleWarmUpService) WarmUpByID(ctx context.Context, id int64) error {
 	// 1. get flashsale info
 	fs, err := s.dbRepo.GetFlashSaleByID(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrSaleNotFound
+	}
 	if err != nil {
 		return err
 	}
 
 	// if flashsale isActive, run Redis warm-up
 	if fs.Status == domain.StatusEnded {
-		return fmt.Errorf("sale ended, cannot warm-up")
+		return ErrSaleNotActive
 	}
 
 	products, err := s.dbRepo.GetFlashSaleProducts(ctx, fs.ID)
 	if err != nil {
 		return err
 	}
+	for i := range products {
+		products[i].StockBuckets = s.stockBuckets
+	}
 
 	// run redis warmup(Exists checking within)
 	if err := s.redisRepo.WarmUpStock(ctx, *fs, products); err != nil {
@@ -48,6 +65,10 @@ func (s *FlashSaleWarmUpService) WarmUpByID(ctx context.Context, id int64) error
 	}
 
 	ttl := fs.TTL(time.Now())
+	// sale prices for precheck, it falls back to DB on miss
+	if err := s.redisRepo.SetSaleProducts(ctx, fs.ID, products, ttl); err != nil {
+		log.Printf("[warmup] warn: sale products cache update failed: %v", err)
+	}
 	if err := s.redisRepo.SetActiveFlashSale(ctx, fs, ttl); err != nil {
 		// log & no interrupt process, warm-up is successful
 		log.Printf("[warmup] warn: flashsale info cache update failed: %v", err)
@@ -64,6 +85,7 @@ func (s *FlashSaleWarmUpService) WarmUpByID(ctx context.Context, id int64) error
 		log.Printf("[warmup] flashsale %d status activated", id)
 	}
 
+	s.refreshCatalog(ctx)
 	return nil
 }
 
@@ -82,12 +104,36 @@ func (s *FlashSaleWarmUpService) WarmUp(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	for i := range products {
+		products[i].StockBuckets = s.stockBuckets
+	}
 
 	// Pass the pointer if necessary, or dereference as you did
 	if err := s.redisRepo.WarmUpStock(ctx, *fs, products); err != nil {
 		return err
 	}
 
+	// sale info & prices for precheck, it falls back to DB on miss
+	ttl := fs.TTL(time.Now())
+	if err := s.redisRepo.SetActiveFlashSale(ctx, fs, ttl); err != nil {
+		log.Printf("[warmup] warn: flashsale info cache update failed: %v", err)
+	}
+	if err := s.redisRepo.SetSaleProducts(ctx, fs.ID, products, ttl); err != nil {
+		log.Printf("[warmup] warn: sale products cache update failed: %v", err)
+	}
+
 	log.Printf("[warmup] success flash_sale=%d products=%d", fs.ID, len(products))
+	s.refreshCatalog(ctx)
 	return nil
 }
+
+// refreshCatalog rewrites the client catalog, API instances pick it up within CATALOG_CACHE_TTL
+func (s *FlashSaleWarmUpService) refreshCatalog(ctx context.Context) {
+	sales, err := loadCatalog(ctx, s.dbRepo)
+	if err == nil {
+		err = s.redisRepo.SetCatalog(ctx, sales, s.catalogTTL)
+	}
+	if err != nil {
+		log.Printf("[warmup] warn: catalog cache update failed: %v", err)
+	}
+}
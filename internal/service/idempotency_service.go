@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"flashsale/internal/domain"
+	"flashsale/internal/repository/repositoryiface"
+	"log"
+	"time"
+)
+
+var (
+	ErrIdempotencyKeyReused  = errors.New("idempotency key reused with different request")
+	ErrIdempotencyInProgress = errors.New("request with this idempotency key still in progress")
+)
+
+const (
+	idempotencyPollInterval   = 50 * time.Millisecond
+	defaultIdempotencyTTL     = 24 * time.Hour
+	defaultIdempotencyPending = 30 * time.Second
+	defaultIdempotencyWait    = 3 * time.Second
+)
+
+// IdempotencyService replays the stored response of the first request with a key
+// 1. first request: pending marker, run, store response
+// 2. retry after completion: stored response
+// 3. concurrent duplicate: wait for the first one, up to wait
+type IdempotencyService struct {
+	repo       repositoryiface.IdempotencyRepository
+	ttl        time.Duration // how long responses are replayed
+	pendingTTL time.Duration // pending marker expiry, in case the first request dies
+	wait       time.Duration
+}
+
+func NewIdempotencyService(repo repositoryiface.IdempotencyRepository, ttl time.Duration) *IdempotencyService {
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	return &IdempotencyService{
+		repo:       repo,
+		ttl:        ttl,
+		pendingTTL: defaultIdempotencyPending,
+		wait:       defaultIdempotencyWait,
+	}
+}
+
+// Do runs fn once per key, key must already be scoped (eg. by route & user)
+// fn returns the response status & body to replay, business rejections included
+// errors of fn are not stored, the key is freed so the client can retry
+func (s *IdempotencyService) Do(ctx context.Context, key, fingerprint string, fn func() (int, []byte, error)) (status int, resp []byte, replayed bool, err error) {
+	started, rec, err := s.repo.Begin(ctx, key, domain.IdempotencyRecord{
+		State:       domain.IdempotencyPending,
+		Fingerprint: fingerprint,
+		CreatedAt:   time.Now(),
+	}, s.pendingTTL)
+	if err != nil {
+		return 0, nil, false, err
+	}
+
+	if !started {
+		if rec != nil && rec.Fingerprint != fingerprint {
+			return 0, nil, false, ErrIdempotencyKeyReused
+		}
+		rec, err = s.awaitDone(ctx, key, rec)
+		if err != nil {
+			return 0, nil, false, err
+		}
+		if rec == nil {
+			// first request gave up in between, run it ourselves
+			return s.Do(ctx, key, fingerprint, fn)
+		}
+		if rec.Fingerprint != fingerprint {
+			return 0, nil, false, ErrIdempotencyKeyReused
+		}
+		return rec.StatusCode, rec.Response, true, nil
+	}
+
+	status, resp, err = fn()
+	// request ctx may be canceled already, the outcome must still be stored
+	bg, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err != nil {
+		if aErr := s.repo.Abandon(bg, key); aErr != nil {
+			log.Printf("[idempotency] warn: abandon key failed key=%s: %v", key, aErr)
+		}
+		return 0, nil, false, err
+	}
+	if cErr := s.repo.Complete(bg, key, domain.IdempotencyRecord{
+		State:       domain.IdempotencyDone,
+		Fingerprint: fingerprint,
+		StatusCode:  status,
+		Response:    resp,
+		CreatedAt:   time.Now(),
+	}, s.ttl); cErr != nil {
+		// retries would run again, log only, this response is still valid
+		log.Printf("[idempotency] warn: store response failed key=%s: %v", key, cErr)
+	}
+	return status, resp, false, nil
+}
+
+// awaitDone polls a pending record until it's done, gone (nil) or wait passed
+func (s *IdempotencyService) awaitDone(ctx context.Context, key string, rec *domain.IdempotencyRecord) (*domain.IdempotencyRecord, error) {
+	deadline := time.Now().Add(s.wait)
+	for rec != nil && rec.State == domain.IdempotencyPending {
+		if time.Now().After(deadline) {
+			return nil, ErrIdempotencyInProgress
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(idempotencyPollInterval):
+		}
+		var err error
+		if rec, err = s.repo.Get(ctx, key); err != nil {
+			return nil, err
+		}
+	}
+	return rec, nil
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"flashsale/internal/repository/redis"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+func newIdempotencyEnv(t *testing.T) (*miniredis.Miniredis, *IdempotencyService) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return mr, NewIdempotencyService(redis.NewIdempotencyRedisRepo(rdb), time.Hour)
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	mr, svc := newIdempotencyEnv(t)
+	ctx := context.Background()
+	runs := 0
+	fn := func() (int, []byte, error) {
+		runs++
+		return http.StatusConflict, []byte(`{"error":{"code":"OUT_OF_STOCK"}}`), nil
+	}
+
+	status, resp, replayed, err := svc.Do(ctx, "k1", "p1", fn)
+	if err != nil || replayed || status != http.StatusConflict {
+		t.Fatalf("first = %d %s %v %v", status, resp, replayed, err)
+	}
+	// business rejections are replayed as they were
+	status, again, replayed, err := svc.Do(ctx, "k1", "p1", fn)
+	if err != nil || !replayed || status != http.StatusConflict || string(again) != string(resp) || runs != 1 {
+		t.Fatalf("retry = %d %s %v %v, %d runs", status, again, replayed, err, runs)
+	}
+	if ttl := mr.TTL("idem:k1"); ttl != time.Hour {
+		t.Fatalf("record ttl = %v", ttl)
+	}
+
+	// same key for another product
+	if _, _, _, err := svc.Do(ctx, "k1", "p2", fn); !errors.Is(err, ErrIdempotencyKeyReused) {
+		t.Fatalf("reused key = %v", err)
+	}
+}
+
+func TestIdempotencyErrorNotStored(t *testing.T) {
+	mr, svc := newIdempotencyEnv(t)
+	ctx := context.Background()
+	errDown := errors.New("redis down")
+
+	if _, _, _, err := svc.Do(ctx, "k1", "p1", func() (int, []byte, error) { return 0, nil, errDown }); !errors.Is(err, errDown) {
+		t.Fatalf("failed run = %v", err)
+	}
+	if mr.Exists("idem:k1") {
+		t.Fatal("failed run kept the key")
+	}
+	status, _, replayed, err := svc.Do(ctx, "k1", "p1", func() (int, []byte, error) { return http.StatusOK, []byte(`{}`), nil })
+	if err != nil || replayed || status != http.StatusOK {
+		t.Fatalf("retry after failure = %d %v %v", status, replayed, err)
+	}
+}
+
+func TestIdempotencyConcurrentDuplicate(t *testing.T) {
+	_, svc := newIdempotencyEnv(t)
+	ctx := context.Background()
+
+	started, release := make(chan struct{}), make(chan struct{})
+	first := make(chan error, 1)
+	go func() {
+		_, _, _, err := svc.Do(ctx, "k1", "p1", func() (int, []byte, error) {
+			close(started)
+			<-release
+			return http.StatusOK, []byte(`{"order_id":"o1"}`), nil
+		})
+		first <- err
+	}()
+	<-started
+
+	// the duplicate waits for the first result instead of running again
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		close(release)
+	}()
+	status, resp, replayed, err := svc.Do(ctx, "k1", "p1", func() (int, []byte, error) {
+		t.Error("duplicate ran")
+		return 0, nil, nil
+	})
+	if err != nil || !replayed || status != http.StatusOK || string(resp) != `{"order_id":"o1"}` {
+		t.Fatalf("duplicate = %d %s %v %v", status, resp, replayed, err)
+	}
+	if err := <-first; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIdempotencyInProgress(t *testing.T) {
+	mr, svc := newIdempotencyEnv(t)
+	svc.wait = 100 * time.Millisecond
+	ctx := context.Background()
+
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	go svc.Do(ctx, "k1", "p1", func() (int, []byte, error) {
+		close(started)
+		<-release
+		return 0, nil, errors.New("gave up")
+	})
+	<-started
+
+	if _, _, _, err := svc.Do(ctx, "k1", "p1", nil); !errors.Is(err, ErrIdempotencyInProgress) {
+		t.Fatalf("duplicate of a slow request = %v", err)
+	}
+
+	// the pending marker is gone (first request died), the waiting duplicate runs itself
+	svc.wait = time.Second
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		mr.Del("idem:k1")
+	}()
+	status, _, replayed, err := svc.Do(ctx, "k1", "p1", func() (int, []byte, error) { return http.StatusOK, []byte(`{}`), nil })
+	if err != nil || replayed || status != http.StatusOK {
+		t.Fatalf("after lost marker = %d %v %v", status, replayed, err)
+	}
+}
@@ -2,25 +2,35 @@ package service
 
 import (
 	"context"
+	"errors"
+	"flashsale/internal/domain"
 	"flashsale/internal/dto"
 	"flashsale/internal/repository/repositoryiface"
 	"fmt"
 	"log"
 	"strconv"
+
+	"github.com/jackc/pgx/v5"
 )
 
 type OrderCompensator struct {
-	orderRepo      repositoryiface.OrderRepository
-	redisStockRepo repositoryiface.RedisStockRepository
+	orderRepo   repositoryiface.OrderRepository
+	statusCache repositoryiface.OrderStatusCacheRepository
+	userQuota   repositoryiface.UserQuotaRepository
+	claims      repositoryiface.PurchaseClaimRepository
 }
 
 func NewOrderCompensator(
 	orderRepo repositoryiface.OrderRepository,
-	redisStockRepo repositoryiface.RedisStockRepository,
+	statusCache repositoryiface.OrderStatusCacheRepository,
+	userQuota repositoryiface.UserQuotaRepository,
+	claims repositoryiface.PurchaseClaimRepository,
 ) *OrderCompensator {
 	return &OrderCompensator{
-		orderRepo:      orderRepo,
-		redisStockRepo: redisStockRepo,
+		orderRepo:   orderRepo,
+		statusCache: statusCache,
+		userQuota:   userQuota,
+		claims:      claims,
 	}
 }
 
@@ -28,12 +38,22 @@ func (c *OrderCompensator) Compensate(ctx context.Context, msg dto.DLQMessage) e
 	log.Printf("[Compensator] start compensate: OrderNo=%s, Reason=%s", msg.OrderNo, msg.Reason)
 	// 1. Idempotency: check DB order status
 	status, err := c.orderRepo.GetOrderStatus(ctx, msg.OrderNo)
+	if msg.Payload.CreateOrder && errors.Is(err, pgx.ErrNoRows) {
+		// async order the worker never created, insert it failed
+		if err := c.createFailed(ctx, msg); err != nil {
+			return fmt.Errorf("failed to create failed order=%s, err=%v", msg.OrderNo, err)
+		}
+		c.saveFailed(ctx, msg)
+		c.release(ctx, msg, msg.Payload.FlashSaleID, msg.Payload.UserID, strconv.FormatInt(msg.Payload.ProductID, 10))
+		log.Printf("[Compensator] uncreated async order failed: OrderNo=%s", msg.OrderNo)
+		return nil
+	}
 	if err != nil {
 		return err
 	}
 
 	// if already SUCCESS/FAILED, no compensation
-	if status == "success" || status == "failed" {
+	if domain.OrderStatus(status).IsFinal() {
 		log.Printf("[Compensator] order %s already processed, skip compensation", msg.OrderNo)
 		return nil
 	}
@@ -42,15 +62,59 @@ func (c *OrderCompensator) Compensate(ctx context.Context, msg dto.DLQMessage) e
 	if err := c.orderRepo.MarkOrderFailed(ctx, msg.OrderNo, msg.Reason); err != nil {
 		return fmt.Errorf("failed to mark order as failed=%s, err=%v", msg.OrderNo, err)
 	}
-	// 3. restore stock
-	productID := msg.Payload.ProductID
-	log.Printf("[Compensator] run redis stock compensate: ProductID=%d", productID)
-	if err := c.redisStockRepo.RestoreStock(ctx, strconv.FormatInt(msg.Payload.ProductID, 10), 1); err != nil {
-		log.Printf("[Compensator ERROR] restore stock failed order =%s, product=%d, err=%v", msg.OrderNo, msg.Payload.ProductID, err)
-		return err
+	// 2-1. sync order status cache for result polling
+	c.saveFailed(ctx, msg)
+	// 3. give back the user's slot & sale limit reserved at precheck
+	// no stock to restore: precheck only claims, the worker gives back what DecrStock took
+	if order, err := c.orderRepo.GetByOrderNo(ctx, msg.OrderNo); err != nil {
+		log.Printf("[Compensator] warn: load order for release failed order=%s, err=%v", msg.OrderNo, err)
+	} else {
+		c.release(ctx, msg, order.FlashSaleID, order.UserID, strconv.FormatInt(order.ProductID, 10))
 	}
 
 	log.Printf("[Compensator] compensation success: OrderNo=%s", msg.OrderNo)
 	return nil
 
 }
+
+// saveFailed: DB is already updated so only log
+func (c *OrderCompensator) saveFailed(ctx context.Context, msg dto.DLQMessage) {
+	if err := c.statusCache.SaveStatus(ctx, domain.OrderStatusSnapshot{
+		OrderNo: msg.OrderNo,
+		UserID:  msg.Payload.UserID,
+		Status:  domain.OrderFailed,
+		Reason:  msg.Reason,
+	}, domain.OrderStatusCacheTTL); err != nil {
+		log.Printf("[Compensator] warn: order status cache update failed order=%s, err=%v", msg.OrderNo, err)
+	}
+}
+
+func (c *OrderCompensator) release(ctx context.Context, msg dto.DLQMessage, flashSaleID int64, userID, productID string) {
+	if err := c.claims.Release(ctx, productID, userID, msg.OrderNo, msg.Payload.StockBuckets); err != nil {
+		log.Printf("[Compensator] warn: release purchase claim failed order=%s, err=%v", msg.OrderNo, err)
+	}
+	if err := c.userQuota.Release(ctx, flashSaleID, userID, productID); err != nil {
+		log.Printf("[Compensator] warn: release user quota failed order=%s, err=%v", msg.OrderNo, err)
+	}
+}
+
+func (c *OrderCompensator) createFailed(ctx context.Context, msg dto.DLQMessage) error {
+	reason := msg.Reason
+	tx, err := c.orderRepo.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if err := c.orderRepo.CreateOrderTx(ctx, tx, &domain.Order{
+		OrderNo:     msg.OrderNo,
+		UserID:      msg.Payload.UserID,
+		ProductID:   msg.Payload.ProductID,
+		FlashSaleID: msg.Payload.FlashSaleID,
+		Price:       msg.Payload.Price,
+		Status:      string(domain.OrderFailed),
+		FailReason:  &reason,
+	}); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"flashsale/internal/cache"
+	"flashsale/internal/domain"
+	"flashsale/internal/dto"
+	"flashsale/internal/repository/redis"
+	"flashsale/internal/repository/repositoryiface"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/jackc/pgx/v5"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// fakeOrderRows is the orders table of the compensator
+type fakeOrderRows struct {
+	repositoryiface.OrderRepository
+	orders map[string]*domain.Order
+}
+
+func (r *fakeOrderRows) GetOrderStatus(ctx context.Context, orderNo string) (string, error) {
+	o, ok := r.orders[orderNo]
+	if !ok {
+		return "", pgx.ErrNoRows
+	}
+	return o.Status, nil
+}
+
+func (r *fakeOrderRows) GetByOrderNo(ctx context.Context, orderNo string) (*domain.Order, error) {
+	o, ok := r.orders[orderNo]
+	if !ok {
+		return nil, pgx.ErrNoRows
+	}
+	return o, nil
+}
+
+func (r *fakeOrderRows) MarkOrderFailed(ctx context.Context, orderNo, reason string) error {
+	r.orders[orderNo].Status = string(domain.OrderFailed)
+	r.orders[orderNo].FailReason = &reason
+	return nil
+}
+
+// fakeTx inserts on Commit, Rollback drops the rows
+type fakeTx struct {
+	pgx.Tx
+	commit func()
+}
+
+func (tx *fakeTx) Commit(ctx context.Context) error {
+	if tx.commit != nil {
+		tx.commit()
+		tx.commit = nil
+	}
+	return nil
+}
+
+func (tx *fakeTx) Rollback(ctx context.Context) error {
+	tx.commit = nil
+	return nil
+}
+
+func (r *fakeOrderRows) BeginTx(ctx context.Context) (pgx.Tx, error) {
+	return &fakeTx{}, nil
+}
+
+func (r *fakeOrderRows) CreateOrderTx(ctx context.Context, tx pgx.Tx, o *domain.Order) error {
+	tx.(*fakeTx).commit = func() { r.orders[o.OrderNo] = o }
+	return nil
+}
+
+type compensatorEnv struct {
+	mr      *miniredis.Miniredis
+	status  repositoryiface.OrderStatusCacheRepository
+	rows    *fakeOrderRows
+	scripts *cache.LuaScripts
+	soldOut repositoryiface.SoldOutRepository
+	c       *OrderCompensator
+}
+
+func newCompensatorEnv(t *testing.T) *compensatorEnv {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	const dir = "../../scripts"
+	scripts, err := cache.LoadLuaScripts(rdb, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	quota, err := redis.NewUserQuotaRedisRepo(rdb, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := redis.NewPurchaseClaimRedisRepo(rdb, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := &compensatorEnv{
+		mr:      mr,
+		rows:    &fakeOrderRows{orders: map[string]*domain.Order{}},
+		scripts: scripts,
+		soldOut: redis.NewSoldOutRedisRepo(rdb),
+	}
+	env.status = redis.NewOrderStatusRedisRepo(rdb)
+	env.c = NewOrderCompensator(env.rows, env.status, quota, claims)
+	return env
+}
+
+func (e *compensatorEnv) precheck(t *testing.T, userID, orderID string) {
+	t.Helper()
+	res, err := e.scripts.FlashSalePreCheck(context.Background(), "1", userID, orderID, time.Hour, 0)
+	if err != nil || !res.Success {
+		t.Fatalf("precheck = %+v, %v", res, err)
+	}
+}
+
+func TestCompensateLeavesStock(t *testing.T) {
+	env := newCompensatorEnv(t)
+	ctx := context.Background()
+	env.mr.Set(cache.StockKey("1"), "1")
+	env.precheck(t, "U1", "o1")
+	env.rows.orders["o1"] = &domain.Order{OrderNo: "o1", UserID: "U1", ProductID: 1, FlashSaleID: 7, Status: string(domain.OrderPending)}
+	// another order took the last item meanwhile
+	if err := env.soldOut.Mark(ctx, 7, "1", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := dto.DLQMessage{OrderNo: "o1", Reason: "db down", Payload: dto.QueueOrderReq{OrderNo: "o1", UserID: "U1", ProductID: 1, FlashSaleID: 7}}
+	if err := env.c.Compensate(ctx, msg); err != nil {
+		t.Fatalf("compensate = %v", err)
+	}
+
+	if o := env.rows.orders["o1"]; o.Status != string(domain.OrderFailed) {
+		t.Fatalf("order = %s", o.Status)
+	}
+	// precheck took no stock, nothing to give back
+	if v, _ := env.mr.Get(cache.StockKey("1")); v != "1" {
+		t.Fatalf("redis stock = %s, want 1", v)
+	}
+	if sold, _ := env.soldOut.List(ctx, 7); len(sold) != 1 {
+		t.Fatalf("sold out flag cleared: %v", sold)
+	}
+	// the user's slot is free again
+	env.precheck(t, "U1", "o2")
+}
+
+func TestCompensateUncreatedAsyncOrder(t *testing.T) {
+	env := newCompensatorEnv(t)
+	ctx := context.Background()
+	env.mr.Set(cache.StockKey("1"), "1")
+	env.precheck(t, "U1", "o1")
+
+	msg := dto.DLQMessage{OrderNo: "o1", Reason: "EXPIRED", Payload: dto.QueueOrderReq{
+		OrderNo: "o1", UserID: "U1", ProductID: 1, CreateOrder: true, FlashSaleID: 7, Price: 100,
+	}}
+	if err := env.c.Compensate(ctx, msg); err != nil {
+		t.Fatalf("compensate = %v", err)
+	}
+
+	o := env.rows.orders["o1"]
+	if o == nil || o.Status != string(domain.OrderFailed) || *o.FailReason != "EXPIRED" {
+		t.Fatalf("order = %+v", o)
+	}
+	if snap, err := env.status.GetStatus(ctx, "o1"); err != nil || snap == nil || snap.Status != domain.OrderFailed {
+		t.Fatalf("status cache = %+v, %v", snap, err)
+	}
+	if v, _ := env.mr.Get(cache.StockKey("1")); v != "1" {
+		t.Fatalf("redis stock = %s, want 1", v)
+	}
+	env.precheck(t, "U1", "o2")
+}
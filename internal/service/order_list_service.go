@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"flashsale/internal/domain"
+	"flashsale/internal/dto"
+	"flashsale/internal/repository/repositoryiface"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultOrderPageSize = 20
+	maxOrderPageSize     = 100
+)
+
+var (
+	ErrInvalidCursor      = errors.New("invalid cursor")
+	ErrInvalidOrderStatus = errors.New("invalid order status")
+)
+
+// OrderListService: "my orders" listing for a buyer
+type OrderListService struct {
+	repo repositoryiface.OrderRepository
+}
+
+func NewOrderListService(repo repositoryiface.OrderRepository) *OrderListService {
+	return &OrderListService{repo: repo}
+}
+
+type OrderListParams struct {
+	UserID      string
+	FlashSaleID int64  // 0 = all sales
+	Status      string // "" = all status
+	Cursor      string // next_cursor from previous page
+	Limit       int
+}
+
+func (s *OrderListService) ListUserOrders(ctx context.Context, p OrderListParams) (*dto.OrderListPage, error) {
+	q := domain.OrderListQuery{
+		UserID:      p.UserID,
+		FlashSaleID: p.FlashSaleID,
+		Limit:       p.Limit,
+	}
+
+	if p.Status != "" {
+		status := domain.OrderStatus(p.Status)
+		if status != domain.OrderPending && status != domain.OrderSuccess && status != domain.OrderFailed {
+			return nil, ErrInvalidOrderStatus
+		}
+		q.Status = status
+	}
+
+	if p.Cursor != "" {
+		cur, err := decodeOrderCursor(p.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		q.After = cur
+	}
+
+	if q.Limit <= 0 {
+		q.Limit = defaultOrderPageSize
+	}
+	if q.Limit > maxOrderPageSize {
+		q.Limit = maxOrderPageSize
+	}
+	pageSize := q.Limit
+	// fetch one extra row to know if there is a next page
+	q.Limit++
+
+	orders, err := s.repo.ListByUser(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("list orders failed: %w", err)
+	}
+
+	page := &dto.OrderListPage{Orders: make([]dto.OrderListItem, 0, pageSize)}
+	if len(orders) > pageSize {
+		orders = orders[:pageSize]
+		last := orders[len(orders)-1]
+		page.NextCursor = encodeOrderCursor(domain.OrderCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+	for _, o := range orders {
+		page.Orders = append(page.Orders, dto.OrderListItem{
+			OrderID:     o.OrderNo,
+			ProductID:   o.ProductID,
+			FlashSaleID: o.FlashSaleID,
+			Price:       o.Price,
+			Status:      o.Status,
+			FailReason:  o.FailReason,
+			CreatedAt:   o.CreatedAt,
+			PaidAt:      o.PaidAt,
+			CanceledAt:  o.CanceledAt,
+		})
+	}
+	return page, nil
+}
+
+// cursor format: base64url("<created_at unix nano>:<id>")
+func encodeOrderCursor(c domain.OrderCursor) string {
+	raw := fmt.Sprintf("%d:%d", c.CreatedAt.UnixNano(), c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeOrderCursor(s string) (*domain.OrderCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	ts, id, ok := strings.Cut(string(b), ":")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	nanos, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	orderID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	// orders.created_at is TIMESTAMP (no tz), pgx scans it as UTC wall clock
+	return &domain.OrderCursor{CreatedAt: time.Unix(0, nanos).UTC(), ID: orderID}, nil
+}
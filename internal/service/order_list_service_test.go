@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"flashsale/internal/domain"
+	"flashsale/internal/repository/repositoryiface"
+	"slices"
+	"testing"
+	"time"
+)
+
+// fakeUserOrders pages like the keyset query: (created_at, id) < cursor, newest first
+type fakeUserOrders struct {
+	repositoryiface.OrderRepository
+	orders  []domain.Order // newest first
+	queries []domain.OrderListQuery
+}
+
+func (r *fakeUserOrders) ListByUser(ctx context.Context, q domain.OrderListQuery) ([]domain.Order, error) {
+	r.queries = append(r.queries, q)
+	var res []domain.Order
+	for _, o := range r.orders {
+		if o.UserID != q.UserID || (q.Status != "" && o.Status != string(q.Status)) {
+			continue
+		}
+		if a := q.After; a != nil && !(o.CreatedAt.Before(a.CreatedAt) || (o.CreatedAt.Equal(a.CreatedAt) && o.ID < a.ID)) {
+			continue
+		}
+		if len(res) == q.Limit {
+			break
+		}
+		res = append(res, o)
+	}
+	return res, nil
+}
+
+func TestListUserOrdersPages(t *testing.T) {
+	base := time.Date(2026, 1, 1, 12, 0, 0, 123456789, time.UTC)
+	repo := &fakeUserOrders{orders: []domain.Order{
+		{ID: 5, OrderNo: "o5", UserID: "U1", Status: string(domain.OrderSuccess), CreatedAt: base.Add(3 * time.Second)},
+		// same timestamp, the id breaks the tie
+		{ID: 4, OrderNo: "o4", UserID: "U1", Status: string(domain.OrderFailed), CreatedAt: base.Add(2 * time.Second)},
+		{ID: 3, OrderNo: "o3", UserID: "U1", Status: string(domain.OrderSuccess), CreatedAt: base.Add(2 * time.Second)},
+		{ID: 2, OrderNo: "o2", UserID: "U2", Status: string(domain.OrderSuccess), CreatedAt: base.Add(time.Second)},
+		{ID: 1, OrderNo: "o1", UserID: "U1", Status: string(domain.OrderPending), CreatedAt: base},
+	}}
+	svc := NewOrderListService(repo)
+	ctx := context.Background()
+
+	var got []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("cursor never ran out")
+		}
+		page, err := svc.ListUserOrders(ctx, OrderListParams{UserID: "U1", Cursor: cursor, Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, o := range page.Orders {
+			got = append(got, o.OrderID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	if want := []string{"o5", "o4", "o3", "o1"}; !slices.Equal(got, want) {
+		t.Fatalf("pages = %v, want %v", got, want)
+	}
+	// one row more than the page size tells if there is a next page
+	if q := repo.queries[0]; q.Limit != 3 || q.After != nil {
+		t.Fatalf("first query = %+v", q)
+	}
+
+	page, err := svc.ListUserOrders(ctx, OrderListParams{UserID: "U1", Status: "success"})
+	if err != nil || len(page.Orders) != 2 || page.NextCursor != "" {
+		t.Fatalf("success orders = %+v, %v", page, err)
+	}
+}
+
+func TestOrderCursorRoundTrip(t *testing.T) {
+	c := domain.OrderCursor{CreatedAt: time.Date(2026, 1, 1, 12, 0, 0, 123456789, time.UTC), ID: 42}
+	got, err := decodeOrderCursor(encodeOrderCursor(c))
+	if err != nil || !got.CreatedAt.Equal(c.CreatedAt) || got.CreatedAt.Location() != time.UTC || got.ID != 42 {
+		t.Fatalf("decoded = %+v, %v", got, err)
+	}
+}
+
+func TestListUserOrdersRejects(t *testing.T) {
+	repo := &fakeUserOrders{}
+	svc := NewOrderListService(repo)
+	ctx := context.Background()
+
+	for _, cursor := range []string{"%%%", "bm9jb2xvbg", "YTox", "MTo"} {
+		if _, err := svc.ListUserOrders(ctx, OrderListParams{UserID: "U1", Cursor: cursor}); !errors.Is(err, ErrInvalidCursor) {
+			t.Fatalf("cursor %q = %v", cursor, err)
+		}
+	}
+	if _, err := svc.ListUserOrders(ctx, OrderListParams{UserID: "U1", Status: "shipped"}); !errors.Is(err, ErrInvalidOrderStatus) {
+		t.Fatalf("unknown status = %v", err)
+	}
+	if _, err := svc.ListUserOrders(ctx, OrderListParams{UserID: "U1", Limit: 1000}); err != nil {
+		t.Fatal(err)
+	}
+	if q := repo.queries[len(repo.queries)-1]; q.Limit != maxOrderPageSize+1 {
+		t.Fatalf("limit 1000 queried %d rows", q.Limit)
+	}
+}
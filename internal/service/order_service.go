@@ -2,10 +2,14 @@ package service
 
 import (
 	"context"
+	"errors"
 	"flashsale/internal/cache"
+	"flashsale/internal/domain"
+	"flashsale/internal/dto"
 	"flashsale/internal/repository/repositoryiface"
 	"flashsale/internal/service/serviceiface"
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/google/uuid"
@@ -18,10 +22,11 @@ import (
 */
 
 // PrecheckResult encapsulates results to handler
+// json tags: stored as is for idempotent replays
 type PrecheckResult struct {
-	Status  string // queued/ no_stock/ already_purchased
-	OrderID string
-	Message string
+	Status  string `json:"status"` // queued, other outcomes are *Error
+	OrderID string `json:"order_id"`
+	Message string `json:"message"`
 }
 
 /*
@@ -30,70 +35,154 @@ type PrecheckResult struct {
 
 */
 
+// OrderCreateMode: who inserts the pending order row
+type OrderCreateMode string
+
+const (
+	OrderCreateSync  OrderCreateMode = "sync"  // API inserts it before publishing
+	OrderCreateAsync OrderCreateMode = "async" // worker inserts it with the stock update, API writes a Redis marker
+)
+
+func (m OrderCreateMode) Valid() bool {
+	return m == OrderCreateSync || m == OrderCreateAsync
+}
+
 // OrderService: Precheck logic + put request into Queue
 type OrderService struct {
-	lua           *cache.LuaScripts
-	repo          repositoryiface.OrderRepository
-	publisher     serviceiface.OrderPublisher
-	flashSaleRepo repositoryiface.FlashSaleRepository
+	lua         *cache.LuaScripts
+	repo        repositoryiface.OrderRepository
+	publisher   serviceiface.OrderPublisher
+	catalog     *SaleCatalog
+	statusCache repositoryiface.OrderStatusCacheRepository
+	quota       repositoryiface.UserQuotaRepository
+	claims      repositoryiface.PurchaseClaimRepository
+	createMode  OrderCreateMode
+	soldOut     *SoldOutCache // optional
 }
 
-func NewOrderService(pub serviceiface.OrderPublisher, lua *cache.LuaScripts, repo repositoryiface.OrderRepository, flashSaleRepo repositoryiface.FlashSaleRepository) *OrderService {
+func NewOrderService(pub serviceiface.OrderPublisher, lua *cache.LuaScripts, repo repositoryiface.OrderRepository, catalog *SaleCatalog, statusCache repositoryiface.OrderStatusCacheRepository, quota repositoryiface.UserQuotaRepository, claims repositoryiface.PurchaseClaimRepository, createMode OrderCreateMode, soldOut *SoldOutCache) *OrderService {
 	return &OrderService{
-		repo:          repo,
-		publisher:     pub,
-		lua:           lua,
-		flashSaleRepo: flashSaleRepo,
+		repo:        repo,
+		publisher:   pub,
+		lua:         lua,
+		catalog:     catalog,
+		statusCache: statusCache,
+		quota:       quota,
+		claims:      claims,
+		createMode:  createMode,
+		soldOut:     soldOut,
 	}
 }
 
+// PreCheckAndQueue returns a catalog *Error for every non queued outcome
 func (s *OrderService) PreCheckAndQueue(ctx context.Context, userID, productID string) (*PrecheckResult, error) {
 	// 0 Flash Sale Window Gate
-	fs, err := s.flashSaleRepo.GetActiveFlashSale(ctx)
-	if err != nil || fs == nil {
-		return &PrecheckResult{
-			Status:  "not_started",
-			Message: "flash sale not active",
-		}, nil
+	fs, err := s.catalog.ActiveSale(ctx)
+	if err == nil && fs == nil {
+		return nil, ErrSaleNotActive
 	}
-
-	if !fs.IsActive(time.Now()) {
-		return &PrecheckResult{
-			Status:  "not_started",
-			Message: "flash sale not in window",
-		}, nil
+	if err != nil {
+		return nil, unavailable(fmt.Errorf("get active flash sale: %w", err))
 	}
 
-	// 1. redis precheck
-	res, err := cache.FlashSalePreCheck(productID, userID)
-	if err != nil {
-		return &PrecheckResult{Status: "error", Message: err.Error()}, err
+	now := time.Now()
+	if !fs.IsActive(now) {
+		if now.Before(fs.StartAt) {
+			return nil, ErrSaleNotStarted
+		}
+		return nil, ErrSaleNotActive
+	}
+	// 0-1. sold out fast path, no Redis call
+	if s.soldOut != nil && s.soldOut.IsSoldOut(fs.ID, productID) {
+		return nil, ErrSoldOut
 	}
 
-	if !res.Success {
-		return &PrecheckResult{
-			Status:  res.Reason,
-			Message: "precheck failed",
-		}, nil
+	// 0-2. promotional price & stock layout, cached sale products first
+	fsp, err := s.catalog.SaleProduct(ctx, fs, productID)
+	if err == nil && fsp == nil {
+		return nil, ErrStockNotFound
 	}
-	// get promotional price from flash_sale_products table
-	fsp, err := s.flashSaleRepo.GetFlashSaleProduct(ctx, fs.ID, productID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch flash sale product details: %w", err)
+		return nil, internal(fmt.Errorf("failed to fetch flash sale product details: %w", err))
 	}
 
-	// 2. gen OrderID
+	// 1. gen OrderID, the precheck claims the user's slot for it
 	orderID := uuid.New().String()
 
-	// 3. create PENDING order in DB
-	err = s.repo.CreatePendingOrder(ctx, orderID, userID, productID, fs.ID, fsp.SalePrice)
+	// 2. redis precheck, claims the user's slot
+	res, err := s.lua.FlashSalePreCheck(ctx, productID, userID, orderID, fs.TTL(now), fsp.StockBuckets)
 	if err != nil {
-		return nil, fmt.Errorf("create pending order failed: %w", err)
+		return nil, unavailable(fmt.Errorf("redis precheck: %w", err))
+	}
+
+	if !res.Success {
+		if res.Reason == "OUT_OF_STOCK" && s.soldOut != nil {
+			s.soldOut.MarkLocal(fs.ID, productID)
+		}
+		if e, ok := precheckReasonErrors[res.Reason]; ok {
+			return nil, e
+		}
+		return nil, internal(fmt.Errorf("unknown precheck reason %q", res.Reason))
+	}
+
+	// 2-1. reserve sale limits, a separate call: the quota key isn't in the product's cluster slot
+	if fs.HasUserLimits() {
+		ok, err := s.quota.Reserve(ctx, fs.ID, userID, productID, fs.MaxItemsPerUser, fs.MaxProductsPerUser, fs.TTL(now))
+		if err != nil || !ok {
+			s.releaseClaim(userID, productID, orderID, fsp.StockBuckets)
+			if err != nil {
+				return nil, unavailable(fmt.Errorf("reserve user quota: %w", err))
+			}
+			return nil, ErrUserLimitExceeded
+		}
+	}
+
+	async := s.createMode == OrderCreateAsync
+	// 3. create PENDING order in DB, the worker does it in async mode
+	if !async {
+		err = s.repo.CreatePendingOrder(ctx, orderID, userID, productID, fs.ID, fsp.SalePrice)
+		if errors.Is(err, domain.ErrDuplicateOrder) {
+			// Redis claim was lost, DB still has the user's active order
+			s.release(fs, userID, productID, orderID, fsp.StockBuckets)
+			return nil, ErrUserAlreadyPurchased
+		}
+		if err != nil {
+			s.release(fs, userID, productID, orderID, fsp.StockBuckets)
+			return nil, internal(fmt.Errorf("create pending order failed: %w", err))
+		}
+	}
+	// 3-1. seed status cache, so early result polls don't reach DB
+	// in async mode it's the queued marker, the only trace of the order until the worker inserts it
+	pending := domain.OrderStatusSnapshot{
+		OrderNo:   orderID,
+		UserID:    userID,
+		Status:    domain.OrderPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.statusCache.SaveStatus(ctx, pending, domain.OrderStatusCacheTTL); err != nil {
+		if async {
+			s.release(fs, userID, productID, orderID, fsp.StockBuckets)
+			return nil, unavailable(fmt.Errorf("queued marker write failed: %w", err))
+		}
+		log.Printf("[order service] warn: order status cache seed failed order=%s: %v", orderID, err)
 	}
 
 	// 4. publish MQ
-	if err := s.publisher.PublishOrder(ctx, orderID, userID, productID); err != nil {
-		return nil, fmt.Errorf("[order service] publish order failed: %w", err)
+	msg := dto.OrderMessage{
+		OrderID:      orderID,
+		UserID:       userID,
+		ProductID:    productID,
+		FlashSaleID:  fs.ID,
+		CreateOrder:  async,
+		Price:        fsp.SalePrice,
+		StockBuckets: fsp.StockBuckets,
+	}
+	if err := s.publisher.PublishOrder(ctx, msg); err != nil {
+		// no worker will see the order, fail it so the user can try again
+		s.failUnpublished(pending, async)
+		s.release(fs, userID, productID, orderID, fsp.StockBuckets)
+		return nil, unavailable(fmt.Errorf("publish order failed: %w", err))
 	}
 
 	return &PrecheckResult{
@@ -102,3 +191,43 @@ func (s *OrderService) PreCheckAndQueue(ctx context.Context, userID, productID s
 		Message: "precheck success, order queued",
 	}, nil
 }
+
+// failUnpublished: sync mode fails the DB row, async mode has only the queued marker
+func (s *OrderService) failUnpublished(snap domain.OrderStatusSnapshot, async bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if !async {
+		if err := s.repo.MarkOrderFailed(ctx, snap.OrderNo, "PUBLISH_FAILED"); err != nil {
+			log.Printf("[order service] warn: mark unpublished order failed order=%s: %v", snap.OrderNo, err)
+		}
+	}
+	snap.Status = domain.OrderFailed
+	snap.Reason = "PUBLISH_FAILED"
+	snap.UpdatedAt = time.Now()
+	if err := s.statusCache.SaveStatus(ctx, snap, domain.OrderStatusCacheTTL); err != nil {
+		log.Printf("[order service] warn: order status cache update failed order=%s: %v", snap.OrderNo, err)
+	}
+}
+
+// release gives back the precheck claim & reservation when the order can't be queued
+func (s *OrderService) release(fs *domain.FlashSale, userID, productID, orderID string, buckets int) {
+	s.releaseClaim(userID, productID, orderID, buckets)
+	if !fs.HasUserLimits() {
+		return
+	}
+	// request ctx may be canceled already
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := s.quota.Release(ctx, fs.ID, userID, productID); err != nil {
+		log.Printf("[order service] warn: release user quota failed sale=%d user=%s product=%s: %v", fs.ID, userID, productID, err)
+	}
+}
+
+// releaseClaim gives back only the precheck claim, e.g. when the sale limits were not reserved
+func (s *OrderService) releaseClaim(userID, productID, orderID string, buckets int) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := s.claims.Release(ctx, productID, userID, orderID, buckets); err != nil {
+		log.Printf("[order service] warn: release purchase claim failed order=%s: %v", orderID, err)
+	}
+}
@@ -0,0 +1,207 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"flashsale/internal/cache"
+	"flashsale/internal/domain"
+	"flashsale/internal/dto"
+	"flashsale/internal/repository/redis"
+	"flashsale/internal/repository/repositoryiface"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// fakePublisher records published orders, fails with err when set
+type fakePublisher struct {
+	msgs []dto.OrderMessage
+	err  error
+}
+
+func (p *fakePublisher) PublishOrder(ctx context.Context, msg dto.OrderMessage) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.msgs = append(p.msgs, msg)
+	return nil
+}
+
+// fakePendingRepo is the orders table of sync mode, one active order per user & product
+type fakePendingRepo struct {
+	repositoryiface.OrderRepository
+	orders map[string]*domain.Order
+}
+
+func (r *fakePendingRepo) CreatePendingOrder(ctx context.Context, orderID, userID, productID string, flashSaleID int64, price int) error {
+	for _, o := range r.orders {
+		if o.UserID == userID && o.Status != string(domain.OrderFailed) {
+			return domain.ErrDuplicateOrder
+		}
+	}
+	r.orders[orderID] = &domain.Order{OrderNo: orderID, UserID: userID, FlashSaleID: flashSaleID, Price: price, Status: string(domain.OrderPending)}
+	return nil
+}
+
+func (r *fakePendingRepo) MarkOrderFailed(ctx context.Context, orderNo, reason string) error {
+	r.orders[orderNo].Status = string(domain.OrderFailed)
+	r.orders[orderNo].FailReason = &reason
+	return nil
+}
+
+type orderServiceEnv struct {
+	mr     *miniredis.Miniredis
+	pub    *fakePublisher
+	repo   *fakePendingRepo
+	status repositoryiface.OrderStatusCacheRepository
+	svc    *OrderService
+}
+
+// newOrderServiceEnv wires OrderService like cmd/api does, sale 7 sells product "1" at 100
+func newOrderServiceEnv(t *testing.T, mode OrderCreateMode, buckets int) *orderServiceEnv {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	const dir = "../../scripts"
+	scripts, err := cache.LoadLuaScripts(rdb, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	quota, err := redis.NewUserQuotaRedisRepo(rdb, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := redis.NewPurchaseClaimRedisRepo(rdb, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	now := time.Now()
+	sales := redis.NewFlashSaleRedisRepo(rdb)
+	fs := &domain.FlashSale{ID: 7, Status: domain.StatusActive, StartAt: now.Add(-time.Minute), EndAt: now.Add(time.Hour)}
+	if err := sales.SetActiveFlashSale(ctx, fs, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	p := domain.FlashSaleProduct{FlashSaleID: fs.ID, ProductID: 1, SaleStock: 10, SalePrice: 100, StockBuckets: buckets}
+	if err := sales.SetSaleProducts(ctx, fs.ID, []domain.FlashSaleProduct{p}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range cache.StockKeys("1", buckets) {
+		mr.Set(key, "5")
+	}
+
+	env := &orderServiceEnv{
+		mr:     mr,
+		pub:    &fakePublisher{},
+		repo:   &fakePendingRepo{orders: map[string]*domain.Order{}},
+		status: redis.NewOrderStatusRedisRepo(rdb),
+	}
+	catalog := NewSaleCatalog(&fakeSaleDB{calls: map[string]int{}}, sales, time.Minute)
+	env.svc = NewOrderService(env.pub, scripts, env.repo, catalog, env.status, quota, claims, mode, nil)
+	return env
+}
+
+func (e *orderServiceEnv) cachedStatus(t *testing.T, orderID string) *domain.OrderStatusSnapshot {
+	t.Helper()
+	snap, err := e.status.GetStatus(context.Background(), orderID)
+	if err != nil || snap == nil {
+		t.Fatalf("status cache of %s = %v, %v", orderID, snap, err)
+	}
+	return snap
+}
+
+func TestPreCheckAndQueueAsync(t *testing.T) {
+	env := newOrderServiceEnv(t, OrderCreateAsync, 2)
+	ctx := context.Background()
+
+	res, err := env.svc.PreCheckAndQueue(ctx, "U1", "1")
+	if err != nil || res.Status != "queued" {
+		t.Fatalf("precheck = %+v, %v", res, err)
+	}
+	if len(env.pub.msgs) != 1 {
+		t.Fatalf("published %d messages", len(env.pub.msgs))
+	}
+	msg := env.pub.msgs[0]
+	want := dto.OrderMessage{OrderID: res.OrderID, UserID: "U1", ProductID: "1", FlashSaleID: 7, CreateOrder: true, Price: 100, StockBuckets: 2}
+	if msg != want {
+		t.Fatalf("message = %+v, want %+v", msg, want)
+	}
+	if len(env.repo.orders) != 0 {
+		t.Fatal("async mode inserted the order row")
+	}
+	if snap := env.cachedStatus(t, res.OrderID); snap.Status != domain.OrderPending {
+		t.Fatalf("queued marker = %s", snap.Status)
+	}
+
+	// the claim blocks a second order while the first is queued
+	if _, err := env.svc.PreCheckAndQueue(ctx, "U1", "1"); !errors.Is(err, ErrUserAlreadyPurchased) {
+		t.Fatalf("second precheck = %v", err)
+	}
+	if len(env.pub.msgs) != 1 {
+		t.Fatal("second order published")
+	}
+}
+
+func TestPreCheckAndQueueSoldOut(t *testing.T) {
+	env := newOrderServiceEnv(t, OrderCreateAsync, 0)
+	env.mr.Set(cache.StockKey("1"), "0")
+
+	if _, err := env.svc.PreCheckAndQueue(context.Background(), "U1", "1"); !errors.Is(err, ErrSoldOut) {
+		t.Fatalf("precheck = %v", err)
+	}
+	if _, err := env.svc.PreCheckAndQueue(context.Background(), "U1", "2"); !errors.Is(err, ErrStockNotFound) {
+		t.Fatalf("precheck of a product outside the sale = %v", err)
+	}
+	if len(env.pub.msgs) != 0 {
+		t.Fatal("rejected order published")
+	}
+}
+
+func TestPreCheckAndQueuePublishFailed(t *testing.T) {
+	env := newOrderServiceEnv(t, OrderCreateSync, 0)
+	ctx := context.Background()
+	env.pub.err = errors.New("broker down")
+
+	if _, err := env.svc.PreCheckAndQueue(ctx, "U1", "1"); !errors.Is(err, ErrServiceUnavailable) {
+		t.Fatalf("precheck = %v", err)
+	}
+	if len(env.repo.orders) != 1 {
+		t.Fatalf("%d order rows", len(env.repo.orders))
+	}
+	for id, o := range env.repo.orders {
+		if o.Status != string(domain.OrderFailed) || *o.FailReason != "PUBLISH_FAILED" {
+			t.Fatalf("unpublished order = %+v", o)
+		}
+		if snap := env.cachedStatus(t, id); snap.Status != domain.OrderFailed || snap.Reason != "PUBLISH_FAILED" {
+			t.Fatalf("status cache = %+v", snap)
+		}
+	}
+
+	// claim was given back, the user can try again
+	env.pub.err = nil
+	if res, err := env.svc.PreCheckAndQueue(ctx, "U1", "1"); err != nil || res.Status != "queued" {
+		t.Fatalf("retry = %+v, %v", res, err)
+	}
+}
+
+func TestPreCheckAndQueueDuplicateRow(t *testing.T) {
+	env := newOrderServiceEnv(t, OrderCreateSync, 0)
+	ctx := context.Background()
+	// Redis lost the claim, the DB still has the user's active order
+	env.repo.orders["old"] = &domain.Order{OrderNo: "old", UserID: "U1", Status: string(domain.OrderPending)}
+
+	if _, err := env.svc.PreCheckAndQueue(ctx, "U1", "1"); !errors.Is(err, ErrUserAlreadyPurchased) {
+		t.Fatalf("precheck = %v", err)
+	}
+	if env.mr.Exists(cache.ClaimKey("1", "U1", 0)) {
+		t.Fatal("claim of the rejected order kept")
+	}
+	if len(env.pub.msgs) != 0 {
+		t.Fatal("duplicate order published")
+	}
+}
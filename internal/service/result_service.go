@@ -2,26 +2,114 @@ package service
 
 import (
 	"context"
+	"errors"
+	"flashsale/internal/domain"
 	"flashsale/internal/dto"
 	"flashsale/internal/repository/repositoryiface"
+	"log"
+
+	"github.com/jackc/pgx/v5"
 )
 
+// ErrOrderNotFound is also returned for orders owned by another user, so order IDs can't be probed
+var ErrOrderNotFound = errors.New("order not found")
+
+// Caller is the authenticated requester of a result lookup
+type Caller struct {
+	UserID  string
+	IsAdmin bool // admin tokens may read any order
+}
+
 type OrderResultService struct {
-	repo repositoryiface.OrderRepository
+	repo        repositoryiface.OrderRepository
+	statusCache repositoryiface.OrderStatusCacheRepository
 }
 
-func NewOrderResultService(repo repositoryiface.OrderRepository) *OrderResultService {
-	return &OrderResultService{repo: repo}
+func NewOrderResultService(repo repositoryiface.OrderRepository, statusCache repositoryiface.OrderStatusCacheRepository) *OrderResultService {
+	return &OrderResultService{repo: repo, statusCache: statusCache}
 }
 
-func (s *OrderResultService) GetResult(ctx context.Context, orderID string) (*dto.OrderResult, error) {
-	status, err := s.repo.GetOrderStatus(ctx, orderID)
+func (s *OrderResultService) GetResult(ctx context.Context, orderID string, caller Caller) (*dto.OrderResult, error) {
+	// 1. Redis first, written by api/worker/compensator
+	snap, err := s.statusCache.GetStatus(ctx, orderID)
+	if err != nil {
+		// cache down -> still serve from DB
+		log.Printf("[result service] warn: status cache read failed order=%s: %v", orderID, err)
+	}
+	// entries without owner can't be checked, read DB instead
+	// in async create mode a pending entry is the queued marker, the row doesn't exist yet
+	if snap != nil && snap.UserID != "" {
+		if !caller.canRead(snap.UserID) {
+			return nil, ErrOrderNotFound
+		}
+		return snapshotToResult(snap), nil
+	}
+
+	// 2. cache miss -> DB fallback
+	order, err := s.repo.GetByOrderNo(ctx, orderID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrOrderNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
+	if !caller.canRead(order.UserID) {
+		return nil, ErrOrderNotFound
+	}
+
+	snap = orderToSnapshot(order)
+	// only backfill final status, pending is written by api & overwritten by worker
+	if snap.Status.IsFinal() {
+		if err := s.statusCache.SaveStatus(ctx, *snap, domain.OrderStatusCacheTTL); err != nil {
+			log.Printf("[result service] warn: status cache backfill failed order=%s: %v", orderID, err)
+		}
+	}
+	return snapshotToResult(snap), nil
+}
+
+func (c Caller) canRead(ownerID string) bool {
+	return c.IsAdmin || (c.UserID != "" && c.UserID == ownerID)
+}
+
+func orderToSnapshot(o *domain.Order) *domain.OrderStatusSnapshot {
+	snap := &domain.OrderStatusSnapshot{
+		OrderNo:   o.OrderNo,
+		UserID:    o.UserID,
+		Status:    domain.OrderStatus(o.Status),
+		CreatedAt: o.CreatedAt,
+		UpdatedAt: o.CreatedAt,
+	}
+	if o.FailReason != nil {
+		snap.Reason = *o.FailReason
+	}
+	if o.PaidAt != nil {
+		snap.UpdatedAt = *o.PaidAt
+	}
+	if o.CanceledAt != nil {
+		snap.UpdatedAt = *o.CanceledAt
+	}
+	return snap
+}
+
+func snapshotToResult(snap *domain.OrderStatusSnapshot) *dto.OrderResult {
+	res := &dto.OrderResult{
+		OrderID:         snap.OrderNo,
+		Status:          string(snap.Status),
+		ProcessingState: processingState(snap.Status),
+		CreatedAt:       snap.CreatedAt,
+		UpdatedAt:       snap.UpdatedAt,
+	}
+	if snap.Reason != "" {
+		reason := snap.Reason
+		res.FailReason = &reason
+	}
+	return res
+}
 
-	return &dto.OrderResult{
-		OrderID: orderID,
-		Status:  status,
-	}, nil
+// processingState tells the client whether to keep polling
+func processingState(status domain.OrderStatus) string {
+	if status.IsFinal() {
+		return "done"
+	}
+	return "processing"
 }
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"flashsale/internal/domain"
+	"flashsale/internal/repository/redis"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+func TestGetResultOwnership(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	cache := redis.NewOrderStatusRedisRepo(rdb)
+	rows := &fakeOrderRows{orders: map[string]*domain.Order{}}
+	svc := NewOrderResultService(rows, cache)
+	ctx := context.Background()
+	now := time.Now()
+
+	// o1 cached with its owner, o2 only in the DB, o3 cached without owner (written before owners were cached)
+	if err := cache.SaveStatus(ctx, domain.OrderStatusSnapshot{OrderNo: "o1", UserID: "U1", Status: domain.OrderPending, CreatedAt: now}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	rows.orders["o2"] = &domain.Order{OrderNo: "o2", UserID: "U1", Status: string(domain.OrderSuccess), CreatedAt: now}
+	rows.orders["o3"] = &domain.Order{OrderNo: "o3", UserID: "U2", Status: string(domain.OrderPending), CreatedAt: now}
+	if err := cache.SaveStatus(ctx, domain.OrderStatusSnapshot{OrderNo: "o3", Status: domain.OrderPending, CreatedAt: now}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	owner, other, admin := Caller{UserID: "U1"}, Caller{UserID: "U2"}, Caller{IsAdmin: true}
+	tests := []struct {
+		order   string
+		caller  Caller
+		wantErr error
+	}{
+		{"o1", owner, nil},
+		{"o1", other, ErrOrderNotFound},
+		{"o1", Caller{}, ErrOrderNotFound},
+		{"o1", admin, nil},
+		{"o2", owner, nil},
+		{"o2", other, ErrOrderNotFound},
+		{"o2", admin, nil},
+		// the owner-less cache entry is checked against the DB row
+		{"o3", owner, ErrOrderNotFound},
+		{"o3", other, nil},
+		// missing and foreign orders look the same
+		{"o4", owner, ErrOrderNotFound},
+	}
+	for _, tt := range tests {
+		res, err := svc.GetResult(ctx, tt.order, tt.caller)
+		if !errors.Is(err, tt.wantErr) {
+			t.Fatalf("%s as %+v = %v, want %v", tt.order, tt.caller, err, tt.wantErr)
+		}
+		if err == nil && res.OrderID != tt.order {
+			t.Fatalf("%s as %+v = %+v", tt.order, tt.caller, res)
+		}
+	}
+
+	// the final DB status was backfilled with its owner, the cache alone now answers
+	delete(rows.orders, "o2")
+	if _, err := svc.GetResult(ctx, "o2", other); !errors.Is(err, ErrOrderNotFound) {
+		t.Fatalf("backfilled o2 as other user = %v", err)
+	}
+	if res, err := svc.GetResult(ctx, "o2", owner); err != nil || res.ProcessingState != "done" {
+		t.Fatalf("backfilled o2 = %+v, %v", res, err)
+	}
+}
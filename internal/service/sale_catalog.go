@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"flashsale/internal/domain"
+	"flashsale/internal/repository/repositoryiface"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/sync/singleflight"
+)
+
+// SaleCatalog resolves the sale window & sale prices for precheck
+// lookup order: in-process cache -> Redis -> Postgres (backfills Redis)
+type SaleCatalog struct {
+	db    repositoryiface.FlashSaleRepository
+	redis repositoryiface.FlashSaleRedisRepository
+	ttl   time.Duration
+
+	group   singleflight.Group
+	mu      sync.RWMutex
+	entries map[string]catalogEntry
+}
+
+const (
+	maxCatalogEntries = 4096
+	// a shared fetch serves every waiting caller, so it runs on its own deadline instead of the first caller's ctx
+	catalogFetchTimeout = 3 * time.Second
+)
+
+// catalogEntry: value nil means "not found", cached as well
+type catalogEntry struct {
+	value   any
+	expires time.Time
+}
+
+func NewSaleCatalog(db repositoryiface.FlashSaleRepository, redis repositoryiface.FlashSaleRedisRepository, ttl time.Duration) *SaleCatalog {
+	return &SaleCatalog{
+		db:      db,
+		redis:   redis,
+		ttl:     ttl,
+		entries: make(map[string]catalogEntry),
+	}
+}
+
+// ActiveSale returns nil, nil when there is no active sale
+func (c *SaleCatalog) ActiveSale(ctx context.Context) (*domain.FlashSale, error) {
+	v, err := c.load(ctx, "active", func(ctx context.Context) (any, error) {
+		fs, err := c.redis.GetActiveFlashSale(ctx)
+		if err != nil {
+			log.Printf("[sale catalog] warn: redis active sale read failed: %v", err)
+		}
+		if fs != nil {
+			return fs, nil
+		}
+
+		fs, err = c.db.GetActiveFlashSale(ctx)
+		if errors.Is(err, pgx.ErrNoRows) || (err == nil && fs == nil) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if ttl := fs.TTL(time.Now()); ttl > 0 {
+			if err := c.redis.SetActiveFlashSale(ctx, fs, ttl); err != nil {
+				log.Printf("[sale catalog] warn: active sale backfill failed: %v", err)
+			}
+		}
+		return fs, nil
+	})
+	if v == nil || err != nil {
+		return nil, err
+	}
+	return v.(*domain.FlashSale), nil
+}
+
+// SaleProduct returns nil, nil when the product isn't part of the sale
+func (c *SaleCatalog) SaleProduct(ctx context.Context, fs *domain.FlashSale, productID string) (*domain.FlashSaleProduct, error) {
+	key := fmt.Sprintf("product:%d:%s", fs.ID, productID)
+	v, err := c.load(ctx, key, func(ctx context.Context) (any, error) {
+		p, err := c.redis.GetSaleProduct(ctx, fs.ID, productID)
+		if err != nil {
+			log.Printf("[sale catalog] warn: redis sale product read failed: %v", err)
+		}
+		if p != nil {
+			return p, nil
+		}
+
+		p, err = c.db.GetFlashSaleProduct(ctx, fs.ID, productID)
+		if errors.Is(err, pgx.ErrNoRows) || (err == nil && p == nil) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if ttl := fs.TTL(time.Now()); ttl > 0 {
+			if err := c.redis.SetSaleProducts(ctx, fs.ID, []domain.FlashSaleProduct{*p}, ttl); err != nil {
+				log.Printf("[sale catalog] warn: sale product backfill failed: %v", err)
+			}
+		}
+		return p, nil
+	})
+	if v == nil || err != nil {
+		return nil, err
+	}
+	return v.(*domain.FlashSaleProduct), nil
+}
+
+// load: one fetch per key at a time, errors are not cached
+func (c *SaleCatalog) load(ctx context.Context, key string, fetch func(context.Context) (any, error)) (any, error) {
+	now := time.Now()
+	c.mu.RLock()
+	e, ok := c.entries[key]
+	c.mu.RUnlock()
+	if ok && now.Before(e.expires) {
+		return e.value, nil
+	}
+
+	v, err, _ := c.group.Do(key, func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), catalogFetchTimeout)
+		defer cancel()
+		v, err := fetch(ctx)
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		c.mu.Lock()
+		if len(c.entries) >= maxCatalogEntries {
+			c.evict(now)
+		}
+		c.entries[key] = catalogEntry{value: v, expires: now.Add(c.ttl)}
+		c.mu.Unlock()
+		return v, nil
+	})
+	return v, err
+}
+
+// evict runs when the map is full, callers hold mu
+// unknown product ids are cached too, a scan over random ids must not grow the map past the cap:
+// expired entries go first, then "not found" ones, then any (map order is random)
+// down to 3/4 of the cap, so a flood of misses doesn't sweep on every insert
+func (c *SaleCatalog) evict(now time.Time) {
+	for k, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	target := maxCatalogEntries * 3 / 4
+	for _, drop := range []func(catalogEntry) bool{
+		func(e catalogEntry) bool { return e.value == nil },
+		func(catalogEntry) bool { return true },
+	} {
+		for k, e := range c.entries {
+			if len(c.entries) <= target {
+				return
+			}
+			if drop(e) {
+				delete(c.entries, k)
+			}
+		}
+	}
+}
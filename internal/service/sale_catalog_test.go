@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"flashsale/internal/domain"
+	"flashsale/internal/repository/repositoryiface"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// fakeSaleDB knows product "1" only, counts lookups per product
+type fakeSaleDB struct {
+	repositoryiface.FlashSaleRepository
+	calls map[string]int
+}
+
+func (f *fakeSaleDB) GetFlashSaleProduct(ctx context.Context, flashSaleID int64, productID string) (*domain.FlashSaleProduct, error) {
+	f.calls[productID]++
+	if productID != "1" {
+		return nil, pgx.ErrNoRows
+	}
+	return &domain.FlashSaleProduct{FlashSaleID: flashSaleID, ProductID: 1}, nil
+}
+
+// fakeSaleRedis always misses, backfills are dropped
+type fakeSaleRedis struct {
+	repositoryiface.FlashSaleRedisRepository
+}
+
+func (fakeSaleRedis) GetSaleProduct(ctx context.Context, flashSaleID int64, productID string) (*domain.FlashSaleProduct, error) {
+	return nil, nil
+}
+
+func (fakeSaleRedis) SetSaleProducts(ctx context.Context, flashSaleID int64, products []domain.FlashSaleProduct, ttl time.Duration) error {
+	return nil
+}
+
+func TestSaleCatalogCap(t *testing.T) {
+	db := &fakeSaleDB{calls: map[string]int{}}
+	c := NewSaleCatalog(db, fakeSaleRedis{}, time.Hour)
+	ctx := context.Background()
+	now := time.Now()
+	fs := &domain.FlashSale{ID: 7, StartAt: now.Add(-time.Minute), EndAt: now.Add(time.Hour)}
+
+	if p, err := c.SaleProduct(ctx, fs, "1"); err != nil || p == nil {
+		t.Fatalf("known product = %v, %v", p, err)
+	}
+
+	// scan over unknown ids, none of them expire within the test
+	for i := 2; i < 3*maxCatalogEntries; i++ {
+		if p, err := c.SaleProduct(ctx, fs, strconv.Itoa(i)); err != nil || p != nil {
+			t.Fatalf("unknown product %d = %v, %v", i, p, err)
+		}
+		if n := len(c.entries); n > maxCatalogEntries {
+			t.Fatalf("%d entries after %d lookups, cap %d", n, i, maxCatalogEntries)
+		}
+	}
+
+	// "not found" entries were evicted first, the known product is still cached
+	if _, err := c.SaleProduct(ctx, fs, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if db.calls["1"] != 1 {
+		t.Fatalf("known product read from DB %d times, want 1", db.calls["1"])
+	}
+}
+
+// slowSaleDB answers once released, with the error of the ctx it got
+type slowSaleDB struct {
+	fakeSaleDB
+	started, release chan struct{}
+}
+
+func (f *slowSaleDB) GetFlashSaleProduct(ctx context.Context, flashSaleID int64, productID string) (*domain.FlashSaleProduct, error) {
+	close(f.started)
+	<-f.release
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return f.fakeSaleDB.GetFlashSaleProduct(ctx, flashSaleID, productID)
+}
+
+func TestSaleCatalogFetchOutlivesCaller(t *testing.T) {
+	db := &slowSaleDB{fakeSaleDB: fakeSaleDB{calls: map[string]int{}}, started: make(chan struct{}), release: make(chan struct{})}
+	c := NewSaleCatalog(db, fakeSaleRedis{}, time.Hour)
+	now := time.Now()
+	fs := &domain.FlashSale{ID: 7, StartAt: now.Add(-time.Minute), EndAt: now.Add(time.Hour)}
+
+	// the caller leading the shared fetch goes away mid-read
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-db.started
+		cancel()
+		close(db.release)
+	}()
+	if p, err := c.SaleProduct(ctx, fs, "1"); err != nil || p == nil {
+		t.Fatalf("product = %v, %v", p, err)
+	}
+	// cached for everyone else
+	if _, err := c.SaleProduct(context.Background(), fs, "1"); err != nil || db.calls["1"] != 1 {
+		t.Fatalf("second lookup = %v, %d DB reads", err, db.calls["1"])
+	}
+}
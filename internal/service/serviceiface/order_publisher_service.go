@@ -1,6 +1,9 @@
 package serviceiface
 
-import "context"
+import (
+	"context"
+	"flashsale/internal/dto"
+)
 
 /*
 
@@ -10,5 +13,6 @@ import "context"
 
 // OrderPublisher interface
 type OrderPublisher interface {
-	PublishOrder(ctx context.Context, orderID, userID, productID string) error
+	// Timestamp is set on publish when zero
+	PublishOrder(ctx context.Context, msg dto.OrderMessage) error
 }
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"flashsale/internal/domain"
+	"flashsale/internal/repository/repositoryiface"
+	"log"
+	"sync"
+	"time"
+)
+
+// SoldOutCache answers "is it sold out" in process, so precheck rejects without a Redis call
+// kept up to date by pub/sub, with a periodic resync for missed events
+type SoldOutCache struct {
+	repo repositoryiface.SoldOutRepository
+
+	mu       sync.RWMutex
+	sales    map[int64]map[string]bool // sale -> sold out products, a sale is synced once seen
+	watchers map[chan domain.SoldOutEvent]struct{}
+}
+
+func NewSoldOutCache(repo repositoryiface.SoldOutRepository) *SoldOutCache {
+	return &SoldOutCache{
+		repo:     repo,
+		sales:    make(map[int64]map[string]bool),
+		watchers: make(map[chan domain.SoldOutEvent]struct{}),
+	}
+}
+
+// IsSoldOut: false for a sale not synced yet, precheck Lua still has the final say
+func (c *SoldOutCache) IsSoldOut(flashSaleID int64, productID string) bool {
+	c.mu.RLock()
+	products, ok := c.sales[flashSaleID]
+	soldOut := products[productID]
+	c.mu.RUnlock()
+	if !ok {
+		c.mu.Lock()
+		if _, ok := c.sales[flashSaleID]; !ok {
+			c.sales[flashSaleID] = make(map[string]bool) // picked up by the next resync
+		}
+		c.mu.Unlock()
+	}
+	return soldOut
+}
+
+// MarkLocal records a sold out seen by this instance (precheck OUT_OF_STOCK), not broadcast
+func (c *SoldOutCache) MarkLocal(flashSaleID int64, productID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sales[flashSaleID] == nil {
+		c.sales[flashSaleID] = make(map[string]bool)
+	}
+	c.sales[flashSaleID][productID] = true
+}
+
+// Run subscribes to sold out events and resyncs known sales every interval, until ctx is done
+func (c *SoldOutCache) Run(ctx context.Context, resync time.Duration) {
+	go func() {
+		for ctx.Err() == nil {
+			err := c.repo.Subscribe(ctx, c.apply)
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("[soldout] warn: subscription lost, retrying: %v", err)
+			time.Sleep(time.Second)
+			c.resync(ctx) // events may have been missed meanwhile
+		}
+	}()
+
+	ticker := time.NewTicker(resync)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.resync(ctx)
+		}
+	}
+}
+
+func (c *SoldOutCache) resync(ctx context.Context) {
+	c.mu.RLock()
+	ids := make([]int64, 0, len(c.sales))
+	for id := range c.sales {
+		ids = append(ids, id)
+	}
+	c.mu.RUnlock()
+
+	for _, id := range ids {
+		products, err := c.repo.List(ctx, id)
+		if err != nil {
+			log.Printf("[soldout] warn: resync sale=%d failed: %v", id, err)
+			continue
+		}
+		set := make(map[string]bool, len(products))
+		for _, p := range products {
+			set[p] = true
+		}
+		c.mu.Lock()
+		c.sales[id] = set
+		c.mu.Unlock()
+	}
+}
+
+func (c *SoldOutCache) apply(ev domain.SoldOutEvent) {
+	c.mu.Lock()
+	if c.sales[ev.FlashSaleID] == nil {
+		c.sales[ev.FlashSaleID] = make(map[string]bool)
+	}
+	if ev.SoldOut {
+		c.sales[ev.FlashSaleID][ev.ProductID] = true
+	} else {
+		delete(c.sales[ev.FlashSaleID], ev.ProductID)
+	}
+	for w := range c.watchers {
+		select {
+		case w <- ev:
+		default: // slow watcher, drop rather than block the subscription
+		}
+	}
+	c.mu.Unlock()
+}
+
+// Watch streams events to a frontend connection until stop is called
+func (c *SoldOutCache) Watch() (events <-chan domain.SoldOutEvent, stop func()) {
+	ch := make(chan domain.SoldOutEvent, 16)
+	c.mu.Lock()
+	c.watchers[ch] = struct{}{}
+	c.mu.Unlock()
+	return ch, func() {
+		c.mu.Lock()
+		delete(c.watchers, ch)
+		c.mu.Unlock()
+	}
+}
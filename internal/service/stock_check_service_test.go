@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"flashsale/internal/cache"
+	"flashsale/internal/domain"
+	"flashsale/internal/repository/redis"
+	"flashsale/internal/repository/repositoryiface"
+	"reflect"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// fakeSaleStocks is flash_sale_products of one sale
+type fakeSaleStocks struct {
+	repositoryiface.StockRepository
+	stocks []domain.ProductStock
+}
+
+func (r *fakeSaleStocks) GetSaleStocks(ctx context.Context, flashSaleID int64) ([]domain.ProductStock, error) {
+	return r.stocks, nil
+}
+
+func TestCheckSaleSumsBuckets(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	redisStock, err := redis.NewRedisStockRepo(rdb, "../../scripts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := &fakeSaleStocks{stocks: []domain.ProductStock{{ProductID: 1, Stock: 5}, {ProductID: 2, Stock: 3}, {ProductID: 3, Stock: 4}, {ProductID: 4, Stock: 2}}}
+	check := NewStockCheckService(db, redisStock)
+	ctx := context.Background()
+
+	// 1: 3 buckets adding up to the DB, 2: single key one short, 3: buckets one over, 4: only the cached DB value
+	mr.HSet(cache.StockBucketsKey, "1", "3")
+	for i, v := range []string{"2", "0", "3"} {
+		mr.Set(cache.StockKeys("1", 3)[i], v)
+	}
+	mr.Set(cache.StockKey("2"), "2")
+	mr.HSet(cache.StockBucketsKey, "3", "2")
+	mr.Set(cache.StockKeys("3", 2)[0], "4")
+	mr.Set(cache.StockKeys("3", 2)[1], "1")
+	if err := redisStock.CacheStocks(ctx, []domain.ProductStock{{ProductID: 4, Stock: 2}}, stockFallbackTTL); err != nil {
+		t.Fatal(err)
+	}
+
+	diffs, err := check.CheckSale(ctx, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []StockDiff{
+		{ProductID: 2, DBStock: 3, RedisStock: 2, Live: true},
+		{ProductID: 3, DBStock: 4, RedisStock: 5, Live: true},
+		{ProductID: 4, DBStock: 2},
+	}
+	if !reflect.DeepEqual(diffs, want) {
+		t.Fatalf("diffs = %+v, want %+v", diffs, want)
+	}
+
+	// a restore lands in one of the buckets, the sum stays right
+	if err := redisStock.RestoreStock(ctx, "1", 3, 1); err != nil {
+		t.Fatal(err)
+	}
+	db.stocks = db.stocks[:1]
+	db.stocks[0].Stock = 6
+	if diffs, err := check.CheckSale(ctx, 7); err != nil || len(diffs) != 0 {
+		t.Fatalf("after restore = %+v, %v", diffs, err)
+	}
+
+	db.stocks = nil
+	if _, err := check.CheckSale(ctx, 8); err != ErrSaleNotFound {
+		t.Fatalf("unknown sale = %v", err)
+	}
+}
@@ -2,45 +2,130 @@ package service
 
 import (
 	"context"
+	"errors"
+	"flashsale/internal/domain"
 	"flashsale/internal/repository/repositoryiface"
 	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"time"
 
-	"github.com/redis/go-redis/v9"
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// how long DB stock is served from Redis while the live key is missing
+	stockFallbackTTL = 2 * time.Second
+	// a shared DB read serves every waiting caller, so it runs on its own deadline instead of the first caller's ctx
+	stockFetchTimeout = 3 * time.Second
 )
 
 type StockService interface {
 	GetStock(ctx context.Context, productID int64) (int64, error)
+	// GetSaleStock returns the stock of every product of the sale, ordered by product id
+	GetSaleStock(ctx context.Context, flashSaleID int64) ([]domain.ProductStock, error)
 }
 
 type stockerService struct {
-	rdb       *redis.Client
-	stockRepo repositoryiface.StockRepository
+	stockRepo  repositoryiface.StockRepository
+	redisStock repositoryiface.RedisStockRepository
+	saleCache  repositoryiface.FlashSaleRedisRepository
+	group      singleflight.Group // one DB read per product / sale at a time
 }
 
-func NewStockService(rdb *redis.Client, stockRepo repositoryiface.StockRepository) StockService {
+func NewStockService(stockRepo repositoryiface.StockRepository, redisStock repositoryiface.RedisStockRepository, saleCache repositoryiface.FlashSaleRedisRepository) StockService {
 	return &stockerService{
-		rdb:       rdb,
-		stockRepo: stockRepo,
+		stockRepo:  stockRepo,
+		redisStock: redisStock,
+		saleCache:  saleCache,
 	}
 }
 
 func (s *stockerService) GetStock(ctx context.Context, productID int64) (int64, error) {
-	key := fmt.Sprintf("flashsale:stock:%d", productID)
-
 	// 1. check Redis first (fast path)
-	if v, _ := s.rdb.Get(ctx, key).Int64(); v >= 0 {
+	stocks, err := s.redisStock.GetStocks(ctx, []int64{productID})
+	if err != nil {
+		log.Printf("[stock service] warn: redis stock read failed product=%d: %v", productID, err)
+	}
+	if v, ok := stocks[productID]; ok {
 		return v, nil
 	}
 
-	// 2. DB fallback
-	stock, err := s.stockRepo.GetStock(ctx, productID)
-	if err != err {
-		return 0, err
+	// 2. DB fallback, concurrent misses share one read
+	v, err, _ := s.group.Do("product:"+strconv.FormatInt(productID, 10), func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), stockFetchTimeout)
+		defer cancel()
+		stock, err := s.stockRepo.GetStock(ctx, productID)
+		if err != nil {
+			return nil, err
+		}
+		// 3. update redis
+		s.cacheStocks(ctx, []domain.ProductStock{{ProductID: productID, Stock: stock}})
+		return stock, nil
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrStockNotFound
+	}
+	if err != nil {
+		return 0, internal(err)
+	}
+	return v.(int64), nil
+}
+
+func (s *stockerService) GetSaleStock(ctx context.Context, flashSaleID int64) ([]domain.ProductStock, error) {
+	// 1. products of the sale, written by warm-up
+	ids, err := s.saleCache.GetSaleProductIDs(ctx, flashSaleID)
+	if err != nil {
+		log.Printf("[stock service] warn: redis sale products read failed sale=%d: %v", flashSaleID, err)
 	}
+	if len(ids) == 0 {
+		return s.saleStockFromDB(ctx, flashSaleID)
+	}
+	slices.Sort(ids)
 
-	// 3. update redis
-	s.rdb.Set(ctx, key, stock, 60) // 60s cache
+	// 2. pipelined stock reads
+	stocks, err := s.redisStock.GetStocks(ctx, ids)
+	if err != nil {
+		log.Printf("[stock service] warn: redis stock read failed sale=%d: %v", flashSaleID, err)
+		return s.saleStockFromDB(ctx, flashSaleID)
+	}
+	res := make([]domain.ProductStock, 0, len(ids))
+	for _, id := range ids {
+		v, ok := stocks[id]
+		if !ok {
+			// any miss -> one DB read for the whole sale
+			return s.saleStockFromDB(ctx, flashSaleID)
+		}
+		res = append(res, domain.ProductStock{ProductID: id, Stock: v})
+	}
+	return res, nil
+}
 
-	return stock, nil
+func (s *stockerService) saleStockFromDB(ctx context.Context, flashSaleID int64) ([]domain.ProductStock, error) {
+	v, err, _ := s.group.Do(fmt.Sprintf("sale:%d", flashSaleID), func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), stockFetchTimeout)
+		defer cancel()
+		stocks, err := s.stockRepo.GetSaleStocks(ctx, flashSaleID)
+		if err != nil {
+			return nil, err
+		}
+		s.cacheStocks(ctx, stocks)
+		return stocks, nil
+	})
+	if err != nil {
+		return nil, internal(err)
+	}
+	stocks := v.([]domain.ProductStock)
+	if len(stocks) == 0 {
+		return nil, ErrSaleNotFound
+	}
+	return stocks, nil
+}
 
+func (s *stockerService) cacheStocks(ctx context.Context, stocks []domain.ProductStock) {
+	if err := s.redisStock.CacheStocks(ctx, stocks, stockFallbackTTL); err != nil {
+		log.Printf("[stock service] warn: stock cache update failed: %v", err)
+	}
 }
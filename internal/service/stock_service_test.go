@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"flashsale/internal/cache"
+	"flashsale/internal/domain"
+	"flashsale/internal/repository/redis"
+	"flashsale/internal/repository/repositoryiface"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/jackc/pgx/v5"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// fakeStockDB is flash_sale_products, stocks by product, counts reads
+type fakeStockDB struct {
+	repositoryiface.StockRepository
+	stocks map[int64]int64
+	sales  map[int64][]domain.ProductStock
+	reads  int
+	// set: reads wait for release and fail with the ctx error they got
+	started, release chan struct{}
+}
+
+func (f *fakeStockDB) GetStock(ctx context.Context, productID int64) (int64, error) {
+	f.reads++
+	if f.release != nil {
+		close(f.started)
+		<-f.release
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+	}
+	v, ok := f.stocks[productID]
+	if !ok {
+		return 0, pgx.ErrNoRows
+	}
+	return v, nil
+}
+
+func (f *fakeStockDB) GetSaleStocks(ctx context.Context, flashSaleID int64) ([]domain.ProductStock, error) {
+	f.reads++
+	return f.sales[flashSaleID], nil
+}
+
+type stockEnv struct {
+	mr    *miniredis.Miniredis
+	db    *fakeStockDB
+	sales repositoryiface.FlashSaleRedisRepository
+	svc   StockService
+}
+
+func newStockEnv(t *testing.T) *stockEnv {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	redisStock, err := redis.NewRedisStockRepo(rdb, "../../scripts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := &fakeStockDB{stocks: map[int64]int64{}, sales: map[int64][]domain.ProductStock{}}
+	sales := redis.NewFlashSaleRedisRepo(rdb)
+	return &stockEnv{mr: mr, db: db, sales: sales, svc: NewStockService(db, redisStock, sales)}
+}
+
+func TestStockFallbackOutlivesCaller(t *testing.T) {
+	env := newStockEnv(t)
+	env.db.stocks[1] = 5
+	env.db.started, env.db.release = make(chan struct{}), make(chan struct{})
+
+	// the caller leading the shared DB read goes away mid-read
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-env.db.started
+		cancel()
+		close(env.db.release)
+	}()
+	if v, err := env.svc.GetStock(ctx, 1); err != nil || v != 5 {
+		t.Fatalf("stock = %d, %v", v, err)
+	}
+	// backfilled for everyone else
+	env.db.release = nil
+	if v, err := env.svc.GetStock(context.Background(), 1); err != nil || v != 5 || env.db.reads != 1 {
+		t.Fatalf("second read = %d, %v, %d DB reads", v, err, env.db.reads)
+	}
+}
+
+func TestGetStockLiveFirst(t *testing.T) {
+	env := newStockEnv(t)
+	ctx := context.Background()
+	env.db.stocks[1], env.db.stocks[2] = 5, 9
+	env.mr.Set(cache.StockKey("1"), "3")
+	env.mr.HSet(cache.StockBucketsKey, "2", "2")
+	env.mr.Set(cache.StockKeys("2", 2)[0], "1")
+	env.mr.Set(cache.StockKeys("2", 2)[1], "4")
+
+	if v, err := env.svc.GetStock(ctx, 1); err != nil || v != 3 {
+		t.Fatalf("single key = %d, %v", v, err)
+	}
+	if v, err := env.svc.GetStock(ctx, 2); err != nil || v != 5 {
+		t.Fatalf("buckets = %d, %v", v, err)
+	}
+	if env.db.reads != 0 {
+		t.Fatalf("%d DB reads with live stock", env.db.reads)
+	}
+}
+
+func TestGetStockDBFallback(t *testing.T) {
+	env := newStockEnv(t)
+	ctx := context.Background()
+	env.db.stocks[1] = 5
+
+	// not warmed up: DB value, kept briefly in Redis for the next readers
+	for i := 0; i < 2; i++ {
+		if v, err := env.svc.GetStock(ctx, 1); err != nil || v != 5 {
+			t.Fatalf("read %d = %d, %v", i, v, err)
+		}
+	}
+	if env.db.reads != 1 {
+		t.Fatalf("%d DB reads, want 1", env.db.reads)
+	}
+	env.mr.FastForward(stockFallbackTTL)
+	env.db.stocks[1] = 4
+	if v, err := env.svc.GetStock(ctx, 1); err != nil || v != 4 || env.db.reads != 2 {
+		t.Fatalf("after fallback expiry = %d, %v, %d DB reads", v, err, env.db.reads)
+	}
+
+	if _, err := env.svc.GetStock(ctx, 2); !errors.Is(err, ErrStockNotFound) {
+		t.Fatalf("unknown product = %v", err)
+	}
+}
+
+func TestGetSaleStock(t *testing.T) {
+	env := newStockEnv(t)
+	ctx := context.Background()
+	products := []domain.FlashSaleProduct{{FlashSaleID: 7, ProductID: 2}, {FlashSaleID: 7, ProductID: 1}}
+	if err := env.sales.SetSaleProducts(ctx, 7, products, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	env.mr.Set(cache.StockKey("1"), "3")
+	env.mr.Set(cache.StockKey("2"), "0")
+
+	// one pipelined Redis read, ordered by product id
+	want := []domain.ProductStock{{ProductID: 1, Stock: 3}, {ProductID: 2, Stock: 0}}
+	if got, err := env.svc.GetSaleStock(ctx, 7); err != nil || !reflect.DeepEqual(got, want) || env.db.reads != 0 {
+		t.Fatalf("live sale stock = %+v, %v, %d DB reads", got, err, env.db.reads)
+	}
+
+	// a product without live stock: one DB read for the whole sale
+	env.mr.Del(cache.StockKey("2"))
+	env.db.sales[7] = []domain.ProductStock{{ProductID: 1, Stock: 3}, {ProductID: 2, Stock: 6}}
+	if got, err := env.svc.GetSaleStock(ctx, 7); err != nil || !reflect.DeepEqual(got, env.db.sales[7]) || env.db.reads != 1 {
+		t.Fatalf("sale stock with a miss = %+v, %v, %d DB reads", got, err, env.db.reads)
+	}
+
+	if _, err := env.svc.GetSaleStock(ctx, 8); !errors.Is(err, ErrSaleNotFound) {
+		t.Fatalf("unknown sale = %v", err)
+	}
+}
@@ -7,6 +7,8 @@ import (
 
 // mock user service, for load testing purpose only
 
+var _ user.UserInterface = (*MockUserService)(nil)
+
 type MockUserService struct {
 	mockUsers map[string]*user.User
 }
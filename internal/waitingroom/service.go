@@ -0,0 +1,105 @@
+package waitingroom
+
+import (
+	"context"
+	"errors"
+	"flashsale/internal/domain"
+	"flashsale/internal/repository/repositoryiface"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrTicketRequired = errors.New("queue ticket required")
+	ErrTicketInvalid  = errors.New("queue ticket invalid")
+	ErrNotAdmitted    = errors.New("queue ticket not admitted yet")
+	ErrTicketUsed     = errors.New("queue ticket already used")
+)
+
+type Config struct {
+	AdmitRate     float64       // tickets released per second per room
+	AdmitInterval time.Duration // how often the admitter runs
+	TicketTTL     time.Duration
+}
+
+// Service: users join a room per product, the admitter releases tickets at AdmitRate,
+// precheck only accepts admitted tickets, each one once
+type Service struct {
+	cfg  Config
+	repo repositoryiface.WaitingRoomRepository
+}
+
+func NewService(cfg Config, repo repositoryiface.WaitingRoomRepository) *Service {
+	return &Service{cfg: cfg, repo: repo}
+}
+
+// Join returns the user's ticket of the product room, joining again keeps the place
+func (s *Service) Join(ctx context.Context, userID, productID string) (*domain.QueueTicket, error) {
+	return s.repo.Join(ctx, productID, userID, uuid.New().String(), s.cfg.TicketTTL)
+}
+
+// Status of a ticket, only its owner may see it
+func (s *Service) Status(ctx context.Context, ticketID, userID string) (*domain.QueueTicket, error) {
+	t, err := s.repo.GetTicket(ctx, ticketID)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil || t.UserID != userID {
+		return nil, ErrTicketInvalid
+	}
+	return t, nil
+}
+
+// Verify is the precheck gate: ticket must belong to user & product and be admitted
+// on ErrNotAdmitted the ticket is returned too, for the position
+func (s *Service) Verify(ctx context.Context, ticketID, userID, productID string) (*domain.QueueTicket, error) {
+	if ticketID == "" {
+		return nil, ErrTicketRequired
+	}
+	t, err := s.Status(ctx, ticketID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if t.ProductID != productID {
+		return nil, ErrTicketInvalid
+	}
+	if !t.IsAdmitted() {
+		return t, ErrNotAdmitted
+	}
+	return t, nil
+}
+
+// Use is Verify for a precheck: the admitted ticket is used up by the request with requestKey
+// a retry with the same non-empty requestKey (Idempotency-Key) passes again, any other gets ErrTicketUsed
+func (s *Service) Use(ctx context.Context, ticketID, userID, productID, requestKey string) (*domain.QueueTicket, error) {
+	t, err := s.Verify(ctx, ticketID, userID, productID)
+	if err != nil {
+		return t, err
+	}
+	ok, err := s.repo.UseTicket(ctx, t, requestKey)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrTicketUsed
+	}
+	return t, nil
+}
+
+// RunAdmitter releases tickets until ctx is done, safe to run on every API instance
+func (s *Service) RunAdmitter(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.AdmitInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.repo.Admit(ctx, s.cfg.AdmitRate); err != nil {
+				log.Printf("[waiting room] admit failed: %v", err)
+			}
+		}
+	}
+}
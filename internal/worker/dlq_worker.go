@@ -2,7 +2,6 @@ package worker
 
 import (
 	"context"
-	"flashsale/internal/cache"
 	"flashsale/internal/dto"
 	"flashsale/internal/service"
 	"fmt"
@@ -19,13 +18,10 @@ func NewDLQWorker(c *service.OrderCompensator) *DLQWorker {
 
 func (w *DLQWorker) Handle(ctx context.Context, msg dto.DLQMessage) error {
 	log.Printf("[DLQ worker] compensating order=%s reason=%s", msg.OrderNo, msg.Reason)
-	// 1. mark DB order FAILED
+	// mark DB order FAILED, restore stock & sync order status cache
 	err := w.compensator.Compensate(ctx, msg)
 	if err != nil {
 		return fmt.Errorf("[DLQ worker] compensate order=%s: %w", msg.OrderNo, err)
 	}
-	// 2. update redis cache
-	key := fmt.Sprintf("flashsale:order:%s", msg.OrderNo)
-	cache.Rdb.HSet(ctx, key, "status", "FAILED")
 	return nil
 }
@@ -5,25 +5,37 @@ import (
 	"encoding/json"
 	"errors"
 	"flashsale/internal/cache"
+	"flashsale/internal/domain"
 	"flashsale/internal/dto"
 	"flashsale/internal/repository/repositoryiface"
 	"fmt"
 	"log"
+	"strconv"
 	"time"
+
+	"github.com/jackc/pgx/v5"
 )
 
 var (
-	ErrOutOfStock = errors.New("out_of_stock")
-	ErrLuaReject  = errors.New("lua_reject")
+	ErrOutOfStock        = errors.New("out_of_stock")
+	ErrLuaReject         = errors.New("lua_reject")
+	ErrUserLimitExceeded = errors.New("user_limit_exceeded")
 )
 
 type OrderProcessor struct {
-	Repo       repositoryiface.OrderRepository
-	LuaScripts *cache.LuaScripts
+	Repo          repositoryiface.OrderRepository
+	LuaScripts    *cache.LuaScripts
+	StatusCache   repositoryiface.OrderStatusCacheRepository
+	FlashSaleRepo repositoryiface.FlashSaleRepository
+	UserQuota     repositoryiface.UserQuotaRepository
+	Claims        repositoryiface.PurchaseClaimRepository
+	SoldOut       repositoryiface.SoldOutRepository
+	Stock         repositoryiface.RedisStockRepository
+	Locks         repositoryiface.StockLockRepository
 }
 
-func NewOrderProcessor(repo repositoryiface.OrderRepository, lua *cache.LuaScripts) *OrderProcessor {
-	return &OrderProcessor{Repo: repo, LuaScripts: lua}
+func NewOrderProcessor(repo repositoryiface.OrderRepository, lua *cache.LuaScripts, statusCache repositoryiface.OrderStatusCacheRepository, flashSaleRepo repositoryiface.FlashSaleRepository, userQuota repositoryiface.UserQuotaRepository, claims repositoryiface.PurchaseClaimRepository, soldOut repositoryiface.SoldOutRepository, stock repositoryiface.RedisStockRepository, locks repositoryiface.StockLockRepository) *OrderProcessor {
+	return &OrderProcessor{Repo: repo, LuaScripts: lua, StatusCache: statusCache, FlashSaleRepo: flashSaleRepo, UserQuota: userQuota, Claims: claims, SoldOut: soldOut, Stock: stock, Locks: locks}
 }
 
 // 1. deal ONE order
@@ -40,6 +52,15 @@ func (p *OrderProcessor) ProcessOrder(ctx context.Context, body []byte) (err err
 	msgTime := time.Unix(msg.Timestamp, 0)
 	if time.Since(msgTime) > 1*time.Hour {
 		log.Printf("[Worker] Discard expired message: %s", msg.OrderID)
+		if !msg.CreateOrder {
+			return nil
+		}
+		// a redelivery of a processed order already has its row, claim & stock belong to it
+		if _, err := p.Repo.GetOrderStatus(ctx, msg.OrderID); !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+		// no row yet, don't leave the queued marker pending
+		p.failUncreated(ctx, msg, "EXPIRED")
 		return nil
 	}
 
@@ -48,46 +69,49 @@ func (p *OrderProcessor) ProcessOrder(ctx context.Context, body []byte) (err err
 		return errors.New("forced failure for DLQ test")
 	}
 
+	// precheck doesn't take stock, only give back what DecrStock took
+	decremented := false
 	defer func() {
-		if err != nil {
+		if err != nil && decremented {
 			// DB failed -> restore redis
-			key := fmt.Sprintf("flashsale:stock:%s", msg.ProductID)
-			_ = cache.Rdb.IncrBy(context.Background(), key, 1)
+			_ = p.Stock.RestoreStock(context.Background(), msg.ProductID, msg.StockBuckets, 1)
 		}
-
 	}()
 
-	// 0. Idempotency check
+	// 0. Idempotency check, async orders have no row until processed
 	status, err := p.Repo.GetOrderStatus(ctx, msg.OrderID)
-	if err != nil {
+	if err != nil && !(msg.CreateOrder && errors.Is(err, pgx.ErrNoRows)) {
 		return err
 	}
-	if status == "SUCCESS" || status == "FAILED" {
+	if domain.OrderStatus(status).IsFinal() {
 		return nil // already processed
 	}
 
-	if p.LuaScripts == nil || p.LuaScripts.PrecheckSHA.SHA == "" {
-		return errors.New("lua scripts not loaded")
-	}
-
-	// 1. redis lua finalize (prevent duplicated purchasing)
-	lua := p.LuaScripts.FinalizeSHA
-	userSetKey := fmt.Sprintf("flashsale:purchased:%s", msg.ProductID)
-	allowed, err := lua.Run(ctx, cache.Rdb, []string{userSetKey}, msg.UserID).Bool()
+	// 1. redis lua finalize (prevent duplicated purchasing), only the order owning the user's claim passes
+	allowed, err := p.LuaScripts.Finalize(ctx, msg.ProductID, msg.UserID, msg.OrderID, msg.StockBuckets)
 	if err != nil {
 		return fmt.Errorf("[worker] lua finalize failed: %w", err)
 	}
 	if !allowed {
+		// duplicate of another order of the user, not ours to release
+		if msg.CreateOrder {
+			if err := p.createFailed(ctx, msg, "DUPLICATE_ORDER"); err != nil {
+				return fmt.Errorf("[worker] create duplicate order failed: %w", err)
+			}
+		} else if err := p.Repo.MarkOrderFailed(ctx, msg.OrderID, "DUPLICATE_ORDER"); err != nil {
+			return fmt.Errorf("[worker] mark duplicate order failed: %w", err)
+		}
+		p.syncStatus(ctx, msg, domain.OrderFailed, "DUPLICATE_ORDER")
 		return ErrLuaReject
 	}
 
 	// 2. DB distributed lock
 	lockKey := fmt.Sprintf("lock:product:%s", msg.ProductID)
-	acquired, err := p.Repo.AcquireStockLock(ctx, lockKey, 5)
+	acquired, err := p.Locks.AcquireStockLock(ctx, lockKey, 5)
 	if err != nil || !acquired {
 		return fmt.Errorf("[worker] %s acquire lock failed: %w", msg.ProductID, err)
 	}
-	defer p.Repo.ReleaseStockLock(ctx, lockKey)
+	defer p.Locks.ReleaseStockLock(ctx, lockKey)
 
 	// 3. DB transaction
 	tx, err := p.Repo.BeginTx(ctx)
@@ -96,29 +120,166 @@ func (p *OrderProcessor) ProcessOrder(ctx context.Context, body []byte) (err err
 	}
 	defer tx.Rollback(ctx)
 
-	// 3-1. reduce stock
+	// 3-0. async mode: create the order row in the same tx as the stock update
+	if msg.CreateOrder {
+		err := p.Repo.CreateOrderTx(ctx, tx, orderFromMessage(msg, domain.OrderPending, ""))
+		if errors.Is(err, domain.ErrDuplicateOrder) {
+			// Redis claim was lost, DB still has the user's active order
+			tx.Rollback(ctx)
+			if err := p.createFailed(ctx, msg, "DUPLICATE_ORDER"); err != nil {
+				return fmt.Errorf("[worker] create duplicate order failed: %w", err)
+			}
+			p.syncStatus(ctx, msg, domain.OrderFailed, "DUPLICATE_ORDER")
+			p.release(ctx, msg)
+			return ErrLuaReject
+		}
+		if err != nil {
+			return fmt.Errorf("[worker] create order failed: %w", err)
+		}
+	}
+
+	// 3-1. re-verify per user sale limits, Redis reservation may have been lost or bypassed
+	var fs *domain.FlashSale
+	if msg.FlashSaleID != 0 {
+		fs, err = p.FlashSaleRepo.GetFlashSaleByID(ctx, msg.FlashSaleID)
+		if err != nil {
+			return fmt.Errorf("[worker] get flash sale %d failed: %w", msg.FlashSaleID, err)
+		}
+	}
+	if fs != nil && fs.HasUserLimits() {
+		usage, err := p.Repo.UserSaleUsageTx(ctx, tx, fs.ID, msg.UserID, msg.ProductID)
+		if err != nil {
+			return fmt.Errorf("[worker] user sale usage failed: %w", err)
+		}
+		if !fs.AllowsPurchase(usage) {
+			_ = p.Repo.MarkOrderFailedTx(ctx, tx, msg.OrderID, domain.ReasonUserLimitExceeded)
+			if err := tx.Commit(ctx); err == nil {
+				p.syncStatus(ctx, msg, domain.OrderFailed, domain.ReasonUserLimitExceeded)
+				p.release(ctx, msg)
+			}
+			return ErrUserLimitExceeded
+		}
+	}
+
+	// 3-2. reduce stock
 	success, err := p.Repo.ReduceStockTx(ctx, tx, msg.ProductID, 1)
 	if err != nil {
 		return fmt.Errorf("[worker] reduce stock failed: %w", err)
 	}
 	if !success {
 		// db no stock, set redis to 0 (sync)
-		key := fmt.Sprintf("flashsale:stock:%s", msg.ProductID)
-		_ = cache.Rdb.Set(ctx, key, 0, 0)
+		_ = p.Stock.ClearStock(ctx, msg.ProductID, msg.StockBuckets)
 
 		_ = p.Repo.MarkOrderFailedTx(ctx, tx, msg.OrderID, "OUT_OF_STOCK")
-		_ = tx.Commit(ctx)
+		if err := tx.Commit(ctx); err == nil {
+			p.syncStatus(ctx, msg, domain.OrderFailed, "OUT_OF_STOCK")
+			p.release(ctx, msg)
+		}
+		p.markSoldOut(ctx, fs, msg.ProductID)
 		return ErrOutOfStock
 	}
 
-	// 3-2. Mark success
+	// 3-3. Mark success
 	err = p.Repo.MarkOrderSuccessTx(ctx, tx, msg.OrderID)
 	if err != nil {
 		return fmt.Errorf("[worker] create order failed: %w", err)
 	}
 
-	key := fmt.Sprintf("flashsale:stock:%s", msg.ProductID)
-	_ = cache.Rdb.Decr(ctx, key)
+	deducted, remaining, decrErr := p.Stock.DecrStock(ctx, msg.ProductID, msg.StockBuckets)
+	decremented = decrErr == nil && deducted
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	p.syncStatus(ctx, msg, domain.OrderSuccess, "")
+	if decrErr == nil && remaining <= 0 {
+		p.markSoldOut(ctx, fs, msg.ProductID)
+	}
+	return nil
+}
+
+// markSoldOut flags the product & broadcasts it, so API instances stop running precheck for it
+func (p *OrderProcessor) markSoldOut(ctx context.Context, fs *domain.FlashSale, productID string) {
+	if p.SoldOut == nil || fs == nil {
+		return // messages without sale id
+	}
+	ttl := fs.TTL(time.Now())
+	if ttl <= 0 {
+		return
+	}
+	if err := p.SoldOut.Mark(ctx, fs.ID, productID, ttl); err != nil {
+		log.Printf("[Worker] warn: mark sold out failed sale=%d product=%s: %v", fs.ID, productID, err)
+	}
+}
+
+// syncStatus updates the order status cache after DB commit
+// DB is the source of truth, so a cache failure is only logged
+func (p *OrderProcessor) syncStatus(ctx context.Context, msg dto.OrderMessage, status domain.OrderStatus, reason string) {
+	if p.StatusCache == nil {
+		return
+	}
+	err := p.StatusCache.SaveStatus(ctx, domain.OrderStatusSnapshot{
+		OrderNo:   msg.OrderID,
+		UserID:    msg.UserID,
+		Status:    status,
+		Reason:    reason,
+		CreatedAt: time.Unix(msg.Timestamp, 0),
+	}, domain.OrderStatusCacheTTL)
+	if err != nil {
+		log.Printf("[Worker] warn: order status cache update failed order=%s: %v", msg.OrderID, err)
+	}
+}
 
+// orderFromMessage builds the order row of an async created order
+func orderFromMessage(msg dto.OrderMessage, status domain.OrderStatus, reason string) *domain.Order {
+	productID, _ := strconv.ParseInt(msg.ProductID, 10, 64)
+	o := &domain.Order{
+		OrderNo:     msg.OrderID,
+		UserID:      msg.UserID,
+		ProductID:   productID,
+		FlashSaleID: msg.FlashSaleID,
+		Price:       msg.Price,
+		Status:      string(status),
+	}
+	if reason != "" {
+		o.FailReason = &reason
+	}
+	return o
+}
+
+// createFailed inserts an async order directly as failed
+func (p *OrderProcessor) createFailed(ctx context.Context, msg dto.OrderMessage, reason string) error {
+	tx, err := p.Repo.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if err := p.Repo.CreateOrderTx(ctx, tx, orderFromMessage(msg, domain.OrderFailed, reason)); err != nil {
+		return err
+	}
 	return tx.Commit(ctx)
 }
+
+// failUncreated fails an async order that never reached the stock update
+func (p *OrderProcessor) failUncreated(ctx context.Context, msg dto.OrderMessage, reason string) {
+	if err := p.createFailed(ctx, msg, reason); err != nil {
+		log.Printf("[Worker] warn: create failed order failed order=%s: %v", msg.OrderID, err)
+	}
+	p.syncStatus(ctx, msg, domain.OrderFailed, reason)
+	p.release(ctx, msg)
+}
+
+// release gives back the precheck claim & reservation of a failed order
+func (p *OrderProcessor) release(ctx context.Context, msg dto.OrderMessage) {
+	if p.Claims != nil {
+		if err := p.Claims.Release(ctx, msg.ProductID, msg.UserID, msg.OrderID, msg.StockBuckets); err != nil {
+			log.Printf("[Worker] warn: release purchase claim failed order=%s: %v", msg.OrderID, err)
+		}
+	}
+	if p.UserQuota == nil || msg.FlashSaleID == 0 {
+		return
+	}
+	if err := p.UserQuota.Release(ctx, msg.FlashSaleID, msg.UserID, msg.ProductID); err != nil {
+		log.Printf("[Worker] warn: release user quota failed order=%s: %v", msg.OrderID, err)
+	}
+}
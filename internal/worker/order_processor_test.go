@@ -0,0 +1,335 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flashsale/internal/cache"
+	"flashsale/internal/domain"
+	"flashsale/internal/dto"
+	"flashsale/internal/repository/redis"
+	"flashsale/internal/repository/repositoryiface"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/jackc/pgx/v5"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// fakeTx applies the staged writes on Commit, Rollback drops them
+type fakeTx struct {
+	pgx.Tx
+	ops []func()
+}
+
+func (tx *fakeTx) Commit(ctx context.Context) error {
+	for _, op := range tx.ops {
+		op()
+	}
+	tx.ops = nil
+	return nil
+}
+
+func (tx *fakeTx) Rollback(ctx context.Context) error {
+	tx.ops = nil
+	return nil
+}
+
+// fakeOrderRepo is the orders & products tables in memory
+type fakeOrderRepo struct {
+	repositoryiface.OrderRepository
+	orders map[string]*domain.Order
+	stock  map[string]int64
+}
+
+func newFakeOrderRepo() *fakeOrderRepo {
+	return &fakeOrderRepo{orders: map[string]*domain.Order{}, stock: map[string]int64{}}
+}
+
+func (r *fakeOrderRepo) BeginTx(ctx context.Context) (pgx.Tx, error) {
+	return &fakeTx{}, nil
+}
+
+func (r *fakeOrderRepo) GetOrderStatus(ctx context.Context, orderNo string) (string, error) {
+	o, ok := r.orders[orderNo]
+	if !ok {
+		return "", pgx.ErrNoRows
+	}
+	return o.Status, nil
+}
+
+func (r *fakeOrderRepo) CreateOrderTx(ctx context.Context, tx pgx.Tx, o *domain.Order) error {
+	tx.(*fakeTx).ops = append(tx.(*fakeTx).ops, func() {
+		if _, ok := r.orders[o.OrderNo]; !ok {
+			r.orders[o.OrderNo] = o
+		}
+	})
+	return nil
+}
+
+func (r *fakeOrderRepo) ReduceStockTx(ctx context.Context, tx pgx.Tx, productID string, qty int64) (bool, error) {
+	if r.stock[productID] < qty {
+		return false, nil
+	}
+	tx.(*fakeTx).ops = append(tx.(*fakeTx).ops, func() { r.stock[productID] -= qty })
+	return true, nil
+}
+
+func (r *fakeOrderRepo) MarkOrderSuccessTx(ctx context.Context, tx pgx.Tx, orderNo string) error {
+	tx.(*fakeTx).ops = append(tx.(*fakeTx).ops, func() { r.orders[orderNo].Status = string(domain.OrderSuccess) })
+	return nil
+}
+
+func (r *fakeOrderRepo) MarkOrderFailedTx(ctx context.Context, tx pgx.Tx, orderNo, reason string) error {
+	tx.(*fakeTx).ops = append(tx.(*fakeTx).ops, func() {
+		r.orders[orderNo].Status = string(domain.OrderFailed)
+		r.orders[orderNo].FailReason = &reason
+	})
+	return nil
+}
+
+func (r *fakeOrderRepo) MarkOrderFailed(ctx context.Context, orderNo, reason string) error {
+	return r.MarkOrderFailedTx(ctx, nil, orderNo, reason)
+}
+
+// fakeFlashSaleRepo serves one sale without user limits
+type fakeFlashSaleRepo struct {
+	repositoryiface.FlashSaleRepository
+	sale domain.FlashSale
+}
+
+func (r *fakeFlashSaleRepo) GetFlashSaleByID(ctx context.Context, id int64) (*domain.FlashSale, error) {
+	s := r.sale
+	return &s, nil
+}
+
+type processorEnv struct {
+	mr      *miniredis.Miniredis
+	repo    *fakeOrderRepo
+	p       *OrderProcessor
+	scripts *cache.LuaScripts
+	soldOut repositoryiface.SoldOutRepository
+	status  repositoryiface.OrderStatusCacheRepository
+}
+
+const testSaleID = 7
+
+// newProcessorEnv wires the processor on miniredis like cmd/worker does, Postgres is faked
+func newProcessorEnv(t *testing.T) *processorEnv {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	const dir = "../../scripts"
+	scripts, err := cache.LoadLuaScripts(rdb, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	quota, err := redis.NewUserQuotaRedisRepo(rdb, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := redis.NewPurchaseClaimRedisRepo(rdb, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stock, err := redis.NewRedisStockRepo(rdb, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	env := &processorEnv{
+		mr:      mr,
+		repo:    newFakeOrderRepo(),
+		scripts: scripts,
+		soldOut: redis.NewSoldOutRedisRepo(rdb),
+		status:  redis.NewOrderStatusRedisRepo(rdb),
+	}
+	sales := &fakeFlashSaleRepo{sale: domain.FlashSale{ID: testSaleID, StartAt: now.Add(-time.Minute), EndAt: now.Add(time.Hour)}}
+	env.p = NewOrderProcessor(env.repo, scripts, env.status, sales, quota, claims, env.soldOut, stock, redis.NewStockLockRedisRepo(rdb))
+	return env
+}
+
+// precheck claims the user's slot like the API did before publishing msg
+func (e *processorEnv) precheck(t *testing.T, msg dto.OrderMessage) {
+	t.Helper()
+	res, err := e.scripts.FlashSalePreCheck(context.Background(), msg.ProductID, msg.UserID, msg.OrderID, time.Hour, msg.StockBuckets)
+	if err != nil || !res.Success {
+		t.Fatalf("precheck = %+v, %v", res, err)
+	}
+}
+
+func (e *processorEnv) process(t *testing.T, msg dto.OrderMessage) error {
+	t.Helper()
+	body, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e.p.ProcessOrder(context.Background(), body)
+}
+
+func (e *processorEnv) claimOwner(msg dto.OrderMessage) string {
+	owner, _ := e.mr.Get(cache.ClaimKey(msg.ProductID, msg.UserID, msg.StockBuckets))
+	return owner
+}
+
+func asyncMessage(orderID, userID string, buckets int) dto.OrderMessage {
+	return dto.OrderMessage{
+		OrderID:      orderID,
+		UserID:       userID,
+		ProductID:    "1",
+		FlashSaleID:  testSaleID,
+		CreateOrder:  true,
+		Price:        100,
+		StockBuckets: buckets,
+		Timestamp:    time.Now().Unix(),
+	}
+}
+
+func TestProcessOrderSuccess(t *testing.T) {
+	env := newProcessorEnv(t)
+	keys := cache.StockKeys("1", 2)
+	env.mr.Set(keys[0], "1")
+	env.mr.Set(keys[1], "1")
+	env.repo.stock["1"] = 2
+
+	msg := asyncMessage("o1", "U1", 2)
+	env.precheck(t, msg)
+	if err := env.process(t, msg); err != nil {
+		t.Fatalf("process = %v", err)
+	}
+
+	if o := env.repo.orders["o1"]; o == nil || o.Status != string(domain.OrderSuccess) {
+		t.Fatalf("order = %+v", o)
+	}
+	if env.repo.stock["1"] != 1 {
+		t.Fatalf("db stock = %d", env.repo.stock["1"])
+	}
+	a, _ := env.mr.Get(keys[0])
+	b, _ := env.mr.Get(keys[1])
+	if a+b != "01" && a+b != "10" {
+		t.Fatalf("redis buckets = %s, %s", a, b)
+	}
+	if ok, _ := env.mr.SIsMember(cache.PurchasedKey("1", "U1", 2), "U1"); !ok {
+		t.Fatal("user not in purchased set")
+	}
+	snap, err := env.status.GetStatus(context.Background(), "o1")
+	if err != nil || snap == nil || snap.Status != domain.OrderSuccess {
+		t.Fatalf("status cache = %+v, %v", snap, err)
+	}
+	if sold, _ := env.soldOut.List(context.Background(), testSaleID); len(sold) != 0 {
+		t.Fatalf("sold out with stock left: %v", sold)
+	}
+
+	// a redelivery of a processed order is a no-op
+	if err := env.process(t, msg); err != nil {
+		t.Fatalf("redelivery = %v", err)
+	}
+	if env.repo.stock["1"] != 1 {
+		t.Fatalf("redelivery reduced stock to %d", env.repo.stock["1"])
+	}
+}
+
+func TestProcessOrderLastItemMarksSoldOut(t *testing.T) {
+	env := newProcessorEnv(t)
+	env.mr.Set(cache.StockKey("1"), "1")
+	env.repo.stock["1"] = 1
+
+	msg := asyncMessage("o1", "U1", 0)
+	env.precheck(t, msg)
+	if err := env.process(t, msg); err != nil {
+		t.Fatalf("process = %v", err)
+	}
+	sold, err := env.soldOut.List(context.Background(), testSaleID)
+	if err != nil || len(sold) != 1 || sold[0] != "1" {
+		t.Fatalf("sold out = %v, %v", sold, err)
+	}
+}
+
+func TestProcessOrderDuplicate(t *testing.T) {
+	env := newProcessorEnv(t)
+	env.mr.Set(cache.StockKey("1"), "5")
+	env.repo.stock["1"] = 5
+
+	first := asyncMessage("o1", "U1", 0)
+	env.precheck(t, first)
+	// second order of the user without a claim, eg. replayed by a client
+	dup := asyncMessage("o2", "U1", 0)
+	if err := env.process(t, dup); !errors.Is(err, ErrLuaReject) {
+		t.Fatalf("duplicate = %v", err)
+	}
+	o := env.repo.orders["o2"]
+	if o == nil || o.Status != string(domain.OrderFailed) || o.FailReason == nil || *o.FailReason != "DUPLICATE_ORDER" {
+		t.Fatalf("duplicate order = %+v", o)
+	}
+	if owner := env.claimOwner(first); owner != "o1" {
+		t.Fatalf("claim owner = %q, the first order must keep it", owner)
+	}
+	if v, _ := env.mr.Get(cache.StockKey("1")); v != "5" || env.repo.stock["1"] != 5 {
+		t.Fatalf("stock touched by a duplicate: redis %s db %d", v, env.repo.stock["1"])
+	}
+}
+
+func TestProcessOrderDBOutOfStock(t *testing.T) {
+	env := newProcessorEnv(t)
+	env.mr.Set(cache.StockKey("1"), "1")
+	env.repo.stock["1"] = 0
+
+	msg := asyncMessage("o1", "U1", 0)
+	env.precheck(t, msg)
+	if err := env.process(t, msg); !errors.Is(err, ErrOutOfStock) {
+		t.Fatalf("process = %v", err)
+	}
+	o := env.repo.orders["o1"]
+	if o == nil || o.Status != string(domain.OrderFailed) || *o.FailReason != "OUT_OF_STOCK" {
+		t.Fatalf("order = %+v", o)
+	}
+	if v, _ := env.mr.Get(cache.StockKey("1")); v != "0" {
+		t.Fatalf("redis stock = %s, want synced to 0", v)
+	}
+	if owner := env.claimOwner(msg); owner != "" {
+		t.Fatalf("claim of a failed order kept by %q", owner)
+	}
+}
+
+func TestProcessOrderExpired(t *testing.T) {
+	t.Run("no row yet", func(t *testing.T) {
+		env := newProcessorEnv(t)
+		msg := asyncMessage("o1", "U1", 0)
+		env.mr.Set(cache.StockKey("1"), "1")
+		env.precheck(t, msg)
+
+		msg.Timestamp = time.Now().Add(-2 * time.Hour).Unix()
+		if err := env.process(t, msg); err != nil {
+			t.Fatalf("process = %v", err)
+		}
+		o := env.repo.orders["o1"]
+		if o == nil || o.Status != string(domain.OrderFailed) || *o.FailReason != "EXPIRED" {
+			t.Fatalf("order = %+v", o)
+		}
+		if owner := env.claimOwner(msg); owner != "" {
+			t.Fatalf("claim of an expired order kept by %q", owner)
+		}
+	})
+
+	t.Run("already processed", func(t *testing.T) {
+		env := newProcessorEnv(t)
+		msg := asyncMessage("o1", "U1", 0)
+		env.mr.Set(cache.StockKey("1"), "1")
+		env.precheck(t, msg)
+		env.repo.orders["o1"] = &domain.Order{OrderNo: "o1", UserID: "U1", ProductID: 1, Status: string(domain.OrderSuccess)}
+
+		msg.Timestamp = time.Now().Add(-2 * time.Hour).Unix()
+		if err := env.process(t, msg); err != nil {
+			t.Fatalf("process = %v", err)
+		}
+		if o := env.repo.orders["o1"]; o.Status != string(domain.OrderSuccess) {
+			t.Fatalf("processed order turned %s", o.Status)
+		}
+		if owner := env.claimOwner(msg); owner != "o1" {
+			t.Fatalf("claim owner = %q, the processed order must keep it", owner)
+		}
+	})
+}
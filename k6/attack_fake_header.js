@@ -1,4 +1,5 @@
 import http from 'k6/http';
+import { check } from 'k6';
 
 export let options = {
     vus: 150,
@@ -14,5 +15,10 @@ export default function () {
         "User-Agent": "FakeBrowser/9.9"
     };
 
-    http.post(url, JSON.stringify({ product_id: "1001" }), { headers });
+    const res = http.post(url, JSON.stringify({ product_id: "1001" }), { headers });
+
+    // spoofed X-User-ID without a signed token must be rejected
+    check(res, {
+        "status is 401": (r) => r.status === 401,
+    });
 }
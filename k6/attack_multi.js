@@ -1,4 +1,5 @@
 import http from 'k6/http';
+import { authHeaders } from './lib/auth.js';
 
 export let options = {
     vus: 300,
@@ -11,12 +12,10 @@ export default function () {
     const uid = Math.floor(Math.random() * 2000000);
 
     http.post(url, JSON.stringify({
-        user_id: `bot_${uid}`,
         product: "p1",
     }), {
-        headers: {
-            "Content-Type": "application/json",
+        headers: Object.assign(authHeaders(`bot_${uid}`), {
             "User-Agent": `Bot-${uid}`
-        }
+        })
     });
 }
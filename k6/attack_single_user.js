@@ -1,4 +1,5 @@
 import http from 'k6/http';
+import { authHeaders } from './lib/auth.js';
 
 export let options = {
     vus: 200,
@@ -9,9 +10,8 @@ export default function () {
     const url = 'http://localhost:8080/flashsale/precheck';
 
     const payload = JSON.stringify({
-        user_id: "attacker_1",
         product: "p1",
     });
 
-    http.post(url, payload, { headers: { "Content-Type": "application/json" } });
+    http.post(url, payload, { headers: authHeaders("attacker_1") });
 }
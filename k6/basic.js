@@ -1,5 +1,6 @@
 import http from 'k6/http';
 import { sleep } from 'k6';
+import { authHeaders } from './lib/auth.js';
 
 export let options = {
     vus: 10,
@@ -10,11 +11,10 @@ export default function () {
     const url = 'http://localhost:8080/flashsale/precheck';
 
     let payload = JSON.stringify({
-        user_id: `user_${__VU}_${__ITER}`,
         product: 'p1',
     });
 
-    let headers = { 'Content-Type': 'application/json' };
+    let headers = authHeaders(`user_${__VU}_${__ITER}`);
 
     http.post(url, payload, { headers });
 
@@ -1,5 +1,6 @@
 import http from 'k6/http';
 import { check, sleep } from 'k6';
+import { authHeaders } from './lib/auth.js';
 
 export let options = {
   stages: [
@@ -25,12 +26,11 @@ export default function () {
   const finalUserId = isForceFail ? 'force-fail' : userId;
 
   const payload = JSON.stringify({
-    user_id: finalUserId,
     product_id: '1001',
   });
 
   const params = {
-    headers: { 'Content-Type': 'application/json' },
+    headers: authHeaders(finalUserId),
   };
 
   const res = http.post(`${BASE_URL}/flashsale/precheck`, payload, params);
@@ -0,0 +1,29 @@
+import crypto from 'k6/crypto';
+import encoding from 'k6/encoding';
+
+// mint HS256 bearer tokens with the same local key as the API (AUTH_HMAC_SECRET)
+const SECRET = __ENV.AUTH_HMAC_SECRET || 'local-dev-secret-change-me';
+const KEY_ID = __ENV.AUTH_KEY_ID || 'local';
+
+function b64url(s) {
+    return encoding.b64encode(s, 'rawurl');
+}
+
+export function userToken(userID, role) {
+    const now = Math.floor(Date.now() / 1000);
+    const header = b64url(JSON.stringify({ alg: 'HS256', typ: 'JWT', kid: KEY_ID }));
+    const claims = { sub: userID, iat: now, exp: now + 3600 };
+    if (role) {
+        claims.role = role;
+    }
+    const payload = b64url(JSON.stringify(claims));
+    const sig = crypto.hmac('sha256', SECRET, `${header}.${payload}`, 'base64rawurl');
+    return `${header}.${payload}.${sig}`;
+}
+
+export function authHeaders(userID) {
+    return {
+        'Content-Type': 'application/json',
+        'Authorization': `Bearer ${userToken(userID)}`,
+    };
+}
@@ -0,0 +1,60 @@
+import http from "k6/http";
+import { check } from "k6";
+import { Counter, Trend } from "k6/metrics";
+import { authHeaders } from "./lib/auth.js";
+
+// compare the Redis-only limiter with the local tier:
+// 1. run with RATE_LIMIT_LOCAL_TIER=false, then with RATE_LIMIT_LOCAL_TIER=true
+// 2. before each run: redis-cli CONFIG RESETSTAT
+// 3. after each run: redis-cli INFO commandstats | grep evalsha
+// MODE only labels the output, the API config decides the mode
+const MODE = __ENV.MODE || "unknown";
+
+const decidedLocal = new Counter("rate_decided_local");
+const decidedRedis = new Counter("rate_decided_redis");
+const rejected = new Counter("rate_rejected");
+const precheckDuration = new Trend("precheck_duration", true);
+
+export const options = {
+    scenarios: {
+        // spike: few hot users + many cold users, well above the global budget
+        spike: {
+            executor: "ramping-arrival-rate",
+            startRate: 100,
+            timeUnit: "1s",
+            preAllocatedVUs: 200,
+            maxVUs: 1000,
+            stages: [
+                { target: 2000, duration: "10s" },
+                { target: 2000, duration: "20s" },
+                { target: 100, duration: "5s" },
+            ],
+        },
+    },
+    tags: { mode: MODE },
+};
+
+export default function () {
+    // 20% of requests come from 10 hot users
+    const userID = Math.random() < 0.2
+        ? `hot-${Math.floor(Math.random() * 10)}`
+        : Math.floor(Math.random() * 1000000).toString();
+
+    const payload = JSON.stringify({ product_id: "p1" });
+    const res = http.post("http://localhost:8080/flashsale/precheck", payload, { headers: authHeaders(userID) });
+    precheckDuration.add(res.timings.duration);
+
+    // X-Rate-Tier is only set when the local tier is on
+    if (res.headers["X-Rate-Tier"] === "local") {
+        decidedLocal.add(1);
+    } else {
+        decidedRedis.add(1);
+    }
+    if (res.status === 429) {
+        rejected.add(1);
+    }
+
+    check(res, {
+        "status is 200 or 429": (r) => r.status === 200 || r.status === 429,
+    });
+}
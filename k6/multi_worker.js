@@ -1,5 +1,6 @@
 import http from 'k6/http';
 import { check, sleep } from 'k6';
+import { authHeaders } from './lib/auth.js';
 
 export let options = {
   stages: [
@@ -27,10 +28,9 @@ export default function () {
   const res = http.post(
     `${BASE_URL}/flashsale/precheck`,
     JSON.stringify({
-      user_id: finalUserId,
       product_id: '1001',
     }),
-    { headers: { 'Content-Type': 'application/json' } }
+    { headers: authHeaders(finalUserId) }
   );
 
   check(res, {
@@ -1,6 +1,7 @@
 import http from "k6/http";
 import { sleep } from "k6";
 import { check } from "k6";
+import { authHeaders } from "./lib/auth.js";
 
 export const options = {
     vus: 50,          // 50 user simultaniously
@@ -12,11 +13,11 @@ export default function () {
     const productID = "p1";
 
     const payload = JSON.stringify({
-        user_id: userID,
         product_id: productID
     });
 
-    const headers = { "Content-Type": "application/json" };
+    // user identity comes from the bearer token
+    const headers = authHeaders(userID);
 
     const res = http.post("http://localhost:8080/flashsale/precheck", payload, { headers });
 
@@ -1,4 +1,5 @@
 import http from 'k6/http';
+import { authHeaders } from './lib/auth.js';
 
 export let options = {
     stages: [
@@ -14,14 +15,10 @@ export default function () {
     const uid = Math.floor(Math.random() * 1000000);
 
     const payload = JSON.stringify({
-        user_id: `user_${uid}`,
         product_id: '1001',
     });
 
     http.post(url, payload, {
-        headers: { 
-            "Content-Type": "application/json",
-            "X-User-ID": `user_${uid}`
-         }
+        headers: authHeaders(`user_${uid}`)
     });
 }
@@ -0,0 +1,38 @@
+import http from "k6/http";
+import { check, sleep } from "k6";
+import { authHeaders } from "./lib/auth.js";
+
+// waiting room flow, needs WAITING_ROOM_ENABLED=true on the API
+// join -> poll until admitted -> precheck with the ticket
+export const options = {
+    vus: 200,
+    iterations: 200,
+};
+
+const BASE = "http://localhost:8080/flashsale";
+
+export default function () {
+    const userID = `wr-${__VU}-${__ITER}`;
+    const headers = authHeaders(userID);
+
+    const join = http.post(`${BASE}/queue/join`, JSON.stringify({ product_id: "p1" }), { headers });
+    check(join, { "joined": (r) => r.status === 200 });
+    if (join.status !== 200) {
+        return;
+    }
+    const ticket = join.json("ticket");
+
+    // poll, the status route is rate limited to ~1/s per user
+    let admitted = join.json("admitted");
+    for (let i = 0; i < 60 && !admitted; i++) {
+        sleep(1);
+        const st = http.get(`${BASE}/queue/${ticket}`, { headers });
+        admitted = st.status === 200 && st.json("admitted");
+    }
+    check(admitted, { "admitted within 60s": (a) => a === true });
+
+    const res = http.post(`${BASE}/precheck`, JSON.stringify({ product_id: "p1" }), {
+        headers: Object.assign({ "X-Queue-Ticket": ticket }, headers),
+    });
+    check(res, { "precheck passed the gate": (r) => !r.body.includes('"QUEUE_') });
+}
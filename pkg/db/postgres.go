@@ -8,9 +8,8 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-var Pool *pgxpool.Pool
-
-func InitPostgresDB(host, port, user, password, db_name, ssl_mode string) error {
+// NewPostgresPool connects & pings, retrying while Postgres starts up
+func NewPostgresPool(host, port, user, password, db_name, ssl_mode string) (*pgxpool.Pool, error) {
 	dsn := fmt.Sprintf(
 		"postgres://%s:%s@%s:%s/%s?sslmode=%s", user, password, host, port, db_name, ssl_mode)
 	var err error
@@ -25,9 +24,9 @@ func InitPostgresDB(host, port, user, password, db_name, ssl_mode string) error
 			err = pool.Ping(ctx)
 			if err == nil {
 				cancel()
-				Pool = pool
-				return nil
+				return pool, nil
 			}
+			pool.Close()
 		}
 
 		cancel()
@@ -35,5 +34,5 @@ func InitPostgresDB(host, port, user, password, db_name, ssl_mode string) error
 		time.Sleep(3 * time.Second) // 每 3 秒重試一次
 	}
 
-	return fmt.Errorf("無法連線至 Postgres，已達最大重試次數: %w", err)
+	return nil, fmt.Errorf("無法連線至 Postgres，已達最大重試次數: %w", err)
 }
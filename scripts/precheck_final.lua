@@ -1,11 +1,31 @@
--- worker calls the script after successful purchased
--- finalize: add user to purchased set
+-- worker calls the script before the DB transaction
+-- finalize: only the order owning the user's claim may proceed, add user to purchased set
 
--- KEYS[1] = user_set_key
+-- KEYS[1] = claim_key: order_id owning the user's slot
+-- KEYS[2] = user_set_key
 -- ARGV[1] = user_id
+-- ARGV[2] = order_id
+-- returns 1 if order_id owns the slot, 0 if it's a duplicate
 
-local user_set_key = KEYS[1]
+local claim_key = KEYS[1]
+local user_set_key = KEYS[2]
 local user_id = ARGV[1]
+local order_id = ARGV[2]
 
-redis.call("SADD", user_set_key, user_id) -- add user_id into set held by key:user_set_key
-return 1
\ No newline at end of file
+local owner = redis.call("GET", claim_key)
+if owner == order_id then
+    redis.call("SADD", user_set_key, user_id) -- add user_id into set held by key:user_set_key
+    return 1
+end
+
+if owner then
+    return 0 -- slot belongs to another order
+end
+
+-- claim expired / lost (eg. Redis restart): first order to finalize takes the slot
+if redis.call("SISMEMBER", user_set_key, user_id) == 1 then
+    return 0
+end
+redis.call("SET", claim_key, order_id)
+redis.call("SADD", user_set_key, user_id)
+return 1
@@ -0,0 +1,19 @@
+-- give back the user's slot of a failed order, only if order_id still owns it
+
+-- KEYS[1] = claim_key: order_id owning the user's slot
+-- KEYS[2] = user_set_key
+-- ARGV[1] = user_id
+-- ARGV[2] = order_id
+
+local claim_key = KEYS[1]
+local user_set_key = KEYS[2]
+local user_id = ARGV[1]
+local order_id = ARGV[2]
+
+if redis.call("GET", claim_key) ~= order_id then
+    return 0 -- not ours, another order or already released
+end
+
+redis.call("DEL", claim_key)
+redis.call("SREM", user_set_key, user_id)
+return 1
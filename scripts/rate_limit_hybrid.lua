@@ -1,71 +1,227 @@
--- hybrid rate limiter
--- First do sliding window counter (short term attacks), then token bucket (long term rate limit, burst)
-
-
--- KEYS[1] = token_bucket_key, eg. "tb:user:U1"
--- KEYS[2] = sliding_key, eg. "sl:user:U1"
-
--- ARGV[1] = max_tokens: capacity, integer
--- ARGV[2] = refill_rate: tokens per second, number
--- ARGV[3] = now: seconds in float
--- ARGV[4] = cost: tokens to consume, integer, usually 1
--- ARGV[5] = sliding_limit: max reqs allowed in window
--- ARGV[6] = sliding_window_seconds, window size, integer
-
-
-local tb_key = KEYS[1]
-local sw_key = KEYS[2]
-
-local max_tokens = tonumber(ARGV[1])
-local refill_rate = tonumber(ARGV[2])
-local now = tonumber(ARGV[3])
-local cost = tonumber(ARGV[4])
-local sw_limit = tonumber(ARGV[5])
-local sw_size = tonumber(ARGV[6])
-
--- token bucket
-local tb_vals = redis.call("HGET", tb_key, "tokens", "last_refill")
-local tokens = tb_vals[1]
-local last_refill = tb_vals[2]
-
-if tokens == false or tokens == nil then
-    tokens = max_tokens
-    last_refill = now
-else
-    tokens = tonumber(tokens)
-    last_refill = tonumber(last_refill)
+-- hybrid rate limiter, layered: several budgets checked in ONE round-trip (one per slot in Redis Cluster)
+-- per layer: window limit (short term attacks), then token bucket (long term rate limit, burst)
+-- all-or-nothing: a request is only counted / charged when every layer of the call allows it
+
+-- window algorithms, selectable per layer:
+--   "fixed":           INCR + EXPIRE counter, cheap but allows 2x limit around window edges
+--   "sliding_counter": current + previous window counter weighted by overlap, one small hash
+--   "sliding_log":     sorted set of request timestamps, exact but O(limit) memory per key
+
+
+-- KEYS[2i-1] = token_bucket_key of layer i, eg. "tb:{route:user:U1}"
+-- KEYS[2i]   = window_key of layer i, eg. "swc:{route:user:U1}", type depends on algorithm
+-- standalone / sentinel: every layer in one call; Redis Cluster: keys of a call share one hash tag (slot),
+-- layers in other slots are separate calls
+
+-- ARGV[1] = now: seconds in float
+-- ARGV[2] = cost: tokens to consume, integer, usually 1
+-- ARGV[3] = request id: unique member for sliding_log
+-- ARGV[4] = n: number of layers
+-- per layer i, from ARGV[5 + (i-1)*6]:
+--   +0 name: layer name, eg. "global" / "ip" / "user"
+--   +1 max_tokens: capacity, integer
+--   +2 refill_rate: tokens per second, number
+--   +3 sliding_limit: max reqs allowed in window, 0 disables
+--   +4 sliding_window_seconds, window size, integer
+--   +5 window algorithm: "fixed" / "sliding_counter" / "sliding_log"
+
+-- return format: {allowed: 1/0, reason: "token"/"sliding", tokens_left, sliding_count, layer,
+--                 limit, remaining, reset_ms, retry_after_ms}
+-- rejected: the first layer that failed; allowed: the layer with least remaining quota
+--   limit/remaining: window quota when the layer has a window limit, else bucket capacity/tokens
+--   reset_ms: until the window count is back to 0, or the bucket is full again
+--   retry_after_ms: until this request would be allowed by the layer, 0 when allowed
+
+
+local now = tonumber(ARGV[1])
+local cost = tonumber(ARGV[2])
+local req_id = ARGV[3]
+local n = tonumber(ARGV[4])
+
+-- window_count returns requests counted in the window ending now (without this request)
+local function window_count(l)
+    if l.algo == "sliding_log" then
+        redis.call("ZREMRANGEBYSCORE", l.sw_key, "-inf", now - l.sw_size)
+        return redis.call("ZCARD", l.sw_key)
+    end
+
+    if l.algo == "sliding_counter" then
+        local h = redis.call("HMGET", l.sw_key, "w", "cur", "prev")
+        local w = math.floor(now / l.sw_size)
+        local stored_w = tonumber(h[1])
+        local cur, prev = 0, 0
+        if stored_w == w then
+            cur = tonumber(h[2]) or 0
+            prev = tonumber(h[3]) or 0
+        elseif stored_w == w - 1 then
+            prev = tonumber(h[2]) or 0
+        end
+        l.w, l.cur, l.prev = w, cur, prev
+        -- part of previous window still inside the sliding window
+        local overlap = 1 - (now - w * l.sw_size) / l.sw_size
+        return prev * overlap + cur
+    end
+
+    return tonumber(redis.call("GET", l.sw_key) or "0")
+end
+
+local function window_add(l)
+    if l.algo == "sliding_log" then
+        for c = 1, cost do
+            redis.call("ZADD", l.sw_key, now, req_id .. ":" .. c)
+        end
+        redis.call("EXPIRE", l.sw_key, math.ceil(l.sw_size) + 1)
+        return redis.call("ZCARD", l.sw_key)
+    end
+
+    if l.algo == "sliding_counter" then
+        l.cur = l.cur + cost
+        redis.call("HSET", l.sw_key, "w", l.w, "cur", l.cur, "prev", l.prev)
+        -- keep it while it's still the "previous" window
+        redis.call("EXPIRE", l.sw_key, math.ceil(l.sw_size) * 2)
+        return l.sw_count + cost
+    end
+
+    local count = redis.call("INCRBY", l.sw_key, cost)
+    if count == cost then
+        redis.call("EXPIRE", l.sw_key, l.sw_size)
+    end
+    return count
+end
+
+-- ms until a window slot is free for cost more requests
+local function window_retry_ms(l)
+    if l.algo == "sliding_log" then
+        -- the k-th oldest entry has to leave the window
+        local k = l.sw_count + cost - l.sw_limit
+        local e = redis.call("ZRANGE", l.sw_key, k - 1, k - 1, "WITHSCORES")
+        if e[2] == nil then
+            return 0
+        end
+        return math.max(0, (tonumber(e[2]) + l.sw_size - now) * 1000)
+    end
+
+    if l.algo == "sliding_counter" then
+        local w_start = l.w * l.sw_size
+        local room = l.sw_limit - cost - l.cur
+        if room >= 0 and l.prev > 0 then
+            -- wait until prev * overlap <= room
+            local x = 1 - room / l.prev
+            return math.max(0, (w_start + x * l.sw_size - now) * 1000)
+        end
+        -- current window alone is over: in next window, wait until cur * overlap <= limit - cost
+        local x = 0
+        if l.cur > 0 then
+            x = math.max(0, 1 - (l.sw_limit - cost) / l.cur)
+        end
+        return math.max(0, (w_start + l.sw_size + x * l.sw_size - now) * 1000)
+    end
+
+    return math.max(0, redis.call("PTTL", l.sw_key))
 end
 
-local delta = math.max(0, now - last_refill)
-local refill = delta * refill_rate
-tokens = math.min(max_tokens, tokens + refill)
-last_refill = now
+-- ms until the window holds no counted request
+local function window_reset_ms(l)
+    if l.algo == "sliding_log" then
+        local e = redis.call("ZRANGE", l.sw_key, -1, -1, "WITHSCORES")
+        if e[2] == nil then
+            return 0
+        end
+        return math.max(0, (tonumber(e[2]) + l.sw_size - now) * 1000)
+    end
+
+    if l.algo == "sliding_counter" then
+        -- current window requests are fully gone at the end of the next window
+        return math.max(0, ((l.w + 2) * l.sw_size - now) * 1000)
+    end
 
--- simple fixed window counter
-local sw_count = redis.call("INCR", sw_key)
-if tonumber(sw_count) == 1 then
-    redis.call("EXPIRE", sw_key, sw_size)
+    return math.max(0, redis.call("PTTL", l.sw_key))
 end
 
--- 1. Check sliding limit, if exceeded, update TB store & reject
-if sw_limit > 0 and tonumber(sw_count) > sw_limit then
-    -- persist token bucket state & return rejection with reason sliding
-    redis.call("HMSET", tb_key, "tokens", tokens, "last_refill", last_refill)
-    redis.call("EXPIRE", tb_key, math.ceil(math.max(1, (max_tokens / (refill_rate + 1e-9)) * 2)))
-    return {0, "sliding", tokens, sw_count}
+-- quota headers of a layer
+local function quota(l)
+    local bucket_full_ms = math.max(0, (l.max_tokens - l.tokens) / (l.refill_rate + 1e-9) * 1000)
+    if l.sw_limit > 0 then
+        local remaining = math.min(math.floor(l.tokens), l.sw_limit - math.ceil(l.sw_count))
+        return l.sw_limit, math.max(0, remaining), math.max(window_reset_ms(l), bucket_full_ms)
+    end
+    return math.floor(l.max_tokens), math.max(0, math.floor(l.tokens)), bucket_full_ms
 end
 
+local function reject(l, reason, retry_ms)
+    local limit, remaining, reset_ms = quota(l)
+    return {0, reason, tostring(l.tokens), math.floor(l.sw_count), l.name,
+        limit, remaining, math.ceil(reset_ms), math.ceil(retry_ms)}
+end
+
+local layers = {}
+
+-- 1. evaluate every layer without counting
+for i = 1, n do
+    local base = 5 + (i - 1) * 6
+    local l = {
+        tb_key = KEYS[2 * i - 1],
+        sw_key = KEYS[2 * i],
+        name = ARGV[base],
+        max_tokens = tonumber(ARGV[base + 1]),
+        refill_rate = tonumber(ARGV[base + 2]),
+        sw_limit = tonumber(ARGV[base + 3]),
+        sw_size = tonumber(ARGV[base + 4]),
+        algo = ARGV[base + 5],
+    }
+
+    -- token bucket refill
+    local tb_vals = redis.call("HMGET", l.tb_key, "tokens", "last_refill")
+    local tokens = tb_vals[1]
+    local last_refill = tb_vals[2]
+    if tokens == false or tokens == nil then
+        tokens = l.max_tokens
+        last_refill = now
+    else
+        tokens = tonumber(tokens)
+        last_refill = tonumber(last_refill)
+    end
+    local delta = math.max(0, now - last_refill)
+    l.tokens = math.min(l.max_tokens, tokens + delta * l.refill_rate)
+
+    -- 1-1. Check window limit, then token bucket
+    l.sw_count = 0
+    if l.sw_limit > 0 then
+        l.sw_count = window_count(l)
+        if l.sw_count + cost > l.sw_limit then
+            return reject(l, "sliding", window_retry_ms(l))
+        end
+    end
+    if l.tokens < cost then
+        -- persist refill so rejected layers don't lose accrued tokens
+        redis.call("HSET", l.tb_key, "tokens", l.tokens, "last_refill", now)
+        redis.call("EXPIRE", l.tb_key, math.ceil(math.max(1, (l.max_tokens / (l.refill_rate + 1e-9)) * 2)))
+        return reject(l, "token", (cost - l.tokens) / (l.refill_rate + 1e-9) * 1000)
+    end
+
+    layers[i] = l
+end
+
+-- 2. every layer allowed: consume tokens & count the request
+local tightest, t_limit, t_remaining, t_reset = nil, 0, 0, 0
+for i = 1, n do
+    local l = layers[i]
+    l.tokens = l.tokens - cost
+    redis.call("HSET", l.tb_key, "tokens", l.tokens, "last_refill", now)
+    redis.call("EXPIRE", l.tb_key, math.ceil(math.max(1, (l.max_tokens / (l.refill_rate + 1e-9)) * 2)))
+
+    if l.sw_limit > 0 then
+        l.sw_count = window_add(l)
+    end
+
+    local limit, remaining, reset_ms = quota(l)
+    if tightest == nil or remaining < t_remaining then
+        tightest, t_limit, t_remaining, t_reset = l, limit, remaining, reset_ms
+    end
+end
 
--- 2. Check tocken bucket, if enough tokens, consume & accept
--- return format: {allowed: 1/0, reason:"token"/"sliding", tokens_left, sliding_count}
-if tokens >= cost then
-    tokens = tokens - cost
-    redis.call("HMSET", tb_key, "tokens", tokens, "last_refill", last_refill)
-    redis.call("EXPIRE", tb_key, math.ceil(math.max(1, (max_tokens / (refill_rate + 1e-9)) * 2)))
-    return {1, "token", tokens, sw_count}
-else
-    -- not enough tokens, persist state & reject
-    redis.call("HMSET", tb_key, "tokens", tokens, "last_refill", last_refill)
-    redis.call("EXPIRE", tb_key, math.ceil(math.max(1, (max_tokens / (refill_rate + 1e-9)) * 2)))
-    return {0, "token", tokens, sw_count}
+if tightest == nil then
+    return {1, "token", "0", 0, "", 0, 0, 0, 0}
 end
+return {1, "token", tostring(tightest.tokens), math.floor(tightest.sw_count), tightest.name,
+    t_limit, t_remaining, math.ceil(t_reset), 0}
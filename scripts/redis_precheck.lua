@@ -1,26 +1,37 @@
 -- 1. Check stock key
 -- 2. Check if stock > 0
--- 3. Check if user has purchased
--- 4. Success: deduct 1 stock
-
--- KEY[1] stock_key
--- KEY[2] user_set_key
+-- 3. Check if user has purchased or has an order in progress
+-- 4. Claim the user slot for order_id
+-- 5. Success: deduct 1 stock
+-- per user sale limits are reserved afterwards by user_quota_reserve.lua
+
+-- all keys share one hash tag, one Redis Cluster slot
+-- KEY[1] user_set_key
+-- KEY[2] claim_key: order_id owning the user's slot, one key per user
+-- KEY[3] stock_key, optional: bucketed stock lives in other slots and is checked by the caller
 -- ARGV[1] user_id
+-- ARGV[2] order_id
+-- ARGV[3] claim ttl seconds
 
 
-local stock_key = KEYS[1]
-local user_set_key = KEYS[2]
+local user_set_key = KEYS[1]
+local claim_key = KEYS[2]
+local stock_key = KEYS[3]
 local user_id = ARGV[1]
+local order_id = ARGV[2]
+local claim_ttl = tonumber(ARGV[3]) or 0
 
 
 -- Get remaining stock
-local stock = tonumber(redis.call("GET", stock_key))
-if not stock then
-    return {0, "STOCK_NOT_FOUND"}
-end
-
-if stock <= 0 then
-    return {0, "OUT_OF_STOCK"}
+if stock_key then
+    local stock = tonumber(redis.call("GET", stock_key))
+    if not stock then
+        return {0, "STOCK_NOT_FOUND"}
+    end
+
+    if stock <= 0 then
+        return {0, "OUT_OF_STOCK"}
+    end
 end
 
 -- Check if purchased
@@ -29,8 +40,20 @@ if exists == 1 then
     return {0, "USER_ALREADY_PURCHASED"}
 end
 
+-- Claim the slot, finalize only succeeds for this order_id
+-- taken: another order of the user is still in progress
+local claimed
+if claim_ttl > 0 then
+    claimed = redis.call("SET", claim_key, order_id, "NX", "EX", claim_ttl)
+else
+    claimed = redis.call("SET", claim_key, order_id, "NX")
+end
+if not claimed then
+    return {0, "USER_ALREADY_PURCHASED"}
+end
+
 -- -- Deduct to Preserve stock
 -- redis.call("DECR", stock_key)
 
 -- Success callback
-return {1, "OK"}
\ No newline at end of file
+return {1, "OK"}
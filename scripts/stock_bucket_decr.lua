@@ -0,0 +1,13 @@
+-- Deduct 1 stock from one stock key (single key or one bucket)
+-- the caller moves on to the next bucket when this one is empty
+-- KEYS[1] stock key
+-- returns {deducted 0/1, stock left in the key, -1 if missing}
+
+local s = tonumber(redis.call("GET", KEYS[1]))
+if not s then
+    return {0, -1}
+end
+if s <= 0 then
+    return {0, s}
+end
+return {1, redis.call("DECR", KEYS[1])}
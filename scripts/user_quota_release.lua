@@ -0,0 +1,21 @@
+-- give back one item reserved by user_quota_reserve.lua
+
+-- KEYS[1] = user_quota_key
+-- ARGV[1] = product_id
+
+local quota_key = KEYS[1]
+local field = "p:" .. ARGV[1]
+
+local this_product = tonumber(redis.call("HGET", quota_key, field)) or 0
+if this_product <= 0 then
+    return 0 -- nothing reserved, already released
+end
+
+redis.call("HINCRBY", quota_key, "items", -1)
+if this_product == 1 then
+    redis.call("HDEL", quota_key, field)
+    redis.call("HINCRBY", quota_key, "products", -1)
+else
+    redis.call("HINCRBY", quota_key, field, -1)
+end
+return 1
@@ -0,0 +1,36 @@
+-- reserve one item of product_id against the user's sale limits
+-- runs apart from redis_precheck.lua: the quota key is per sale & user, the precheck keys per product,
+-- so in a Redis Cluster they live in different slots
+
+-- KEYS[1] = user_quota_key, hash: items, products, p:<product_id>
+-- ARGV[1] = product_id
+-- ARGV[2] = max items per user, 0 = unlimited
+-- ARGV[3] = max distinct products per user, 0 = unlimited
+-- ARGV[4] = ttl seconds
+
+local quota_key = KEYS[1]
+local product_id = ARGV[1]
+local max_items = tonumber(ARGV[2]) or 0
+local max_products = tonumber(ARGV[3]) or 0
+local quota_ttl = tonumber(ARGV[4]) or 0
+
+local q = redis.call("HMGET", quota_key, "items", "products", "p:" .. product_id)
+local items = tonumber(q[1]) or 0
+local products = tonumber(q[2]) or 0
+local this_product = tonumber(q[3]) or 0
+
+if max_items > 0 and items + 1 > max_items then
+    return 0
+end
+if this_product == 0 then
+    products = products + 1
+end
+if max_products > 0 and products > max_products then
+    return 0
+end
+
+redis.call("HSET", quota_key, "items", items + 1, "products", products, "p:" .. product_id, this_product + 1)
+if quota_ttl > 0 then
+    redis.call("EXPIRE", quota_key, quota_ttl)
+end
+return 1
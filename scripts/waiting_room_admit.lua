@@ -0,0 +1,40 @@
+-- KEYS[1] room hash {seq, admitted, last_ms}
+-- ARGV[1] admit rate per second
+-- advances admitted by the time passed since last_ms, never past seq
+-- uses Redis TIME, so any number of API instances can call it
+-- returns admitted, or -1 if the room expired
+
+if redis.call('EXISTS', KEYS[1]) == 0 then
+    return -1
+end
+
+local rate = tonumber(ARGV[1])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'seq', 'admitted', 'last_ms')
+local seq = tonumber(state[1]) or 0
+local admitted = tonumber(state[2]) or 0
+local last = tonumber(state[3])
+
+-- nobody waiting: don't bank admissions for a later burst
+if last == nil or admitted >= seq then
+    redis.call('HSET', KEYS[1], 'admitted', admitted, 'last_ms', now)
+    return admitted
+end
+
+local n = math.floor((now - last) * rate / 1000)
+if n <= 0 then
+    return admitted
+end
+
+if admitted + n >= seq then
+    admitted = seq
+    last = now
+else
+    admitted = admitted + n
+    -- keep the remainder for the next call
+    last = last + math.floor(n * 1000 / rate)
+end
+redis.call('HSET', KEYS[1], 'admitted', admitted, 'last_ms', last)
+return admitted
@@ -0,0 +1,23 @@
+-- KEYS[1] room hash {seq, admitted, last_ms}
+-- KEYS[2] user -> ticket id
+-- KEYS[3] new ticket hash
+-- all keys are hash tagged {product_id}, the set of rooms is updated by the caller
+-- ARGV[1] ticket id, ARGV[2] user id, ARGV[3] product id, ARGV[4] issued at (unix s), ARGV[5] ttl (s)
+-- returns ticket id, the existing one if the user already joined
+
+local existing = redis.call('GET', KEYS[2])
+if existing then
+    return existing
+end
+
+local ttl = tonumber(ARGV[5])
+local pos = redis.call('HINCRBY', KEYS[1], 'seq', 1)
+
+redis.call('HSET', KEYS[3], 'user_id', ARGV[2], 'product_id', ARGV[3], 'position', pos, 'issued_at', ARGV[4])
+redis.call('EXPIRE', KEYS[3], ttl)
+redis.call('SET', KEYS[2], ARGV[1], 'EX', ttl)
+
+-- room lives as long as its newest ticket
+redis.call('EXPIRE', KEYS[1], ttl)
+
+return ARGV[1]
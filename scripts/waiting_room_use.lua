@@ -0,0 +1,23 @@
+-- KEYS[1] ticket hash, KEYS[2] user -> ticket id, both tagged {product_id}
+-- ARGV[1] ticket id, ARGV[2] request key (Idempotency-Key, empty if none)
+-- an admitted ticket lets one precheck through, retries with the same Idempotency-Key reuse it
+-- the first use frees the user's place, joining again queues a new ticket at the back
+-- returns 1 if the request may go on, 0 if the ticket is used up or gone
+
+if redis.call('EXISTS', KEYS[1]) == 0 then
+    return 0
+end
+
+local used = redis.call('HGET', KEYS[1], 'used_by')
+if used then
+    if ARGV[2] ~= '' and used == ARGV[2] then
+        return 1
+    end
+    return 0
+end
+
+redis.call('HSET', KEYS[1], 'used_by', ARGV[2])
+if redis.call('GET', KEYS[2]) == ARGV[1] then
+    redis.call('DEL', KEYS[2])
+end
+return 1
@@ -28,11 +28,15 @@ SELECT
     failed_order_count AS orders_in_dlq_or_failed
 FROM consistency_audit;
 
--- 2. 虛擬庫存檢查：Redis vs DB (方案 A 允許微小延遲，但最終應接近)
--- 注意：此處需從外部帶入 Redis 數值，或觀察兩者差距
-SELECT 
-    'Redis vs DB Gap Check' AS metric,
-    'Manual Step: Run `redis-cli GET flashsale:stock:1001` and compare with DB current_db_stock' AS instruction;
+-- 2. 虛擬庫存檢查：Redis vs DB
+-- SQL 讀不到 Redis，由 `go run ./cmd/stockcheck -sale <flash_sale_id>` 比對各 bucket 加總與 sale_stock，不一致時 exit 1
+-- 以下為該工具比對的 DB 端數值
+SELECT
+    fsp.flash_sale_id,
+    fsp.product_id,
+    fsp.sale_stock AS db_stock
+FROM flash_sale_products fsp
+ORDER BY fsp.flash_sale_id, fsp.product_id;
 
 -- 3. 異常檢測：是否存在超賣（庫存變負數）
 SELECT 
@@ -0,0 +1,8 @@
+-- "my orders" listing: WHERE user_id = ? [AND flash_sale_id = ?] ORDER BY created_at DESC, id DESC
+-- CONCURRENTLY to avoid locking orders during a running sale, run outside a transaction
+
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_orders_user_created
+    ON orders (user_id, created_at DESC, id DESC);
+
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_orders_user_sale_created
+    ON orders (user_id, flash_sale_id, created_at DESC, id DESC);
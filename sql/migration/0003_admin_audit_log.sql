@@ -0,0 +1,15 @@
+-- every authenticated admin API call (incl. 403) is recorded by middleware.AdminAudit
+-- unauthenticated ones (401) get no row, they are only counted by AdminAuditService.CountUnauthenticated
+CREATE TABLE IF NOT EXISTS admin_audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    actor TEXT NOT NULL DEFAULT '',      -- token subject, empty if unauthenticated
+    role TEXT NOT NULL DEFAULT '',
+    action TEXT NOT NULL,                -- "POST /admin/flashsales/:id/warmup"
+    target TEXT NOT NULL DEFAULT '',     -- route params, "id=3"
+    status_code INT NOT NULL,
+    client_ip TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_admin_audit_log_actor_created
+    ON admin_audit_log (actor, created_at DESC);
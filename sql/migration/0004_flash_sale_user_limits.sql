@@ -0,0 +1,6 @@
+-- per user limits of a flash sale, 0 = unlimited
+-- enforced in user_quota_reserve.lua and re-verified by the worker before reducing stock
+-- the worker's count index is in 0006, CONCURRENTLY can't run in this file's transaction
+ALTER TABLE flash_sales
+    ADD COLUMN IF NOT EXISTS max_items_per_user INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS max_products_per_user INT NOT NULL DEFAULT 0;
@@ -0,0 +1,7 @@
+-- one non-failed order per user & product of a sale, last line of defense behind the Redis claim
+-- fails if duplicates already exist, find them with:
+--   SELECT flash_sale_id, product_id, user_id, COUNT(*) FROM orders
+--   WHERE status <> 'failed' GROUP BY 1, 2, 3 HAVING COUNT(*) > 1;
+CREATE UNIQUE INDEX CONCURRENTLY IF NOT EXISTS uq_orders_sale_product_user_active
+    ON orders (flash_sale_id, product_id, user_id)
+    WHERE status <> 'failed';
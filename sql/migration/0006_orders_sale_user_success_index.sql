@@ -0,0 +1,5 @@
+-- worker counts a user's successful orders of the sale, see max_*_per_user in 0004
+-- CONCURRENTLY to avoid locking orders during a running sale, run outside a transaction
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_orders_sale_user_success
+    ON orders (flash_sale_id, user_id)
+    WHERE status = 'success';